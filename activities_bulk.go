@@ -0,0 +1,268 @@
+package assembled
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// BulkActivityOptions controls how CreateBulkActivityBatched splits requests
+// into batches.
+type BulkActivityOptions struct {
+	// Maximum number of activity requests per batch. Defaults to 100.
+	MaxBatchSize int
+
+	// Maximum encoded size of the activity requests in a batch, in bytes.
+	// Defaults to 512 KiB. A single request larger than this is sent in a
+	// batch of its own.
+	MaxBatchBytes int
+
+	// Maximum number of batches sent at once. Defaults to 2.
+	Concurrency int
+}
+
+func (o *BulkActivityOptions) withDefaults() BulkActivityOptions {
+	var opts BulkActivityOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.MaxBatchSize <= 0 {
+		opts.MaxBatchSize = 100
+	}
+	if opts.MaxBatchBytes <= 0 {
+		opts.MaxBatchBytes = 512 << 10
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 2
+	}
+	return opts
+}
+
+// BulkActivityItem is a single activity request along with the schedule it
+// applies to. An empty ScheduleID refers to the master schedule.
+type BulkActivityItem struct {
+	ScheduleID string
+	Request    ActivityRequest
+}
+
+// BulkOutcome is what is known about whether a batch sent by
+// CreateBulkActivityBatched was applied.
+type BulkOutcome int
+
+const (
+	// BulkCommitted means the API confirmed the batch was created.
+	BulkCommitted BulkOutcome = iota
+
+	// BulkRejected means the batch was definitely not applied: the API
+	// answered with a 4xx error, or the batch was never sent because ctx
+	// was done. Its items can be fixed and sent again.
+	BulkRejected
+
+	// BulkUnknown means the batch may or may not have been applied: the
+	// request failed with a network error, a timeout or a 5xx error after
+	// it was sent. Since the request is not idempotent, its items should be
+	// checked against ListActivities before being sent again.
+	BulkUnknown
+)
+
+func (o BulkOutcome) String() string {
+	switch o {
+	case BulkCommitted:
+		return "committed"
+	case BulkRejected:
+		return "rejected"
+	case BulkUnknown:
+		return "unknown"
+	}
+	return fmt.Sprintf("BulkOutcome(%d)", int(o))
+}
+
+// bulkOutcome classifies the error of a CreateBulkActivity request.
+func bulkOutcome(err error) BulkOutcome {
+	if err == nil {
+		return BulkCommitted
+	}
+	var e *Error
+	if errors.As(err, &e) && e.StatusCode >= 400 && e.StatusCode < 500 {
+		return BulkRejected
+	}
+	return BulkUnknown
+}
+
+// BulkActivityResult reports the outcome of a single item passed to
+// CreateBulkActivityBatched.
+type BulkActivityResult struct {
+	Item  BulkActivityItem
+	Index int // Position of the item in the input.
+	Batch int // Index of the batch the item was sent in.
+
+	// Outcome of the batch containing the item. Batches are
+	// transactional, so either every item of a batch is committed or none
+	// of them is.
+	Outcome BulkOutcome
+
+	// Error that made the batch fail, if any.
+	Err error
+}
+
+// BulkActivityReport is the outcome of CreateBulkActivityBatched.
+type BulkActivityReport struct {
+	// One result per input item, in input order.
+	Results []BulkActivityResult
+
+	// Activities returned by every committed batch, keyed by ID.
+	Activities map[string]Activity
+
+	Batches        int
+	FailedBatches  int // Batches that were not committed, including unknown ones.
+	UnknownBatches int
+}
+
+// Failed returns the items whose batch was rejected, in input order, so that
+// they can be retried without re-sending committed ones. Items whose outcome
+// is unknown are left out; see Unknown.
+func (r *BulkActivityReport) Failed() []BulkActivityItem {
+	return r.items(BulkRejected)
+}
+
+// Unknown returns the items whose batch may or may not have been applied, in
+// input order. Sending them again may duplicate activities, so they should be
+// reconciled with the schedule first.
+func (r *BulkActivityReport) Unknown() []BulkActivityItem {
+	return r.items(BulkUnknown)
+}
+
+func (r *BulkActivityReport) items(o BulkOutcome) []BulkActivityItem {
+	var items []BulkActivityItem
+	for _, res := range r.Results {
+		if res.Outcome == o {
+			items = append(items, res.Item)
+		}
+	}
+	return items
+}
+
+type activityBatch struct {
+	ScheduleID string
+	Indexes    []int
+}
+
+// CreateBulkActivityBatched sends any number of activity requests through
+// CreateBulkActivity, splitting them into batches that stay within the limits
+// of opts. Items are grouped by schedule, keep their relative order within a
+// batch, and batches are sent concurrently in no particular order.
+//
+// The report is returned even when some batches fail, in which case the
+// error describes the first failure. A nil opts uses the defaults described
+// on BulkActivityOptions.
+func (c *Client) CreateBulkActivityBatched(ctx context.Context, items []BulkActivityItem, opts *BulkActivityOptions) (*BulkActivityReport, error) {
+	o := opts.withDefaults()
+	batches, err := splitActivityBatches(items, o)
+	if err != nil {
+		return nil, fmt.Errorf("CreateBulkActivityBatched: %w", err)
+	}
+
+	report := &BulkActivityReport{
+		Results:    make([]BulkActivityResult, len(items)),
+		Activities: make(map[string]Activity),
+		Batches:    len(batches),
+	}
+	for i, item := range items {
+		report.Results[i] = BulkActivityResult{Item: item, Index: i}
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, o.Concurrency)
+	)
+	for n, b := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(n int, b activityBatch) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			req := &CreateBulkActivityRequest{ScheduleID: b.ScheduleID}
+			for _, i := range b.Indexes {
+				req.Activities = append(req.Activities, items[i].Request)
+			}
+			var (
+				resp    *CreateBulkActivityResponse
+				outcome = BulkRejected
+				err     = ctx.Err()
+			)
+			if err == nil {
+				resp, err = c.CreateBulkActivity(ctx, req)
+				outcome = bulkOutcome(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, i := range b.Indexes {
+				res := &report.Results[i]
+				res.Batch = n
+				res.Outcome = outcome
+				res.Err = err
+			}
+			if err != nil {
+				report.FailedBatches++
+				if outcome == BulkUnknown {
+					report.UnknownBatches++
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			for id, a := range resp.Activities {
+				report.Activities[id] = a
+			}
+		}(n, b)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return report, fmt.Errorf("CreateBulkActivityBatched: %d of %d batches failed: %w", report.FailedBatches, report.Batches, firstErr)
+	}
+	return report, nil
+}
+
+// splitActivityBatches groups items by schedule, in order of first
+// appearance, and cuts each group into batches within the size limits.
+func splitActivityBatches(items []BulkActivityItem, o BulkActivityOptions) ([]activityBatch, error) {
+	var schedules []string
+	groups := make(map[string][]int)
+	for i, item := range items {
+		if _, ok := groups[item.ScheduleID]; !ok {
+			schedules = append(schedules, item.ScheduleID)
+		}
+		groups[item.ScheduleID] = append(groups[item.ScheduleID], i)
+	}
+
+	var batches []activityBatch
+	for _, schedule := range schedules {
+		cur := activityBatch{ScheduleID: schedule}
+		size := 0
+		for _, i := range groups[schedule] {
+			payload, err := json.Marshal(items[i].Request)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			if len(cur.Indexes) > 0 && (len(cur.Indexes) >= o.MaxBatchSize || size+len(payload) > o.MaxBatchBytes) {
+				batches = append(batches, cur)
+				cur = activityBatch{ScheduleID: schedule}
+				size = 0
+			}
+			cur.Indexes = append(cur.Indexes, i)
+			size += len(payload) + 1 // Separating comma.
+		}
+		if len(cur.Indexes) > 0 {
+			batches = append(batches, cur)
+		}
+	}
+	return batches, nil
+}
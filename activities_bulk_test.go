@@ -0,0 +1,93 @@
+package assembled_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+func TestCreateBulkActivityBatchedOutcomes(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	agent := srv.AddAgent(assembled.Agent{Name: "Ada"})
+	typ := srv.AddActivityType(assembled.ActivityType{Name: "Phones"})
+	start := time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC)
+	item := func(agentID string, hour int) assembled.BulkActivityItem {
+		return assembled.BulkActivityItem{Request: assembled.ActivityRequest{
+			Action: "create",
+			Activity: assembled.Activity{
+				AgentID:   agentID,
+				TypeID:    typ.ID,
+				StartTime: start.Add(time.Duration(hour) * time.Hour),
+				EndTime:   start.Add(time.Duration(hour+1) * time.Hour),
+			},
+		}}
+	}
+	items := []assembled.BulkActivityItem{
+		item(agent.ID, 0), // Applied, but its response is lost.
+		item("nobody", 1), // Rejected.
+		item(agent.ID, 2), // Committed.
+	}
+	// The first batch is applied before failing with a 502, which the client
+	// does not retry since the request is not idempotent.
+	srv.InjectFault(assembledtest.Fault{Method: "POST", Times: 1, StatusCode: http.StatusBadGateway, AfterHandling: true})
+
+	report, err := srv.Client().CreateBulkActivityBatched(context.Background(), items, &assembled.BulkActivityOptions{
+		MaxBatchSize: 1,
+		Concurrency:  1,
+	})
+	if err == nil {
+		t.Fatal("no error despite failed batches")
+	}
+
+	want := []assembled.BulkOutcome{assembled.BulkUnknown, assembled.BulkRejected, assembled.BulkCommitted}
+	for i, res := range report.Results {
+		if res.Outcome != want[i] {
+			t.Errorf("item %d: outcome %v (%v), want %v", i, res.Outcome, res.Err, want[i])
+		}
+	}
+	if !errors.Is(report.Results[1].Err, assembled.ErrValidation) {
+		t.Errorf("rejected item: err = %v, want ErrValidation", report.Results[1].Err)
+	}
+	if got := report.Failed(); !reflect.DeepEqual(got, items[1:2]) {
+		t.Errorf("Failed() = %+v, want the rejected item only", got)
+	}
+	if got := report.Unknown(); !reflect.DeepEqual(got, items[:1]) {
+		t.Errorf("Unknown() = %+v, want the item whose response was lost", got)
+	}
+	if report.Batches != 3 || report.FailedBatches != 2 || report.UnknownBatches != 1 {
+		t.Errorf("batches %d, failed %d, unknown %d", report.Batches, report.FailedBatches, report.UnknownBatches)
+	}
+	if len(report.Activities) != 1 {
+		t.Errorf("got %d activities from committed batches, want 1", len(report.Activities))
+	}
+	// The unknown batch was in fact applied.
+	if got := srv.Activities(""); len(got) != 2 {
+		t.Errorf("schedule has %d activities, want 2", len(got))
+	}
+}
+
+func TestCreateBulkActivityBatchedCanceled(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	items := []assembled.BulkActivityItem{{Request: assembled.ActivityRequest{Action: "delete", Activity: assembled.Activity{ID: "a1"}}}}
+	report, err := srv.Client().CreateBulkActivityBatched(ctx, items, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if got := report.Failed(); len(got) != 1 {
+		t.Errorf("Failed() = %+v, want the unsent item", got)
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("server got %d requests after ctx was done", n)
+	}
+}
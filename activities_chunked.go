@@ -0,0 +1,137 @@
+package assembled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ChunkOptions controls how a long time window is split into smaller
+// requests.
+type ChunkOptions struct {
+	// Length of each chunk. Defaults to 24 hours.
+	ChunkSize time.Duration
+
+	// Maximum number of chunks fetched at once. Defaults to 4.
+	Concurrency int
+}
+
+func (o *ChunkOptions) withDefaults() ChunkOptions {
+	var opts ChunkOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 24 * time.Hour
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	return opts
+}
+
+type timeWindow struct {
+	Start, End time.Time
+}
+
+// splitWindow divides [start, end) into consecutive windows no longer than
+// size.
+func splitWindow(start, end time.Time, size time.Duration) []timeWindow {
+	var windows []timeWindow
+	for s := start; s.Before(end); s = s.Add(size) {
+		e := s.Add(size)
+		if e.After(end) {
+			e = end
+		}
+		windows = append(windows, timeWindow{Start: s, End: e})
+	}
+	return windows
+}
+
+// ListActivitiesChunked behaves like ListActivities, but splits the window
+// between StartTime and EndTime into chunks that are fetched concurrently
+// and merged into a single response. Activities spanning several chunks are
+// returned by each of them and appear once in the result.
+//
+// Both StartTime and EndTime must be set. A nil opts uses the defaults
+// described on ChunkOptions. If any chunk fails, or ctx is done before every
+// chunk is fetched, an error is returned rather than a partial response.
+func (c *Client) ListActivitiesChunked(ctx context.Context, r *ListActivitiesRequest, opts *ChunkOptions) (*ListActivitiesResponse, error) {
+	if r == nil || r.StartTime.IsZero() || !r.EndTime.After(r.StartTime) {
+		return nil, errors.New("ListActivitiesChunked: StartTime and EndTime must be set")
+	}
+	o := opts.withDefaults()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	windows := make(chan timeWindow)
+	go func() {
+		defer close(windows)
+		for _, w := range splitWindow(r.StartTime, r.EndTime, o.ChunkSize) {
+			select {
+			case windows <- w:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+		merged   = &ListActivitiesResponse{
+			Activities: make(map[string]Activity),
+			Agents:     make(map[string]Agent),
+			Queues:     make(map[string]Queue),
+		}
+	)
+	for i := 0; i < o.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range windows {
+				req := *r
+				req.StartTime, req.EndTime = w.Start, w.End
+				resp, err := c.ListActivities(ctx, &req)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					merged.merge(resp)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, fmt.Errorf("ListActivitiesChunked: %w", firstErr)
+	}
+	// Windows left unsent once the parent context is done are missing from
+	// merged, even if no request failed.
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("ListActivitiesChunked: %w", err)
+	}
+	return merged, nil
+}
+
+func (r *ListActivitiesResponse) merge(other *ListActivitiesResponse) {
+	for id, a := range other.Activities {
+		r.Activities[id] = a
+	}
+	for id, a := range other.Agents {
+		r.Agents[id] = a
+	}
+	for id, q := range other.Queues {
+		r.Queues[id] = q
+	}
+}
@@ -0,0 +1,111 @@
+package assembled_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+var chunkStart = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// chunkServer returns a server with one activity a day for four days, from
+// 09:00 to 17:00, and one spanning the night between the first two days.
+func chunkServer(t *testing.T) (*assembledtest.Server, map[string]bool) {
+	t.Helper()
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	agent := srv.AddAgent(assembled.Agent{Name: "Ada"})
+	typ := srv.AddActivityType(assembled.ActivityType{Name: "Phones"})
+	ids := make(map[string]bool)
+	add := func(from, to time.Duration) {
+		a := srv.AddActivity("", assembled.Activity{
+			AgentID: agent.ID, TypeID: typ.ID, StartTime: chunkStart.Add(from), EndTime: chunkStart.Add(to),
+		})
+		ids[a.ID] = true
+	}
+	for day := 0; day < 4; day++ {
+		d := time.Duration(day) * 24 * time.Hour
+		add(d+9*time.Hour, d+17*time.Hour)
+	}
+	add(20*time.Hour, 30*time.Hour)
+	return srv, ids
+}
+
+func listWindow(days int) *assembled.ListActivitiesRequest {
+	return &assembled.ListActivitiesRequest{
+		StartTime:     chunkStart,
+		EndTime:       chunkStart.Add(time.Duration(days) * 24 * time.Hour),
+		IncludeAgents: true,
+	}
+}
+
+func activityIDs(activities map[string]assembled.Activity) []string {
+	var ids []string
+	for id := range activities {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestListActivitiesChunked(t *testing.T) {
+	srv, want := chunkServer(t)
+	n := len(srv.Requests())
+	resp, err := srv.Client().ListActivitiesChunked(context.Background(), listWindow(4), &assembled.ChunkOptions{
+		ChunkSize:   24 * time.Hour,
+		Concurrency: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(srv.Requests()) - n; got != 4 {
+		t.Errorf("%d requests, want one per day", got)
+	}
+	// The overnight activity is returned by two chunks, and merged once.
+	if got := activityIDs(resp.Activities); len(got) != len(want) {
+		t.Errorf("activities %v, want %d", got, len(want))
+	}
+	for id := range resp.Activities {
+		if !want[id] {
+			t.Errorf("unexpected activity %s", id)
+		}
+	}
+	if len(resp.Agents) != 1 {
+		t.Errorf("agents = %+v, want Ada", resp.Agents)
+	}
+}
+
+func TestListActivitiesChunkedErrors(t *testing.T) {
+	if _, err := assembled.NewClient("key").ListActivitiesChunked(context.Background(), &assembled.ListActivitiesRequest{}, nil); err == nil {
+		t.Error("no error without a window")
+	}
+
+	srv, _ := chunkServer(t)
+	srv.InjectFault(assembledtest.Fault{Method: "GET", Times: 1, StatusCode: http.StatusInternalServerError})
+	resp, err := srv.Client(assembled.WithRetryPolicy(nil)).ListActivitiesChunked(context.Background(), listWindow(4), nil)
+	var apiErr *assembled.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || resp != nil {
+		t.Errorf("failing chunk: %v, %v", resp, err)
+	}
+}
+
+func TestListActivitiesChunkedCanceled(t *testing.T) {
+	srv, _ := chunkServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Canceled once the first chunk is fetched, leaving the others unsent or
+	// failing.
+	c := srv.Client(assembled.WithObserver(assembled.ObserverFunc(func(context.Context, *assembled.RequestRecord) {
+		cancel()
+	})))
+	resp, err := c.ListActivitiesChunked(ctx, listWindow(4), &assembled.ChunkOptions{Concurrency: 1})
+	if !errors.Is(err, context.Canceled) || resp != nil {
+		t.Errorf("got %v, %v, want context.Canceled", resp, err)
+	}
+}
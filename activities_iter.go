@@ -0,0 +1,188 @@
+package assembled
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ActivityIterator streams the activities matching a ListActivitiesRequest
+// in start time order. Create one with Client.IterActivities:
+//
+//	it := client.IterActivities(ctx, req, nil)
+//	for it.Next() {
+//		a := it.Activity()
+//		// ...
+//	}
+//	if err := it.Err(); err != nil {
+//		// ...
+//	}
+type ActivityIterator struct {
+	c       *Client
+	ctx     context.Context
+	req     ListActivitiesRequest
+	windows []timeWindow
+	window  int
+
+	buf []Activity
+	cur Activity
+	err error
+}
+
+// IterActivities returns an iterator over the activities matching r, ordered
+// by start time and then ID. The window between StartTime and EndTime is
+// fetched one chunk at a time, so only the activities starting within a
+// single chunk are held in memory. Each activity is returned once, even when
+// it spans several chunks.
+//
+// Both StartTime and EndTime must be set. Only the ChunkSize of opts is used;
+// a nil opts uses the default.
+func (c *Client) IterActivities(ctx context.Context, r *ListActivitiesRequest, opts *ChunkOptions) *ActivityIterator {
+	it := &ActivityIterator{c: c, ctx: ctx}
+	if r == nil || r.StartTime.IsZero() || !r.EndTime.After(r.StartTime) {
+		it.err = errors.New("IterActivities: StartTime and EndTime must be set")
+		return it
+	}
+	it.req = *r
+	it.windows = splitWindow(r.StartTime, r.EndTime, opts.withDefaults().ChunkSize)
+	return it
+}
+
+// Next advances to the next activity, fetching the next chunk when needed.
+// It returns false when there are no more activities or an error occurred.
+func (it *ActivityIterator) Next() bool {
+	for len(it.buf) == 0 {
+		if it.err != nil || it.window >= len(it.windows) {
+			return false
+		}
+		it.err = it.fetch()
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Activity returns the activity Next advanced to.
+func (it *ActivityIterator) Activity() Activity {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ActivityIterator) Err() error {
+	return it.err
+}
+
+// fetch buffers the activities starting within the next window. Activities
+// starting before the first window are returned with it.
+func (it *ActivityIterator) fetch() error {
+	w := it.windows[it.window]
+	first := it.window == 0
+	it.window++
+
+	stream := &activityStream{keep: func(a Activity) bool {
+		return a.StartTime.Before(w.End) && (first || !a.StartTime.Before(w.Start))
+	}}
+	req := it.req
+	req.StartTime, req.EndTime = w.Start, w.End
+	if err := it.c.request(it.ctx, "GET", "/v0/activities", req.params(), nil, stream); err != nil {
+		return fmt.Errorf("IterActivities: %w", err)
+	}
+
+	sort.Slice(stream.activities, func(i, j int) bool {
+		a, b := stream.activities[i], stream.activities[j]
+		if !a.StartTime.Equal(b.StartTime) {
+			return a.StartTime.Before(b.StartTime)
+		}
+		return a.ID < b.ID
+	})
+	it.buf = stream.activities
+	return nil
+}
+
+// activityStream decodes the activities of a ListActivities response one at
+// a time, keeping only those accepted by keep and skipping the agents and
+// queues.
+type activityStream struct {
+	keep       func(Activity) bool
+	activities []Activity
+}
+
+func (s *activityStream) decodeBody(r io.Reader) error {
+	s.activities = s.activities[:0]
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key, _ := tok.(string); key != "activities" {
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil {
+			continue
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '{' {
+			return fmt.Errorf("unexpected %v decoding activities", tok)
+		}
+		for dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return err
+			}
+			var a Activity
+			if err := dec.Decode(&a); err != nil {
+				return err
+			}
+			if s.keep(a) {
+				s.activities = append(s.activities, a)
+			}
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("unexpected %v, expected %v", tok, want)
+	}
+	return nil
+}
+
+// skipValue discards the next JSON value without buffering it.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package assembled_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+// iterate returns the IDs of the activities of it, and its error.
+func iterate(it *assembled.ActivityIterator) ([]string, error) {
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.Activity().ID)
+	}
+	return ids, it.Err()
+}
+
+func TestIterActivities(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	agent := srv.AddAgent(assembled.Agent{Name: "Ada"}).ID
+	typ := srv.AddActivityType(assembled.ActivityType{Name: "Phones"}).ID
+	add := func(id string, from, to int) {
+		srv.AddActivity("", assembled.Activity{
+			ID: id, AgentID: agent, TypeID: typ,
+			StartTime: chunkStart.Add(time.Duration(from) * time.Hour),
+			EndTime:   chunkStart.Add(time.Duration(to) * time.Hour),
+		})
+	}
+	// Added out of order, and ending up in several chunks.
+	add("day2", 57, 60)
+	add("night", 22, 26) // Straddles the first chunk boundary.
+	add("day1-b", 33, 34)
+	add("day1-a", 33, 35) // Starts with day1-b, and ordered before it by ID.
+	add("before", -2, 2)  // Starts before the window.
+	add("day0", 9, 17)
+	add("after", 72, 80) // Starts after the window.
+
+	n := len(srv.Requests())
+	it := srv.Client().IterActivities(context.Background(), listWindow(3), &assembled.ChunkOptions{ChunkSize: 24 * time.Hour})
+	ids, err := iterate(it)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(ids, " "), "before day0 night day1-a day1-b day2"; got != want {
+		t.Errorf("activities %s, want %s", got, want)
+	}
+	if got := len(srv.Requests()) - n; got != 3 {
+		t.Errorf("%d requests, want one per chunk", got)
+	}
+
+	it = srv.Client().IterActivities(context.Background(), &assembled.ListActivitiesRequest{}, nil)
+	if it.Next() || it.Err() == nil {
+		t.Error("no error without a window")
+	}
+}
+
+// rawActivities returns the JSON of activities keyed by ID.
+func rawActivities(t *testing.T, activities ...assembled.Activity) string {
+	t.Helper()
+	m := make(map[string]assembled.Activity)
+	for _, a := range activities {
+		m[a.ID] = a
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// rawServer serves the given bodies to successive requests, repeating the
+// last one.
+func rawServer(t *testing.T, bodies ...string) *assembled.Client {
+	t.Helper()
+	var (
+		mu sync.Mutex
+		n  int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body := bodies[n]
+		if n < len(bodies)-1 {
+			n++
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return assembled.NewClient("key", assembled.WithBaseURL(srv.URL), assembled.WithRetryPolicy(nil))
+}
+
+func TestIterActivitiesDecoding(t *testing.T) {
+	at := func(id string, hour int) assembled.Activity {
+		return assembled.Activity{ID: id, AgentID: "a1", TypeID: "phones",
+			StartTime: chunkStart.Add(time.Duration(hour) * time.Hour), EndTime: chunkStart.Add(time.Duration(hour+1) * time.Hour)}
+	}
+	agents := `{"a1":{"id":"a1","name":"Ada","queues":["q1"],"teams":[]}}`
+	queues := `{"q1":{"id":"q1","name":"Billing","nested":[{"a":[1,2]},{}]}}`
+	acts := rawActivities(t, at("b", 2), at("a", 1))
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"activities first", `{"activities":` + acts + `,"agents":` + agents + `,"queues":` + queues + `}`, "a b"},
+		{"activities last", `{"agents":` + agents + `,"queues":` + queues + `,"activity_types":{"phones":{}},"activities":` + acts + `}`, "a b"},
+		{"activities between", `{"agents":` + agents + `,"activities":` + acts + `,"queues":` + queues + `}`, "a b"},
+		{"null activities", `{"activities":null,"agents":null}`, ""},
+		{"no activities", `{"queues":{}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := rawServer(t, tt.body)
+			req := &assembled.ListActivitiesRequest{StartTime: chunkStart, EndTime: chunkStart.Add(24 * time.Hour)}
+			ids, err := iterate(c.IterActivities(context.Background(), req, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(ids, " "); got != tt.want {
+				t.Errorf("activities %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIterActivitiesError(t *testing.T) {
+	at := func(id string, hour int) assembled.Activity {
+		return assembled.Activity{ID: id, StartTime: chunkStart.Add(time.Duration(hour) * time.Hour), EndTime: chunkStart.Add(time.Duration(hour+1) * time.Hour)}
+	}
+	first := `{"activities":` + rawActivities(t, at("a", 1)) + `}`
+	tests := []struct {
+		name   string
+		second string
+	}{
+		{"truncated", `{"activities":{"b":{"id":"b","start_time":`},
+		{"not an object", `{"activities":[1,2]}`},
+		{"invalid activity", `{"activities":{"b":{"start_time":"noon"}}}`},
+		{"trailing garbage", `{"activities":{}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := rawServer(t, first, tt.second)
+			it := c.IterActivities(context.Background(), listWindow(3), &assembled.ChunkOptions{ChunkSize: 24 * time.Hour})
+			ids, err := iterate(it)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			// The activities of the first chunk were returned before the
+			// error, which stops the iteration.
+			if fmt.Sprint(ids) != "[a]" {
+				t.Errorf("activities %v before the error, want [a]", ids)
+			}
+			if it.Next() {
+				t.Error("Next after an error")
+			}
+		})
+	}
+}
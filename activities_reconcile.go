@@ -0,0 +1,235 @@
+package assembled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ReconcileActivitiesRequest describes the activities that should exist for a
+// set of agents over a time window.
+type ReconcileActivitiesRequest struct {
+	// Identifier for the corresponding schedule. Defaults to the master
+	// schedule.
+	ScheduleID string
+
+	// Agents whose activities are reconciled. Activities of other agents are
+	// never changed.
+	AgentIDs []string
+
+	StartTime time.Time
+	EndTime   time.Time
+
+	// Activities that should exist in the window. Their IDs are ignored, and
+	// each must belong to one of AgentIDs and lie within the window.
+	Desired []Activity
+
+	// If true, the plan is computed but not applied.
+	DryRun bool
+}
+
+// ActivityPlan lists the changes needed to make a schedule match the desired
+// activities.
+type ActivityPlan struct {
+	ScheduleID string
+
+	Create []Activity // Activities to create. IDs are empty.
+	Update []Activity // Existing activities, by ID, with their new fields.
+	Delete []Activity // Existing activities to delete.
+
+	// Existing activities already matching a desired activity.
+	Unchanged []Activity
+
+	// Existing activities extending beyond the window. They are left alone,
+	// since changing them would affect time outside of it.
+	Skipped []Activity
+
+	// Whether the plan was sent to the API.
+	Applied bool
+}
+
+// Empty reports whether the plan makes no changes.
+func (p *ActivityPlan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// BulkRequest returns the plan as a single request for CreateBulkActivity.
+// Deletions come first and creations last, so that an activity is never
+// created over one that is about to be removed.
+func (p *ActivityPlan) BulkRequest() *CreateBulkActivityRequest {
+	req := &CreateBulkActivityRequest{ScheduleID: p.ScheduleID}
+	for _, a := range p.Delete {
+		req.Activities = append(req.Activities, ActivityRequest{Action: "delete", Activity: Activity{ID: a.ID}})
+	}
+	for _, a := range p.Update {
+		req.Activities = append(req.Activities, ActivityRequest{Action: "update", Activity: a})
+	}
+	for _, a := range p.Create {
+		req.Activities = append(req.Activities, ActivityRequest{Action: "create", Activity: a})
+	}
+	return req
+}
+
+// ReconcileActivities compares the desired activities of r against those in
+// Assembled and applies the difference in a single CreateBulkActivity
+// request, unless r.DryRun is set.
+//
+// Activities are matched on their agent, type, start time, end time and
+// description. Existing activities that do not match exactly are updated in
+// place when they overlap a remaining desired activity of the same agent,
+// which keeps their IDs stable; the rest are deleted, and remaining desired
+// activities are created. Since updates leave empty fields unchanged, an
+// activity whose description or type would be cleared is deleted and
+// created again rather than updated.
+func (c *Client) ReconcileActivities(ctx context.Context, r *ReconcileActivitiesRequest) (*ActivityPlan, error) {
+	if r == nil || r.StartTime.IsZero() || !r.EndTime.After(r.StartTime) {
+		return nil, errors.New("ReconcileActivities: StartTime and EndTime must be set")
+	}
+	if len(r.AgentIDs) == 0 {
+		return nil, errors.New("ReconcileActivities: AgentIDs must be set")
+	}
+	agents := make(map[string]bool)
+	for _, id := range r.AgentIDs {
+		agents[id] = true
+	}
+	for i, a := range r.Desired {
+		if !agents[a.AgentID] {
+			return nil, fmt.Errorf("ReconcileActivities: desired activity %d belongs to agent %q, which is not in AgentIDs", i, a.AgentID)
+		}
+		if a.StartTime.Before(r.StartTime) || a.EndTime.After(r.EndTime) || !a.EndTime.After(a.StartTime) {
+			return nil, fmt.Errorf("ReconcileActivities: desired activity %d does not lie within the window", i)
+		}
+	}
+
+	resp, err := c.ListActivitiesChunked(ctx, &ListActivitiesRequest{
+		ScheduleID: r.ScheduleID,
+		Agents:     r.AgentIDs,
+		StartTime:  r.StartTime,
+		EndTime:    r.EndTime,
+	}, nil)
+	// A plan made from a partial listing would create or delete the wrong
+	// activities, so a done context stops here as well.
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ReconcileActivities: %w", err)
+	}
+	var existing []Activity
+	for _, a := range resp.Activities {
+		if agents[a.AgentID] {
+			existing = append(existing, a)
+		}
+	}
+
+	plan := planActivities(r.StartTime, r.EndTime, existing, r.Desired)
+	plan.ScheduleID = r.ScheduleID
+	if r.DryRun || plan.Empty() {
+		return plan, nil
+	}
+	if _, err := c.CreateBulkActivity(ctx, plan.BulkRequest()); err != nil {
+		return plan, fmt.Errorf("ReconcileActivities: %w", err)
+	}
+	plan.Applied = true
+	return plan, nil
+}
+
+// planActivities computes the changes turning existing into desired over the
+// window between start and end.
+func planActivities(start, end time.Time, existing, desired []Activity) *ActivityPlan {
+	plan := &ActivityPlan{}
+	sortActivities(existing)
+	desired = append([]Activity(nil), desired...)
+	sortActivities(desired)
+
+	// Match identical activities first.
+	byKey := make(map[string][]Activity)
+	for _, a := range existing {
+		if a.StartTime.Before(start) || a.EndTime.After(end) {
+			plan.Skipped = append(plan.Skipped, a)
+			continue
+		}
+		byKey[activityKey(a)] = append(byKey[activityKey(a)], a)
+	}
+	var unmatched []Activity
+	for _, d := range desired {
+		k := activityKey(d)
+		if matches := byKey[k]; len(matches) > 0 {
+			plan.Unchanged = append(plan.Unchanged, matches[0])
+			byKey[k] = matches[1:]
+			continue
+		}
+		unmatched = append(unmatched, d)
+	}
+	var leftover []Activity
+	for _, a := range existing {
+		for _, m := range byKey[activityKey(a)] {
+			if m.ID == a.ID {
+				leftover = append(leftover, a)
+				break
+			}
+		}
+	}
+
+	// Then reuse overlapping leftovers of the same agent as updates.
+	used := make(map[string]bool)
+	for _, d := range unmatched {
+		reused := false
+		for _, a := range leftover {
+			if used[a.ID] || !updatable(a, d) || !a.StartTime.Before(d.EndTime) || !a.EndTime.After(d.StartTime) {
+				continue
+			}
+			used[a.ID] = true
+			d.ID = a.ID
+			plan.Update = append(plan.Update, d)
+			reused = true
+			break
+		}
+		if !reused {
+			d.ID = ""
+			plan.Create = append(plan.Create, d)
+		}
+	}
+	for _, a := range leftover {
+		if !used[a.ID] {
+			plan.Delete = append(plan.Delete, a)
+		}
+	}
+	return plan
+}
+
+// updatable reports whether an update request can turn a into d. Updates
+// cannot move an activity to another agent, and empty fields are left out of
+// the request, so they cannot clear a field either.
+func updatable(a, d Activity) bool {
+	if a.AgentID != d.AgentID {
+		return false
+	}
+	if d.TypeID == "" && a.TypeID != "" {
+		return false
+	}
+	return d.Description != "" || a.Description == ""
+}
+
+// activityKey identifies an activity by its content rather than its ID.
+func activityKey(a Activity) string {
+	return a.AgentID + "\x00" + a.TypeID + "\x00" +
+		strconv.FormatInt(a.StartTime.Unix(), 10) + "\x00" +
+		strconv.FormatInt(a.EndTime.Unix(), 10) + "\x00" + a.Description
+}
+
+func sortActivities(activities []Activity) {
+	sort.Slice(activities, func(i, j int) bool {
+		a, b := activities[i], activities[j]
+		if a.AgentID != b.AgentID {
+			return a.AgentID < b.AgentID
+		}
+		if !a.StartTime.Equal(b.StartTime) {
+			return a.StartTime.Before(b.StartTime)
+		}
+		return a.ID < b.ID
+	})
+}
@@ -0,0 +1,134 @@
+package assembled_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+// reconcileServer returns a server with agents Ada and Grace and the
+// activity types phones and lunch.
+func reconcileServer(t *testing.T) (srv *assembledtest.Server, ada, grace, phones, lunch string) {
+	t.Helper()
+	srv = assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ada = srv.AddAgent(assembled.Agent{Name: "Ada"}).ID
+	grace = srv.AddAgent(assembled.Agent{Name: "Grace"}).ID
+	phones = srv.AddActivityType(assembled.ActivityType{ID: "phones"}).ID
+	lunch = srv.AddActivityType(assembled.ActivityType{ID: "lunch"}).ID
+	return srv, ada, grace, phones, lunch
+}
+
+// hours returns an activity from hour from to hour to after chunkStart.
+func hours(agentID, typeID string, from, to int) assembled.Activity {
+	return assembled.Activity{
+		AgentID:   agentID,
+		TypeID:    typeID,
+		StartTime: chunkStart.Add(time.Duration(from) * time.Hour),
+		EndTime:   chunkStart.Add(time.Duration(to) * time.Hour),
+	}
+}
+
+// schedule lists the activities of the master schedule as
+// "agent/type/from-to", sorted.
+func schedule(srv *assembledtest.Server) []string {
+	var out []string
+	for _, a := range srv.Activities("") {
+		out = append(out, fmt.Sprintf("%s/%s/%d-%d", a.AgentID, a.TypeID,
+			int(a.StartTime.Sub(chunkStart).Hours()), int(a.EndTime.Sub(chunkStart).Hours())))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestReconcileActivities(t *testing.T) {
+	srv, ada, grace, phones, lunch := reconcileServer(t)
+	kept := srv.AddActivity("", hours(ada, phones, 9, 12))
+	moved := srv.AddActivity("", hours(ada, phones, 13, 15))
+	srv.AddActivity("", hours(ada, lunch, 44, 45))   // Deleted.
+	srv.AddActivity("", hours(grace, lunch, 36, 37)) // Of another agent.
+	srv.AddActivity("", hours(ada, lunch, -2, 2))    // Beyond the window.
+
+	req := &assembled.ReconcileActivitiesRequest{
+		AgentIDs:  []string{ada},
+		StartTime: chunkStart,
+		EndTime:   chunkStart.Add(48 * time.Hour),
+		Desired: []assembled.Activity{
+			hours(ada, phones, 9, 12),
+			hours(ada, phones, 13, 16),
+			hours(ada, phones, 33, 41),
+		},
+		DryRun: true,
+	}
+	before := schedule(srv)
+	plan, err := srv.Client().ReconcileActivities(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Applied || fmt.Sprint(schedule(srv)) != fmt.Sprint(before) {
+		t.Errorf("dry run changed the schedule: %v", schedule(srv))
+	}
+
+	req.DryRun = false
+	plan, err = srv.Client().ReconcileActivities(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Applied || len(plan.Create) != 1 || len(plan.Update) != 1 || len(plan.Delete) != 1 ||
+		len(plan.Unchanged) != 1 || len(plan.Skipped) != 1 {
+		t.Errorf("plan = %+v", plan)
+	}
+	if plan.Unchanged[0].ID != kept.ID || plan.Update[0].ID != moved.ID {
+		t.Errorf("plan kept %s and updated %s, want %s and %s", plan.Unchanged[0].ID, plan.Update[0].ID, kept.ID, moved.ID)
+	}
+	want := []string{
+		ada + "/lunch/-2-2",
+		ada + "/phones/13-16",
+		ada + "/phones/33-41",
+		ada + "/phones/9-12",
+		grace + "/lunch/36-37",
+	}
+	if got := schedule(srv); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("schedule %v, want %v", got, want)
+	}
+
+	// Reconciling again changes nothing.
+	plan, err = srv.Client().ReconcileActivities(context.Background(), req)
+	if err != nil || !plan.Empty() || plan.Applied {
+		t.Errorf("second run: %+v, %v", plan, err)
+	}
+}
+
+func TestReconcileActivitiesCanceled(t *testing.T) {
+	srv, ada, _, phones, _ := reconcileServer(t)
+	srv.AddActivity("", hours(ada, phones, 33, 41))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Canceled as soon as one day is listed, so nothing may be applied.
+	c := srv.Client(assembled.WithObserver(assembled.ObserverFunc(func(context.Context, *assembled.RequestRecord) {
+		cancel()
+	})))
+	_, err := c.ReconcileActivities(ctx, &assembled.ReconcileActivitiesRequest{
+		AgentIDs:  []string{ada},
+		StartTime: chunkStart,
+		EndTime:   chunkStart.Add(48 * time.Hour),
+		Desired:   []assembled.Activity{hours(ada, phones, 9, 17)},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	for _, r := range srv.Requests() {
+		if r.Method != "GET" {
+			t.Errorf("%s %s sent after cancellation", r.Method, r.Path)
+		}
+	}
+	if got := len(srv.Activities("")); got != 1 {
+		t.Errorf("%d activities, want 1", got)
+	}
+}
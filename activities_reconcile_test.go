@@ -0,0 +1,118 @@
+package assembled
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var planStart = time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+
+// act returns an activity from hour from to hour to of planStart.
+func act(id, agent, typ string, from, to int, desc string) Activity {
+	return Activity{
+		ID:          id,
+		AgentID:     agent,
+		TypeID:      typ,
+		StartTime:   planStart.Add(time.Duration(from) * time.Hour),
+		EndTime:     planStart.Add(time.Duration(to) * time.Hour),
+		Description: desc,
+	}
+}
+
+// describe lists activities as "id:agent/type/from-to/description".
+func describe(activities []Activity) []string {
+	var out []string
+	for _, a := range activities {
+		out = append(out, fmt.Sprintf("%s:%s/%s/%d-%d/%s", a.ID, a.AgentID, a.TypeID,
+			int(a.StartTime.Sub(planStart).Hours()), int(a.EndTime.Sub(planStart).Hours()), a.Description))
+	}
+	return out
+}
+
+func TestPlanActivities(t *testing.T) {
+	tests := []struct {
+		name              string
+		existing, desired []Activity
+		create, update    []string
+		delete, unchanged []string
+		skipped           []string
+	}{
+		{
+			name:      "no-op",
+			existing:  []Activity{act("a1", "ada", "phones", 9, 12, "calls"), act("a2", "ada", "lunch", 12, 13, "")},
+			desired:   []Activity{act("", "ada", "lunch", 12, 13, ""), act("", "ada", "phones", 9, 12, "calls")},
+			unchanged: []string{"a1:ada/phones/9-12/calls", "a2:ada/lunch/12-13/"},
+		},
+		{
+			name:     "move",
+			existing: []Activity{act("a1", "ada", "phones", 9, 12, "calls")},
+			desired:  []Activity{act("", "ada", "phones", 10, 13, "calls")},
+			update:   []string{"a1:ada/phones/10-13/calls"},
+		},
+		{
+			name:     "change type and description",
+			existing: []Activity{act("a1", "ada", "phones", 9, 12, "calls")},
+			desired:  []Activity{act("", "ada", "email", 9, 12, "tickets")},
+			update:   []string{"a1:ada/email/9-12/tickets"},
+		},
+		{
+			name:     "clear description",
+			existing: []Activity{act("a1", "ada", "phones", 9, 12, "calls")},
+			desired:  []Activity{act("", "ada", "phones", 9, 12, "")},
+			create:   []string{":ada/phones/9-12/"},
+			delete:   []string{"a1:ada/phones/9-12/calls"},
+		},
+		{
+			name:     "agent change",
+			existing: []Activity{act("a1", "ada", "phones", 9, 12, "")},
+			desired:  []Activity{act("", "grace", "phones", 9, 12, "")},
+			create:   []string{":grace/phones/9-12/"},
+			delete:   []string{"a1:ada/phones/9-12/"},
+		},
+		{
+			name:     "no overlap",
+			existing: []Activity{act("a1", "ada", "phones", 9, 10, "")},
+			desired:  []Activity{act("", "ada", "phones", 11, 12, "")},
+			create:   []string{":ada/phones/11-12/"},
+			delete:   []string{"a1:ada/phones/9-10/"},
+		},
+		{
+			name:     "each leftover reused once",
+			existing: []Activity{act("a1", "ada", "phones", 9, 12, "")},
+			desired:  []Activity{act("", "ada", "phones", 9, 10, ""), act("", "ada", "phones", 11, 12, "")},
+			create:   []string{":ada/phones/11-12/"},
+			update:   []string{"a1:ada/phones/9-10/"},
+		},
+		{
+			name:     "outside the window",
+			existing: []Activity{act("a1", "ada", "phones", 22, 26, "")},
+			skipped:  []string{"a1:ada/phones/22-26/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planActivities(planStart, planStart.Add(24*time.Hour), tt.existing, tt.desired)
+			got := map[string][]string{
+				"create":    describe(plan.Create),
+				"update":    describe(plan.Update),
+				"delete":    describe(plan.Delete),
+				"unchanged": describe(plan.Unchanged),
+				"skipped":   describe(plan.Skipped),
+			}
+			want := map[string][]string{
+				"create":    tt.create,
+				"update":    tt.update,
+				"delete":    tt.delete,
+				"unchanged": tt.unchanged,
+				"skipped":   tt.skipped,
+			}
+			for k := range want {
+				if !reflect.DeepEqual(got[k], want[k]) {
+					t.Errorf("%s = %q, want %q", k, got[k], want[k])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package assembled
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Special activity types in AdherenceRequest.Statuses, matching activity
+// types by category rather than by ID.
+const (
+	AdherenceProductive = "@productive" // Activity types with Productive set.
+	AdherenceTimeoff    = "@timeoff"    // Activity types with Timeoff set.
+)
+
+// AdherenceRequest holds the schedule and statuses of a set of agents over
+// a time window.
+type AdherenceRequest struct {
+	Start time.Time
+	End   time.Time
+
+	// Scheduled activities. Where activities of an agent overlap, the one
+	// starting last is expected.
+	Activities []Activity
+
+	// Activity types of the activities, by ID.
+	ActivityTypes map[string]ActivityType
+
+	// Status spans of the agents, matched to them by AgentID. A span
+	// without an EndTime lasts until the next span of the same agent and
+	// channel starts, or until End. Time without any status is treated as
+	// the status "".
+	Statuses []AgentStatus
+
+	// Activity types each upstream status adheres to, by status. Entries
+	// are activity type IDs, AdherenceProductive or AdherenceTimeoff.
+	// Unlisted statuses adhere to no activity. A status whose Channel is
+	// set only adheres to activity types whose Channels, if any, include
+	// it.
+	StatusTypes map[string][]string
+
+	// Agents whose teams are used to compute per-team results. Optional.
+	Agents []Agent
+
+	// Deviations shorter than Grace are not counted as out of adherence.
+	Grace time.Duration
+
+	// Deviations within TransitionGrace of the start or end of an
+	// activity, such as starting a shift a little late, are not counted.
+	TransitionGrace time.Duration
+}
+
+// AdherenceReport is the result of ComputeAdherence.
+type AdherenceReport struct {
+	Start time.Time
+	End   time.Time
+
+	Total  AdherenceStats
+	Agents map[string]*AdherenceStats // By agent ID.
+	Teams  map[string]*AdherenceStats // By team ID.
+
+	// Intervals in which agents were out of adherence, ordered by agent
+	// and start time.
+	Violations []AdherenceViolation
+}
+
+// AdherenceStats sums the time of one or more agents.
+type AdherenceStats struct {
+	Scheduled   time.Duration // Time covered by an activity.
+	InAdherence time.Duration // Scheduled time in a status adhering to it.
+
+	ScheduledProductive time.Duration // Time covered by a productive activity.
+	Worked              time.Duration // Time in a status adhering to AdherenceProductive.
+}
+
+// Adherence returns the percentage of scheduled time spent in adherence, or
+// 0 if nothing was scheduled.
+func (s *AdherenceStats) Adherence() float64 {
+	return percent(s.InAdherence, s.Scheduled)
+}
+
+// Conformance returns the time worked as a percentage of the productive
+// time scheduled, or 0 if nothing productive was scheduled. It exceeds 100
+// when agents worked more than scheduled.
+func (s *AdherenceStats) Conformance() float64 {
+	return percent(s.Worked, s.ScheduledProductive)
+}
+
+func (s *AdherenceStats) add(o *AdherenceStats) {
+	s.Scheduled += o.Scheduled
+	s.InAdherence += o.InAdherence
+	s.ScheduledProductive += o.ScheduledProductive
+	s.Worked += o.Worked
+}
+
+func percent(part, whole time.Duration) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(whole)
+}
+
+// AdherenceViolation is an interval in which an agent was out of adherence
+// with one activity.
+type AdherenceViolation struct {
+	AgentID    string
+	ActivityID string
+	TypeID     string
+	StartTime  time.Time
+	EndTime    time.Time
+
+	// Distinct statuses of the agent during the interval, sorted. The
+	// status "" stands for time without any status.
+	Statuses []string
+}
+
+// ComputeAdherence compares the statuses of agents with their schedule.
+//
+// At any point in time, an agent is in adherence if one of its statuses
+// adheres to the activity scheduled, according to r.StatusTypes, and out of
+// adherence otherwise. Time without an activity is not counted.
+func ComputeAdherence(r *AdherenceRequest) (*AdherenceReport, error) {
+	if r == nil || r.Start.IsZero() || !r.End.After(r.Start) {
+		return nil, errors.New("ComputeAdherence: Start and End must be set")
+	}
+	for _, a := range r.Activities {
+		if _, ok := r.ActivityTypes[a.TypeID]; !ok {
+			return nil, fmt.Errorf("ComputeAdherence: activity %s has unknown type %q", a.ID, a.TypeID)
+		}
+	}
+
+	activities := make(map[string][]Activity)
+	for _, a := range r.Activities {
+		if a.EndTime.After(r.Start) && a.StartTime.Before(r.End) && a.EndTime.After(a.StartTime) {
+			activities[a.AgentID] = append(activities[a.AgentID], a)
+		}
+	}
+	statuses := adherenceStatuses(r.Statuses, r.Start, r.End)
+
+	report := &AdherenceReport{
+		Start:  r.Start,
+		End:    r.End,
+		Agents: make(map[string]*AdherenceStats),
+		Teams:  make(map[string]*AdherenceStats),
+	}
+	var agentIDs []string
+	for id := range activities {
+		agentIDs = append(agentIDs, id)
+	}
+	for id := range statuses {
+		if _, ok := activities[id]; !ok {
+			agentIDs = append(agentIDs, id)
+		}
+	}
+	sort.Strings(agentIDs)
+	for _, id := range agentIDs {
+		stats, violations := agentAdherence(r, id, activities[id], statuses[id])
+		report.Agents[id] = stats
+		report.Total.add(stats)
+		report.Violations = append(report.Violations, violations...)
+	}
+
+	for _, a := range r.Agents {
+		stats, ok := report.Agents[a.ID]
+		if !ok {
+			continue
+		}
+		for _, team := range a.Teams {
+			if report.Teams[team] == nil {
+				report.Teams[team] = &AdherenceStats{}
+			}
+			report.Teams[team].add(stats)
+		}
+	}
+	return report, nil
+}
+
+// adherenceStatuses groups status spans by agent, ending open spans and
+// clipping them to the window.
+func adherenceStatuses(spans []AgentStatus, start, end time.Time) map[string][]AgentStatus {
+	byChannel := make(map[[2]string][]AgentStatus)
+	for _, s := range spans {
+		if s.AgentID == "" {
+			continue
+		}
+		k := [2]string{s.AgentID, s.Channel}
+		byChannel[k] = append(byChannel[k], s)
+	}
+	out := make(map[string][]AgentStatus)
+	for k, list := range byChannel {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].StartTime.Before(list[j].StartTime) })
+		for i, s := range list {
+			if s.EndTime.IsZero() {
+				s.EndTime = end
+				if i+1 < len(list) {
+					s.EndTime = list[i+1].StartTime
+				}
+			}
+			if s.StartTime.Before(start) {
+				s.StartTime = start
+			}
+			if s.EndTime.After(end) {
+				s.EndTime = end
+			}
+			if s.EndTime.After(s.StartTime) {
+				out[k[0]] = append(out[k[0]], s)
+			}
+		}
+	}
+	return out
+}
+
+// agentAdherence computes the adherence of one agent by sweeping the window
+// from one boundary of its activities, statuses and grace periods to the
+// next, keeping track of the activities and statuses in progress.
+func agentAdherence(r *AdherenceRequest, agentID string, activities []Activity, statuses []AgentStatus) (*AdherenceStats, []AdherenceViolation) {
+	points := []time.Time{r.Start, r.End}
+	for _, a := range activities {
+		points = append(points, a.StartTime, a.EndTime)
+		if r.TransitionGrace > 0 && a.EndTime.Sub(a.StartTime) > 2*r.TransitionGrace {
+			points = append(points, a.StartTime.Add(r.TransitionGrace), a.EndTime.Add(-r.TransitionGrace))
+		}
+	}
+	for _, s := range statuses {
+		points = append(points, s.StartTime, s.EndTime)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Before(points[j]) })
+
+	inActivity := newIntervalSweep(len(activities), func(i int) (time.Time, time.Time) {
+		return activities[i].StartTime, activities[i].EndTime
+	})
+	inStatus := newIntervalSweep(len(statuses), func(i int) (time.Time, time.Time) {
+		return statuses[i].StartTime, statuses[i].EndTime
+	})
+
+	stats := &AdherenceStats{}
+	var (
+		violations []AdherenceViolation
+		cur        *AdherenceViolation
+		seen       map[string]bool
+	)
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		if cur.EndTime.Sub(cur.StartTime) < r.Grace {
+			stats.InAdherence += cur.EndTime.Sub(cur.StartTime)
+		} else {
+			for s := range seen {
+				cur.Statuses = append(cur.Statuses, s)
+			}
+			sort.Strings(cur.Statuses)
+			violations = append(violations, *cur)
+		}
+		cur = nil
+	}
+
+	var current []AgentStatus
+	for i := 0; i+1 < len(points); i++ {
+		from, to := points[i], points[i+1]
+		if !to.After(from) || from.Before(r.Start) || to.After(r.End) {
+			continue
+		}
+		d := to.Sub(from)
+		inActivity.advance(from)
+		inStatus.advance(from)
+		current = current[:0]
+		for _, j := range inStatus.active {
+			current = append(current, statuses[j])
+		}
+		if len(current) == 0 {
+			current = append(current, AgentStatus{AgentID: agentID})
+		}
+		for _, s := range current {
+			if r.adheresToCategory(s, AdherenceProductive) {
+				stats.Worked += d
+				break
+			}
+		}
+
+		a, ok := scheduledActivity(activities, inActivity.active)
+		if !ok {
+			flush()
+			continue
+		}
+		t := r.ActivityTypes[a.TypeID]
+		stats.Scheduled += d
+		if t.Productive {
+			stats.ScheduledProductive += d
+		}
+		adherent := false
+		for _, s := range current {
+			if r.adheres(s, a.TypeID, t) {
+				adherent = true
+				break
+			}
+		}
+		graced := r.TransitionGrace > 0 &&
+			(from.Before(a.StartTime.Add(r.TransitionGrace)) || to.After(a.EndTime.Add(-r.TransitionGrace)))
+		if adherent || graced {
+			flush()
+			stats.InAdherence += d
+			continue
+		}
+		if cur != nil && (cur.ActivityID != a.ID || !cur.EndTime.Equal(from)) {
+			flush()
+		}
+		if cur == nil {
+			cur = &AdherenceViolation{AgentID: agentID, ActivityID: a.ID, TypeID: a.TypeID, StartTime: from}
+			seen = make(map[string]bool)
+		}
+		cur.EndTime = to
+		for _, s := range current {
+			seen[s.Status] = true
+		}
+	}
+	flush()
+	return stats, violations
+}
+
+// intervalSweep tracks which of a set of intervals are in progress as time
+// moves forward.
+type intervalSweep struct {
+	starts, ends       []time.Time
+	byStart, byEnd     []int // Indices of the intervals, by start and by end.
+	nextStart, nextEnd int
+
+	active []int // Indices of the intervals in progress, in no order.
+}
+
+func newIntervalSweep(n int, interval func(i int) (start, end time.Time)) *intervalSweep {
+	s := &intervalSweep{
+		starts:  make([]time.Time, n),
+		ends:    make([]time.Time, n),
+		byStart: make([]int, n),
+		byEnd:   make([]int, n),
+	}
+	for i := 0; i < n; i++ {
+		s.starts[i], s.ends[i] = interval(i)
+		s.byStart[i], s.byEnd[i] = i, i
+	}
+	sort.Slice(s.byStart, func(i, j int) bool { return s.starts[s.byStart[i]].Before(s.starts[s.byStart[j]]) })
+	sort.Slice(s.byEnd, func(i, j int) bool { return s.ends[s.byEnd[i]].Before(s.ends[s.byEnd[j]]) })
+	return s
+}
+
+// advance moves to t, which must not be before the previous time, so that
+// the active intervals are those covering t: starting at or before it and
+// ending after it.
+func (s *intervalSweep) advance(t time.Time) {
+	for ; s.nextStart < len(s.byStart) && !s.starts[s.byStart[s.nextStart]].After(t); s.nextStart++ {
+		s.active = append(s.active, s.byStart[s.nextStart])
+	}
+	for ; s.nextEnd < len(s.byEnd) && !s.ends[s.byEnd[s.nextEnd]].After(t); s.nextEnd++ {
+		ended := s.byEnd[s.nextEnd]
+		for i, j := range s.active {
+			if j == ended {
+				s.active[i] = s.active[len(s.active)-1]
+				s.active = s.active[:len(s.active)-1]
+				break
+			}
+		}
+	}
+}
+
+// scheduledActivity returns the activity expected among those in progress,
+// given by index: the one starting last.
+func scheduledActivity(activities []Activity, active []int) (Activity, bool) {
+	var (
+		best  Activity
+		found bool
+	)
+	for _, i := range active {
+		a := activities[i]
+		if !found || a.StartTime.After(best.StartTime) || (a.StartTime.Equal(best.StartTime) && a.ID > best.ID) {
+			best, found = a, true
+		}
+	}
+	return best, found
+}
+
+// adheres reports whether status s adheres to the activity type t, whose ID
+// is typeID. The ID is passed separately since t.ID is often left empty in
+// r.ActivityTypes.
+func (r *AdherenceRequest) adheres(s AgentStatus, typeID string, t ActivityType) bool {
+	if s.Channel != "" && len(t.Channels) > 0 && !containsString(t.Channels, s.Channel) {
+		return false
+	}
+	for _, typ := range r.StatusTypes[s.Status] {
+		switch {
+		case typ == typeID,
+			typ == AdherenceProductive && t.Productive,
+			typ == AdherenceTimeoff && t.Timeoff:
+			return true
+		}
+	}
+	return false
+}
+
+// adheresToCategory reports whether status s is mapped to the given
+// category.
+func (r *AdherenceRequest) adheresToCategory(s AgentStatus, category string) bool {
+	return containsString(r.StatusTypes[s.Status], category)
+}
@@ -0,0 +1,196 @@
+package assembled_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+var adherenceStart = time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC)
+
+// minute returns the time m minutes after 09:00.
+func minute(m int) time.Time {
+	return adherenceStart.Add(time.Duration(m) * time.Minute)
+}
+
+func activity(id, agentID, typeID string, from, to int) assembled.Activity {
+	return assembled.Activity{ID: id, AgentID: agentID, TypeID: typeID, StartTime: minute(from), EndTime: minute(to)}
+}
+
+func agentStatus(agentID, channel, status string, from, to int) assembled.AgentStatus {
+	s := assembled.AgentStatus{AgentID: agentID, Channel: channel, Status: status, StartTime: minute(from)}
+	if to >= 0 {
+		s.EndTime = minute(to)
+	}
+	return s
+}
+
+// adherenceRequest returns a request from 09:00 to 11:00 with phones, a
+// productive activity type on the phone channel, and lunch.
+func adherenceRequest(activities []assembled.Activity, statuses []assembled.AgentStatus) *assembled.AdherenceRequest {
+	return &assembled.AdherenceRequest{
+		Start:      minute(0),
+		End:        minute(120),
+		Activities: activities,
+		ActivityTypes: map[string]assembled.ActivityType{
+			"phones": {ID: "phones", Productive: true, Channels: []string{"phone"}},
+			"lunch":  {ID: "lunch"},
+		},
+		Statuses: statuses,
+		StatusTypes: map[string][]string{
+			"ready": {assembled.AdherenceProductive},
+			"lunch": {"lunch"},
+		},
+	}
+}
+
+// violationString formats violations as "activity 09:00-09:30 [statuses]",
+// separated by commas.
+func violationString(violations []assembled.AdherenceViolation) string {
+	var out []string
+	for _, v := range violations {
+		out = append(out, fmt.Sprintf("%s %s-%s %q", v.ActivityID,
+			v.StartTime.Format("15:04"), v.EndTime.Format("15:04"), v.Statuses))
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestComputeAdherence(t *testing.T) {
+	phones := []assembled.Activity{activity("p", "a1", "phones", 0, 60)}
+	tests := []struct {
+		name       string
+		req        *assembled.AdherenceRequest
+		inAdh      int // Minutes in adherence of a1.
+		scheduled  int
+		worked     int
+		violations string
+	}{{
+		name: "short break",
+		req: adherenceRequest(phones, []assembled.AgentStatus{
+			agentStatus("a1", "phone", "ready", 0, 30), agentStatus("a1", "phone", "away", 30, 32), agentStatus("a1", "phone", "ready", 32, 60),
+		}),
+		inAdh: 58, scheduled: 60, worked: 58,
+		violations: `p 09:30-09:32 ["away"]`,
+	}, {
+		name: "short break within grace",
+		req: func() *assembled.AdherenceRequest {
+			r := adherenceRequest(phones, []assembled.AgentStatus{
+				agentStatus("a1", "phone", "ready", 0, 30), agentStatus("a1", "phone", "away", 30, 32), agentStatus("a1", "phone", "ready", 32, 60),
+			})
+			r.Grace = 5 * time.Minute
+			return r
+		}(),
+		inAdh: 60, scheduled: 60, worked: 58,
+	}, {
+		name: "late start",
+		req: adherenceRequest(phones, []assembled.AgentStatus{
+			agentStatus("a1", "", "ready", 4, -1),
+		}),
+		inAdh: 56, scheduled: 60, worked: 116,
+		violations: `p 09:00-09:04 [""]`,
+	}, {
+		name: "late start within transition grace",
+		req: func() *assembled.AdherenceRequest {
+			r := adherenceRequest(phones, []assembled.AgentStatus{agentStatus("a1", "", "ready", 4, -1)})
+			r.TransitionGrace = 5 * time.Minute
+			return r
+		}(),
+		inAdh: 60, scheduled: 60, worked: 116,
+	}, {
+		name: "overlapping activities",
+		req: adherenceRequest([]assembled.Activity{
+			activity("p", "a1", "phones", 0, 120), activity("l", "a1", "lunch", 60, 90),
+		}, []assembled.AgentStatus{
+			agentStatus("a1", "phone", "ready", 0, 70), agentStatus("a1", "phone", "lunch", 70, 100), agentStatus("a1", "phone", "ready", 100, -1),
+		}),
+		inAdh: 100, scheduled: 120, worked: 90,
+		violations: `l 10:00-10:10 ["ready"], p 10:30-10:40 ["lunch"]`,
+	}, {
+		name: "channel restrictions",
+		req: adherenceRequest(phones, []assembled.AgentStatus{
+			agentStatus("a1", "chat", "ready", 0, 30), agentStatus("a1", "phone", "ready", 20, 60),
+		}),
+		inAdh: 40, scheduled: 60, worked: 60,
+		violations: `p 09:00-09:20 ["ready"]`,
+	}, {
+		name: "activity type without ID",
+		req: func() *assembled.AdherenceRequest {
+			r := adherenceRequest([]assembled.Activity{activity("l", "a1", "lunch", 0, 60)}, []assembled.AgentStatus{
+				agentStatus("a1", "phone", "lunch", 0, 60),
+			})
+			r.ActivityTypes["lunch"] = assembled.ActivityType{}
+			return r
+		}(),
+		inAdh: 60, scheduled: 60, worked: 0,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := assembled.ComputeAdherence(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := report.Agents["a1"]
+			if s == nil {
+				t.Fatalf("no stats for a1: %+v", report.Agents)
+			}
+			got := fmt.Sprintf("%v in adherence, %v scheduled, %v worked", s.InAdherence, s.Scheduled, s.Worked)
+			want := fmt.Sprintf("%v in adherence, %v scheduled, %v worked",
+				time.Duration(tt.inAdh)*time.Minute, time.Duration(tt.scheduled)*time.Minute, time.Duration(tt.worked)*time.Minute)
+			if got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+			if got := violationString(report.Violations); got != tt.violations {
+				t.Errorf("violations %s, want %s", got, tt.violations)
+			}
+		})
+	}
+}
+
+func TestComputeAdherenceTeams(t *testing.T) {
+	r := adherenceRequest([]assembled.Activity{
+		activity("p1", "a1", "phones", 0, 60),
+		activity("p2", "a2", "phones", 0, 120),
+	}, []assembled.AgentStatus{
+		agentStatus("a1", "phone", "ready", 0, 30),
+		agentStatus("a2", "phone", "ready", 0, 120),
+		agentStatus("a3", "phone", "ready", 0, 120), // Nothing scheduled.
+	})
+	r.Agents = []assembled.Agent{
+		{ID: "a1", Teams: []string{"t1"}},
+		{ID: "a2", Teams: []string{"t1", "t2"}},
+		{ID: "a3", Teams: []string{"t3"}},
+		{ID: "a4", Teams: []string{"t4"}}, // No activities or statuses.
+	}
+	report, err := assembled.ComputeAdherence(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		stats                  *assembled.AdherenceStats
+		name                   string
+		adherence, conformance float64
+	}{
+		{&report.Total, "total", 150.0 / 180 * 100, 270.0 / 180 * 100},
+		{report.Teams["t1"], "t1", 150.0 / 180 * 100, 150.0 / 180 * 100},
+		{report.Teams["t2"], "t2", 100, 100},
+		{report.Teams["t3"], "t3", 0, 0},
+	}
+	for _, tt := range tests {
+		if tt.stats == nil {
+			t.Errorf("%s: no stats", tt.name)
+			continue
+		}
+		if a, c := tt.stats.Adherence(), tt.stats.Conformance(); fmt.Sprintf("%.3f %.3f", a, c) != fmt.Sprintf("%.3f %.3f", tt.adherence, tt.conformance) {
+			t.Errorf("%s: adherence %.3f, conformance %.3f, want %.3f, %.3f", tt.name, a, c, tt.adherence, tt.conformance)
+		}
+	}
+	if report.Teams["t3"].Worked != 2*time.Hour {
+		t.Errorf("t3 worked %v, want 2h", report.Teams["t3"].Worked)
+	}
+	if _, ok := report.Teams["t4"]; ok {
+		t.Error("stats for t4, whose agent has neither activities nor statuses")
+	}
+}
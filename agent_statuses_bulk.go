@@ -0,0 +1,128 @@
+package assembled
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// GetAgentStatusesRequest selects the agents whose statuses are fetched by
+// GetAgentStatuses.
+type GetAgentStatusesRequest struct {
+	// Agents to look up. Duplicates are looked up once.
+	IDs []string
+
+	// If set, agents are first listed with ListAgents using this request,
+	// and only those listed are looked up: all of them if IDs is empty, and
+	// those also in IDs otherwise. Use an empty request to look up every
+	// agent.
+	Scope *ListAgentsRequest
+
+	// Maximum number of statuses fetched at once. Defaults to 8.
+	Concurrency int
+
+	// RateLimiter, if set, is waited on before each lookup, on top of the
+	// client's own limiter, for example to leave room for other requests.
+	RateLimiter Limiter
+}
+
+// GetAgentStatusesResponse holds the statuses found by GetAgentStatuses.
+// Every agent looked up appears in exactly one of the two maps. Agents not
+// looked up because ctx was done first appear in neither.
+type GetAgentStatusesResponse struct {
+	Statuses map[string]AgentStatus // By agent ID.
+
+	// Errors of the lookups that failed, by agent ID. Agents without a
+	// status fail with an error matching ErrNotFound.
+	Errors map[string]error
+}
+
+// GetAgentStatuses fetches the current statuses of many agents, one
+// GetAgentStatus request per agent, several at a time.
+//
+// Failed lookups are reported per agent in the response rather than as an
+// error. An error is only returned if the agents could not be listed, or if
+// ctx is done before all statuses are fetched, in which case the statuses
+// fetched so far are returned along with it.
+func (c *Client) GetAgentStatuses(ctx context.Context, r *GetAgentStatusesRequest) (*GetAgentStatusesResponse, error) {
+	var req GetAgentStatusesRequest
+	if r != nil {
+		req = *r
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = 8
+	}
+
+	ids := make(map[string]bool)
+	for _, id := range req.IDs {
+		ids[id] = true
+	}
+	if req.Scope != nil {
+		agents, err := c.ListAgents(ctx, req.Scope)
+		if err != nil {
+			return nil, fmt.Errorf("GetAgentStatuses: %w", err)
+		}
+		scoped := make(map[string]bool)
+		for id := range agents.Agents {
+			if len(req.IDs) == 0 || ids[id] {
+				scoped[id] = true
+			}
+		}
+		ids = scoped
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	resp := &GetAgentStatusesResponse{
+		Statuses: make(map[string]AgentStatus),
+		Errors:   make(map[string]error),
+	}
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, req.Concurrency)
+	)
+	for _, id := range sorted {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var (
+				status *AgentStatus
+				err    error
+			)
+			if req.RateLimiter != nil {
+				err = req.RateLimiter.Wait(ctx)
+			}
+			if err == nil {
+				status, err = c.GetAgentStatus(ctx, &GetAgentStatusRequest{ID: id})
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				resp.Errors[id] = err
+			} else {
+				resp.Statuses[id] = *status
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return resp, fmt.Errorf("GetAgentStatuses: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,151 @@
+package assembled_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+// statusesServer returns a server with agents Ada and Grace in team Tier 1
+// and Linus in Tier 2. Ada and Linus have a status, Grace has none.
+func statusesServer(t *testing.T) (srv *assembledtest.Server, ada, grace, linus string) {
+	t.Helper()
+	srv = assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	tier1 := srv.AddFilter("teams", assembled.Filter{Name: "Tier 1"}).ID
+	tier2 := srv.AddFilter("teams", assembled.Filter{Name: "Tier 2"}).ID
+	ada = srv.AddAgent(assembled.Agent{Name: "Ada", Teams: []string{tier1}}).ID
+	grace = srv.AddAgent(assembled.Agent{Name: "Grace", Teams: []string{tier1}}).ID
+	linus = srv.AddAgent(assembled.Agent{Name: "Linus", Teams: []string{tier2}}).ID
+	for _, id := range []string{ada, linus} {
+		if _, err := srv.Client().CreateAgentStatus(context.Background(), status(id, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return srv, ada, grace, linus
+}
+
+// keys returns the sorted keys of the statuses and errors of resp.
+func keys(resp *assembled.GetAgentStatusesResponse) (statuses, errs []string) {
+	statuses, errs = []string{}, []string{}
+	for id := range resp.Statuses {
+		statuses = append(statuses, id)
+	}
+	for id := range resp.Errors {
+		errs = append(errs, id)
+	}
+	sort.Strings(statuses)
+	sort.Strings(errs)
+	return statuses, errs
+}
+
+func TestGetAgentStatuses(t *testing.T) {
+	srv, ada, grace, linus := statusesServer(t)
+	tests := []struct {
+		name           string
+		req            *assembled.GetAgentStatusesRequest
+		statuses, errs []string
+	}{{
+		name:     "ids",
+		req:      &assembled.GetAgentStatusesRequest{IDs: []string{ada, grace}},
+		statuses: []string{ada},
+		errs:     []string{grace},
+	}, {
+		name:     "team",
+		req:      &assembled.GetAgentStatusesRequest{Scope: &assembled.ListAgentsRequest{Team: "Tier 1"}},
+		statuses: []string{ada},
+		errs:     []string{grace},
+	}, {
+		name:     "ids in team",
+		req:      &assembled.GetAgentStatusesRequest{IDs: []string{ada, linus}, Scope: &assembled.ListAgentsRequest{Team: "Tier 1"}},
+		statuses: []string{ada},
+		errs:     []string{},
+	}, {
+		name:     "every agent",
+		req:      &assembled.GetAgentStatusesRequest{Scope: &assembled.ListAgentsRequest{}},
+		statuses: []string{ada, linus},
+		errs:     []string{grace},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := srv.Client().GetAgentStatuses(context.Background(), tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			statuses, errs := keys(resp)
+			sort.Strings(tt.statuses)
+			if fmt.Sprint(statuses) != fmt.Sprint(tt.statuses) || fmt.Sprint(errs) != fmt.Sprint(tt.errs) {
+				t.Errorf("statuses of %v, errors for %v, want %v and %v", statuses, errs, tt.statuses, tt.errs)
+			}
+			for id, err := range resp.Errors {
+				if !errors.Is(err, assembled.ErrNotFound) {
+					t.Errorf("agent %s: err = %v, want ErrNotFound", id, err)
+				}
+			}
+			if s := resp.Statuses[ada]; s.Status != "s0" {
+				t.Errorf("status of Ada = %+v", s)
+			}
+		})
+	}
+}
+
+func TestGetAgentStatusesDedupe(t *testing.T) {
+	srv, ada, _, linus := statusesServer(t)
+	n := len(srv.Requests())
+	resp, err := srv.Client().GetAgentStatuses(context.Background(), &assembled.GetAgentStatusesRequest{
+		IDs: []string{ada, linus, ada, ada},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Statuses) != 2 {
+		t.Errorf("statuses = %+v", resp.Statuses)
+	}
+	if got := len(srv.Requests()) - n; got != 2 {
+		t.Errorf("%d requests, want 2", got)
+	}
+}
+
+func TestGetAgentStatusesPartialFailure(t *testing.T) {
+	srv, ada, _, linus := statusesServer(t)
+	srv.InjectFault(assembledtest.Fault{Method: "GET", PathPrefix: "/v0/agents/" + linus, StatusCode: 500})
+	resp, err := srv.Client(assembled.WithRetryPolicy(nil)).GetAgentStatuses(context.Background(), &assembled.GetAgentStatusesRequest{
+		IDs: []string{ada, linus},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, errs := keys(resp)
+	if fmt.Sprint(statuses) != fmt.Sprint([]string{ada}) || fmt.Sprint(errs) != fmt.Sprint([]string{linus}) {
+		t.Errorf("statuses of %v, errors for %v", statuses, errs)
+	}
+	var apiErr *assembled.Error
+	if !errors.As(resp.Errors[linus], &apiErr) || apiErr.StatusCode != 500 {
+		t.Errorf("error for Linus = %v, want a 500", resp.Errors[linus])
+	}
+}
+
+func TestGetAgentStatusesCanceled(t *testing.T) {
+	srv, ada, grace, linus := statusesServer(t)
+	srv.SetLatency(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	resp, err := srv.Client().GetAgentStatuses(ctx, &assembled.GetAgentStatusesRequest{
+		IDs:         []string{ada, grace, linus},
+		Concurrency: 1,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+	// Only the first lookup was started; the others are in neither map.
+	statuses, errs := keys(resp)
+	if len(statuses) != 0 || len(errs) != 1 {
+		t.Errorf("statuses of %v, errors for %v, want one error", statuses, errs)
+	}
+}
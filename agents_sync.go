@@ -0,0 +1,342 @@
+package assembled
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Fields of an agent managed by SyncAgents.
+var agentSyncFields = []AgentField{
+	AgentFieldName, AgentFieldEmail, AgentFieldChannels, AgentFieldQueues,
+	AgentFieldSite, AgentFieldSkills, AgentFieldTeams,
+}
+
+// SyncAgentsRequest describes the roster of agents that should exist, keyed
+// by ImportID, for example as exported from an HR system.
+type SyncAgentsRequest struct {
+	// Agents that should exist. Each must have a unique ImportID; their IDs
+	// are ignored.
+	Desired []Agent
+
+	// Fields managed by the roster: any AgentField but AgentFieldImportID.
+	// Other fields of existing agents are left alone, while those listed are
+	// cleared when blank in the roster.
+	//
+	// Defaults to all of them, but then blank values in the roster leave
+	// existing values unchanged, since rosters often omit what they do not
+	// know. List the fields explicitly for blank values to clear them.
+	Fields []AgentField
+
+	// Called for each agent in Assembled that is not in the roster, when
+	// the plan is applied. The API cannot delete agents, so what removing
+	// one means, such as clearing its teams and queues, is up to the
+	// caller. If nil, such agents are only reported.
+	RemoveMissing func(ctx context.Context, a Agent) error
+
+	// If true, the plan is computed but not applied.
+	DryRun bool
+}
+
+// AgentPlan lists the changes needed to make the agents in Assembled match a
+// roster.
+type AgentPlan struct {
+	Create []AgentChange
+	Update []AgentChange
+
+	// Existing agents already matching the roster.
+	Unchanged []Agent
+
+	// Existing agents absent from the roster, including those without an
+	// ImportID. They are passed to RemoveMissing if set.
+	Missing []Agent
+
+	// Whether the plan was sent to the API.
+	Applied bool
+}
+
+// AgentChange is the creation or update of a single agent.
+type AgentChange struct {
+	Agent  Agent        // The agent as desired, with the ID of the existing one for updates.
+	Before *Agent       // The existing agent, or nil for creations.
+	Fields []AgentField // Fields that differ.
+
+	// Error returned for the change when the plan was applied.
+	Err error
+}
+
+// Empty reports whether the plan makes no changes.
+func (p *AgentPlan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0
+}
+
+// Failed returns the changes that could not be applied.
+func (p *AgentPlan) Failed() []AgentChange {
+	var failed []AgentChange
+	for _, changes := range [][]AgentChange{p.Create, p.Update} {
+		for _, ch := range changes {
+			if ch.Err != nil {
+				failed = append(failed, ch)
+			}
+		}
+	}
+	return failed
+}
+
+// ByImportID returns the agents of the response keyed by ImportID. Agents
+// without one are left out. If several agents share an ImportID, the one
+// with the smallest ID is kept.
+func (r *ListAgentsResponse) ByImportID() map[string]Agent {
+	index, _ := indexAgents(r.Agents)
+	return index
+}
+
+// indexAgents keys agents by ImportID, also returning the ImportIDs shared
+// by several agents.
+func indexAgents(agents map[string]Agent) (map[string]Agent, []string) {
+	index := make(map[string]Agent, len(agents))
+	shared := make(map[string]bool)
+	for id, a := range agents {
+		if a.ImportID == "" {
+			continue
+		}
+		a.ID = id
+		if other, ok := index[a.ImportID]; ok {
+			shared[a.ImportID] = true
+			if other.ID < id {
+				continue
+			}
+		}
+		index[a.ImportID] = a
+	}
+	var dups []string
+	for importID := range shared {
+		dups = append(dups, importID)
+	}
+	sort.Strings(dups)
+	return index, dups
+}
+
+// SyncAgents compares the roster of r against the agents in Assembled and
+// applies the difference, unless r.DryRun is set: agents whose ImportID is
+// new are created, and existing agents are updated with only the fields
+// that differ. Lists such as teams are compared regardless of order.
+//
+// Every change is attempted; the errors of those that fail are recorded in
+// the plan, and the first one is returned.
+func (c *Client) SyncAgents(ctx context.Context, r *SyncAgentsRequest) (*AgentPlan, error) {
+	fields, keepBlank := r.Fields, false
+	if len(fields) == 0 {
+		fields, keepBlank = agentSyncFields, true
+	}
+	for _, f := range fields {
+		if !containsAgentField(agentSyncFields, f) {
+			return nil, fmt.Errorf("SyncAgents: unknown field %q", f)
+		}
+	}
+	seen := make(map[string]bool, len(r.Desired))
+	for i, a := range r.Desired {
+		if a.ImportID == "" {
+			return nil, fmt.Errorf("SyncAgents: desired agent %d has no ImportID", i)
+		}
+		if seen[a.ImportID] {
+			return nil, fmt.Errorf("SyncAgents: several desired agents with ImportID %q", a.ImportID)
+		}
+		seen[a.ImportID] = true
+	}
+
+	resp, err := c.ListAgents(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("SyncAgents: %w", err)
+	}
+	index, dups := indexAgents(resp.Agents)
+	for _, importID := range dups {
+		if seen[importID] {
+			return nil, fmt.Errorf("SyncAgents: several agents in Assembled with ImportID %q", importID)
+		}
+	}
+
+	plan := planAgents(r.Desired, resp.Agents, index, fields, keepBlank)
+	if r.DryRun || plan.Empty() && (r.RemoveMissing == nil || len(plan.Missing) == 0) {
+		return plan, nil
+	}
+
+	var first error
+	for i := range plan.Create {
+		ch := &plan.Create[i]
+		a := ch.Agent
+		created, err := c.CreateAgent(ctx, &CreateAgentRequest{
+			ImportID: a.ImportID,
+			Channels: a.Channels,
+			Email:    a.Email,
+			Name:     a.Name,
+			Queues:   a.Queues,
+			Site:     a.Site,
+			Skills:   a.Skills,
+			Teams:    a.Teams,
+		})
+		if err != nil {
+			ch.Err = err
+		} else {
+			ch.Agent = *created
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	for i := range plan.Update {
+		ch := &plan.Update[i]
+		a := ch.Agent
+		updated, err := c.UpdateAgentFields(ctx, &UpdateAgentRequest{
+			ID:       a.ID,
+			Channels: a.Channels,
+			Email:    a.Email,
+			Name:     a.Name,
+			Queues:   a.Queues,
+			Site:     a.Site,
+			Skills:   a.Skills,
+			Teams:    a.Teams,
+		}, ch.Fields...)
+		if err != nil {
+			ch.Err = err
+		} else {
+			ch.Agent = *updated
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	if r.RemoveMissing != nil {
+		for _, a := range plan.Missing {
+			if err := r.RemoveMissing(ctx, a); err != nil && first == nil {
+				first = fmt.Errorf("removing agent %s: %w", a.ID, err)
+			}
+		}
+	}
+	plan.Applied = true
+	if first != nil {
+		return plan, fmt.Errorf("SyncAgents: %w", first)
+	}
+	return plan, nil
+}
+
+// planAgents computes the changes turning existing, indexed by ImportID,
+// into desired, considering only the given fields, and skipping those blank
+// in desired if keepBlank is set.
+func planAgents(desired []Agent, existing, index map[string]Agent, fields []AgentField, keepBlank bool) *AgentPlan {
+	plan := &AgentPlan{}
+	matched := make(map[string]bool, len(desired))
+	for _, d := range desired {
+		d.ID = ""
+		before, ok := index[d.ImportID]
+		if !ok {
+			plan.Create = append(plan.Create, AgentChange{Agent: d, Fields: fields})
+			continue
+		}
+		matched[before.ID] = true
+		d.ID = before.ID
+		var changed []AgentField
+		for _, f := range fields {
+			if keepBlank && agentFieldBlank(f, d) {
+				continue
+			}
+			if !agentFieldEqual(f, before, d) {
+				changed = append(changed, f)
+			}
+		}
+		if len(changed) == 0 {
+			plan.Unchanged = append(plan.Unchanged, before)
+			continue
+		}
+		b := before
+		plan.Update = append(plan.Update, AgentChange{Agent: d, Before: &b, Fields: changed})
+	}
+	for id, a := range existing {
+		if !matched[id] {
+			a.ID = id
+			plan.Missing = append(plan.Missing, a)
+		}
+	}
+
+	sort.Slice(plan.Create, func(i, j int) bool { return plan.Create[i].Agent.ImportID < plan.Create[j].Agent.ImportID })
+	sort.Slice(plan.Update, func(i, j int) bool { return plan.Update[i].Agent.ImportID < plan.Update[j].Agent.ImportID })
+	sort.Slice(plan.Unchanged, func(i, j int) bool { return plan.Unchanged[i].ImportID < plan.Unchanged[j].ImportID })
+	sort.Slice(plan.Missing, func(i, j int) bool { return plan.Missing[i].ID < plan.Missing[j].ID })
+	return plan
+}
+
+func agentFieldEqual(field AgentField, a, b Agent) bool {
+	switch field {
+	case AgentFieldName:
+		return a.Name == b.Name
+	case AgentFieldEmail:
+		return a.Email == b.Email
+	case AgentFieldChannels:
+		return sameSet(a.Channels, b.Channels)
+	case AgentFieldQueues:
+		return sameSet(a.Queues, b.Queues)
+	case AgentFieldSite:
+		return a.Site == b.Site
+	case AgentFieldSkills:
+		return sameSet(a.Skills, b.Skills)
+	case AgentFieldTeams:
+		return sameSet(a.Teams, b.Teams)
+	}
+	return true
+}
+
+func agentFieldBlank(field AgentField, a Agent) bool {
+	switch field {
+	case AgentFieldName:
+		return a.Name == ""
+	case AgentFieldEmail:
+		return a.Email == ""
+	case AgentFieldChannels:
+		return len(a.Channels) == 0
+	case AgentFieldQueues:
+		return len(a.Queues) == 0
+	case AgentFieldSite:
+		return a.Site == ""
+	case AgentFieldSkills:
+		return len(a.Skills) == 0
+	case AgentFieldTeams:
+		return len(a.Teams) == 0
+	}
+	return false
+}
+
+// sameSet reports whether a and b hold the same strings, ignoring order and
+// repetitions.
+func sameSet(a, b []string) bool {
+	set := make(map[string]bool, len(a))
+	for _, s := range a {
+		set[s] = true
+	}
+	for _, s := range b {
+		if !set[s] {
+			return false
+		}
+	}
+	for _, s := range b {
+		delete(set, s)
+	}
+	return len(set) == 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAgentField(list []AgentField, f AgentField) bool {
+	for _, v := range list {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package assembled_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+// rosterServer returns a server with teams t1 and t2, and agents e1, in t1
+// with an email, and e2, without ImportID.
+func rosterServer(t *testing.T) (srv *assembledtest.Server, t1, t2, e1, e2 string) {
+	t.Helper()
+	srv = assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	t1 = addTeam(srv, "Tier 1", "")
+	t2 = addTeam(srv, "Tier 2", "")
+	e1 = srv.AddAgent(assembled.Agent{ImportID: "e1", Name: "Ada", Email: "ada@example.com", Teams: []string{t1}}).ID
+	e2 = srv.AddAgent(assembled.Agent{Name: "Grace"}).ID
+	return srv, t1, t2, e1, e2
+}
+
+// patchedFields returns the fields sent by each PATCH request since the
+// n-th, as "path: field,field".
+func patchedFields(srv *assembledtest.Server, n int) []string {
+	var out []string
+	for _, r := range writes(srv, n) {
+		if r.Method != "PATCH" {
+			continue
+		}
+		var body map[string]json.RawMessage
+		json.Unmarshal(r.Body, &body)
+		var keys []string
+		for k := range body {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out = append(out, r.Path+": "+strings.Join(keys, ","))
+	}
+	return out
+}
+
+func TestSyncAgents(t *testing.T) {
+	srv, t1, t2, e1, e2 := rosterServer(t)
+	n := len(srv.Requests())
+	var removed []string
+	plan, err := srv.Client().SyncAgents(context.Background(), &assembled.SyncAgentsRequest{
+		Desired: []assembled.Agent{
+			// The email is left out, and kept.
+			{ImportID: "e1", Name: "Ada", Teams: []string{t2, t1}, Channels: []string{"phone"}},
+			{ImportID: "e3", Name: "Linus", Teams: []string{t2}},
+		},
+		RemoveMissing: func(ctx context.Context, a assembled.Agent) error {
+			removed = append(removed, a.ID)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Create) != 1 || len(plan.Update) != 1 || len(plan.Missing) != 1 || !plan.Applied {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if got := plan.Update[0].Fields; fmt.Sprint(got) != "[channels teams]" {
+		t.Errorf("fields changed %v, want [channels teams]", got)
+	}
+	if got, want := patchedFields(srv, n), []string{"/v0/agents/" + e1 + ": channels,teams"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("updates %v, want %v", got, want)
+	}
+	if a, _ := srv.Agent(e1); a.Email != "ada@example.com" || len(a.Teams) != 2 {
+		t.Errorf("e1 = %+v", a)
+	}
+	if id := plan.Create[0].Agent.ID; id == "" {
+		t.Error("created agent without an ID in the plan")
+	} else if a, _ := srv.Agent(id); a.ImportID != "e3" || a.Name != "Linus" {
+		t.Errorf("created %+v", a)
+	}
+	if fmt.Sprint(removed) != fmt.Sprint([]string{e2}) {
+		t.Errorf("removed %v, want %s", removed, e2)
+	}
+}
+
+func TestSyncAgentsFields(t *testing.T) {
+	srv, t1, _, e1, _ := rosterServer(t)
+	n := len(srv.Requests())
+	// The name is not managed, and the blank email and teams are cleared.
+	plan, err := srv.Client().SyncAgents(context.Background(), &assembled.SyncAgentsRequest{
+		Desired: []assembled.Agent{{ImportID: "e1", Name: "Ada Lovelace"}},
+		Fields:  []assembled.AgentField{assembled.AgentFieldEmail, assembled.AgentFieldTeams},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Update) != 1 || fmt.Sprint(plan.Update[0].Fields) != "[email teams]" {
+		t.Errorf("plan = %+v", plan)
+	}
+	if got, want := patchedFields(srv, n), []string{"/v0/agents/" + e1 + ": email,teams"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("updates %v, want %v", got, want)
+	}
+	if a, _ := srv.Agent(e1); a.Name != "Ada" || a.Email != "" || len(a.Teams) != 0 {
+		t.Errorf("e1 = %+v", a)
+	}
+
+	// Matching fields need no update.
+	srv.AddAgent(assembled.Agent{ImportID: "e4", Name: "Barbara", Teams: []string{t1}})
+	plan, err = srv.Client().SyncAgents(context.Background(), &assembled.SyncAgentsRequest{
+		Desired: []assembled.Agent{{ImportID: "e4", Name: "B. Liskov", Teams: []string{t1, t1}}},
+		Fields:  []assembled.AgentField{assembled.AgentFieldTeams},
+	})
+	if err != nil || !plan.Empty() || len(plan.Unchanged) != 1 {
+		t.Errorf("plan = %+v, %v", plan, err)
+	}
+
+	if _, err := srv.Client().SyncAgents(context.Background(), &assembled.SyncAgentsRequest{Fields: []assembled.AgentField{assembled.AgentFieldImportID}}); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
+
+func TestSyncAgentsImportIDs(t *testing.T) {
+	srv, _, _, _, _ := rosterServer(t)
+	ctx := context.Background()
+	if _, err := srv.Client().SyncAgents(ctx, &assembled.SyncAgentsRequest{
+		Desired: []assembled.Agent{{ImportID: "e5", Name: "A"}, {ImportID: "e5", Name: "B"}},
+	}); err == nil || !strings.Contains(err.Error(), "several desired agents") {
+		t.Errorf("duplicate desired ImportID: err = %v", err)
+	}
+	if _, err := srv.Client().SyncAgents(ctx, &assembled.SyncAgentsRequest{
+		Desired: []assembled.Agent{{Name: "A"}},
+	}); err == nil {
+		t.Error("desired agent without ImportID accepted")
+	}
+
+	// Agents sharing an ImportID are only a problem if the roster has it.
+	srv.AddAgent(assembled.Agent{ImportID: "e1", Name: "Ada again"})
+	n := len(srv.Requests())
+	if _, err := srv.Client().SyncAgents(ctx, &assembled.SyncAgentsRequest{
+		Desired: []assembled.Agent{{ImportID: "e1", Name: "Ada"}},
+	}); err == nil || !strings.Contains(err.Error(), "several agents in Assembled") {
+		t.Errorf("shared ImportID: err = %v", err)
+	}
+	if w := writes(srv, n); len(w) != 0 {
+		t.Errorf("sent %v despite the shared ImportID", w)
+	}
+	if _, err := srv.Client().SyncAgents(ctx, &assembled.SyncAgentsRequest{
+		Desired: []assembled.Agent{{ImportID: "e6", Name: "Linus"}},
+	}); err != nil {
+		t.Errorf("shared ImportID not in the roster: %v", err)
+	}
+}
+
+func TestSyncAgentsMissing(t *testing.T) {
+	srv, _, _, e1, e2 := rosterServer(t)
+	ctx := context.Background()
+	desired := []assembled.Agent{{ImportID: "e1", Name: "Ada Lovelace"}}
+
+	// Without RemoveMissing, missing agents are only reported.
+	plan, err := srv.Client().SyncAgents(ctx, &assembled.SyncAgentsRequest{Desired: []assembled.Agent{{ImportID: "e1", Name: "Ada"}}})
+	if err != nil || !plan.Empty() || plan.Applied || len(plan.Missing) != 1 || plan.Missing[0].ID != e2 {
+		t.Errorf("plan = %+v, %v", plan, err)
+	}
+
+	// A dry run neither updates nor removes.
+	var removed []string
+	remove := func(ctx context.Context, a assembled.Agent) error {
+		removed = append(removed, a.ID)
+		return errors.New("cannot remove")
+	}
+	n := len(srv.Requests())
+	plan, err = srv.Client().SyncAgents(ctx, &assembled.SyncAgentsRequest{Desired: desired, RemoveMissing: remove, DryRun: true})
+	if err != nil || plan.Applied || len(plan.Update) != 1 || len(removed) != 0 || len(writes(srv, n)) != 0 {
+		t.Errorf("dry run: plan = %+v, %v, removed %v", plan, err, removed)
+	}
+
+	// Failures of RemoveMissing are returned, after every change is made.
+	plan, err = srv.Client().SyncAgents(ctx, &assembled.SyncAgentsRequest{Desired: desired, RemoveMissing: remove})
+	if err == nil || !strings.Contains(err.Error(), "cannot remove") || !plan.Applied {
+		t.Errorf("plan = %+v, %v", plan, err)
+	}
+	if fmt.Sprint(removed) != fmt.Sprint([]string{e2}) {
+		t.Errorf("removed %v, want %s", removed, e2)
+	}
+	if a, _ := srv.Agent(e1); a.Name != "Ada Lovelace" {
+		t.Errorf("e1 = %+v", a)
+	}
+}
@@ -0,0 +1,361 @@
+package assembledtest
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// AddActivityType stores an activity type, assigning it an ID if it has none,
+// and returns it.
+func (s *Server) AddActivityType(t assembled.ActivityType) assembled.ActivityType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.ID == "" {
+		t.ID = s.newID("activity_type")
+	}
+	s.activityTypes[t.ID] = t
+	return t
+}
+
+// AddActivity stores an activity on the given schedule, the master schedule
+// when scheduleID is empty, assigning it an ID if it has none. The agent and
+// activity type are not validated.
+func (s *Server) AddActivity(scheduleID string, a assembled.Activity) assembled.Activity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.ID == "" {
+		a.ID = s.newID("activity")
+	}
+	s.schedule(scheduleID)[a.ID] = a
+	return a
+}
+
+// Activities returns the activities on the given schedule, the master
+// schedule when scheduleID is empty, ordered by start time.
+func (s *Server) Activities(scheduleID string) []assembled.Activity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []assembled.Activity
+	for _, a := range s.schedule(scheduleID) {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StartTime.Equal(out[j].StartTime) {
+			return out[i].StartTime.Before(out[j].StartTime)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (s *Server) schedule(id string) map[string]assembled.Activity {
+	sched, ok := s.schedules[id]
+	if !ok {
+		sched = make(map[string]assembled.Activity)
+		s.schedules[id] = sched
+	}
+	return sched
+}
+
+func (s *Server) createActivity(body []byte) (int, interface{}) {
+	var req assembled.CreateActivityRequest
+	if err := decode(body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	a := assembled.Activity{
+		Description: req.Description,
+		AgentID:     req.AgentID,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+		TypeID:      req.TypeID,
+	}
+	if msg := s.validateActivity(a); msg != "" {
+		return http.StatusBadRequest, msg
+	}
+
+	sched := s.schedule(req.ScheduleID)
+	if !req.AllowConflicts {
+		for id, other := range sched {
+			if other.AgentID == a.AgentID && overlaps(other, a.StartTime, a.EndTime) {
+				delete(sched, id)
+			}
+		}
+	}
+	a.ID = s.newID("activity")
+	sched[a.ID] = a
+	return http.StatusOK, a
+}
+
+// createBulkActivity applies every request to a copy of the schedule and only
+// commits the copy when all of them succeed.
+func (s *Server) createBulkActivity(body []byte) (int, interface{}) {
+	var req assembled.CreateBulkActivityRequest
+	if err := decode(body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	working := make(map[string]assembled.Activity)
+	for id, a := range s.schedule(req.ScheduleID) {
+		working[id] = a
+	}
+	changed := make(map[string]assembled.Activity)
+	for i, ar := range req.Activities {
+		a := ar.Activity
+		switch ar.Action {
+		case "create":
+			if msg := s.validateActivity(a); msg != "" {
+				return http.StatusBadRequest, "activities[" + strconv.Itoa(i) + "]: " + msg
+			}
+			a.ID = s.newID("activity")
+			working[a.ID] = a
+			changed[a.ID] = a
+		case "update":
+			existing, ok := working[a.ID]
+			if !ok {
+				return http.StatusBadRequest, "activities[" + strconv.Itoa(i) + "]: unknown activity " + a.ID
+			}
+			if a.AgentID != "" {
+				existing.AgentID = a.AgentID
+			}
+			if a.TypeID != "" {
+				existing.TypeID = a.TypeID
+			}
+			if a.Description != "" {
+				existing.Description = a.Description
+			}
+			if !isZero(a.StartTime) {
+				existing.StartTime = a.StartTime
+			}
+			if !isZero(a.EndTime) {
+				existing.EndTime = a.EndTime
+			}
+			if msg := s.validateActivity(existing); msg != "" {
+				return http.StatusBadRequest, "activities[" + strconv.Itoa(i) + "]: " + msg
+			}
+			working[a.ID] = existing
+			changed[a.ID] = existing
+		case "delete":
+			if _, ok := working[a.ID]; !ok {
+				return http.StatusBadRequest, "activities[" + strconv.Itoa(i) + "]: unknown activity " + a.ID
+			}
+			delete(working, a.ID)
+			delete(changed, a.ID)
+		default:
+			return http.StatusBadRequest, "activities[" + strconv.Itoa(i) + "]: invalid action " + strconv.Quote(ar.Action)
+		}
+	}
+
+	s.schedules[req.ScheduleID] = working
+	return http.StatusOK, assembled.CreateBulkActivityResponse{Activities: changed}
+}
+
+// deleteActivities removes the deletion window from the activities of each
+// agent, trimming or splitting activities that extend beyond it.
+func (s *Server) deleteActivities(body []byte) (int, interface{}) {
+	var req assembled.DeleteActivitiesRequest
+	if err := decode(body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if isZero(req.StartTime) || !req.EndTime.After(req.StartTime) {
+		return http.StatusBadRequest, "invalid deletion window"
+	}
+	agents := make(map[string]bool)
+	for _, id := range req.AgentIDs {
+		if _, ok := s.agents[id]; !ok {
+			return http.StatusBadRequest, "unknown agent " + id
+		}
+		agents[id] = true
+	}
+
+	sched := s.schedule(req.ScheduleID)
+	for id, a := range sched {
+		if !agents[a.AgentID] || !overlaps(a, req.StartTime, req.EndTime) {
+			continue
+		}
+		startsInside := !a.StartTime.Before(req.StartTime)
+		endsInside := !a.EndTime.After(req.EndTime)
+		switch {
+		case startsInside && endsInside:
+			delete(sched, id)
+		case startsInside:
+			a.StartTime = req.EndTime
+			sched[id] = a
+		case endsInside:
+			a.EndTime = req.StartTime
+			sched[id] = a
+		default:
+			tail := a
+			tail.ID = s.newID("activity")
+			tail.StartTime = req.EndTime
+			sched[tail.ID] = tail
+			a.EndTime = req.StartTime
+			sched[id] = a
+		}
+	}
+	return http.StatusOK, nil
+}
+
+func (s *Server) listActivities(q url.Values) (int, interface{}) {
+	start, end, ok := window(q)
+	if !ok {
+		return http.StatusBadRequest, "start_time and end_time are required"
+	}
+	agents := set(q["agents"])
+	types := set(q["types"])
+	team := q.Get("team")
+	channel := q.Get("channel")
+
+	resp := assembled.ListActivitiesResponse{Activities: make(map[string]assembled.Activity)}
+	for id, a := range s.schedule(q.Get("schedule_id")) {
+		if !overlaps(a, start, end) {
+			continue
+		}
+		if len(agents) > 0 && !agents[a.AgentID] {
+			continue
+		}
+		if len(types) > 0 && !types[a.TypeID] {
+			continue
+		}
+		if team != "" && !s.agentInFilter(s.agents[a.AgentID].Teams, "teams", team) {
+			continue
+		}
+		if channel != "" && !contains(s.activityTypes[a.TypeID].Channels, channel) {
+			continue
+		}
+		resp.Activities[id] = a
+	}
+	if q.Get("include_agents") == "true" {
+		// Agents come with the queues they belong to.
+		resp.Agents = make(map[string]assembled.Agent)
+		resp.Queues = make(map[string]assembled.Queue)
+		for _, a := range resp.Activities {
+			agent, ok := s.agents[a.AgentID]
+			if !ok {
+				continue
+			}
+			resp.Agents[agent.ID] = agent
+			for _, id := range agent.Queues {
+				if f, ok := s.filters["queues"][id]; ok {
+					resp.Queues[id] = assembled.Queue{ID: f.ID, Name: f.Name}
+				}
+			}
+		}
+	}
+	out := listActivitiesResponse{ListActivitiesResponse: resp}
+	if q.Get("include_activity_types") == "true" {
+		out.ActivityTypes = make(map[string]assembled.ActivityType)
+		for _, a := range resp.Activities {
+			if t, ok := s.activityTypes[a.TypeID]; ok {
+				out.ActivityTypes[t.ID] = t
+			}
+		}
+	}
+	return http.StatusOK, out
+}
+
+// listActivitiesResponse adds the activity types requested with
+// include_activity_types, which ListActivitiesResponse has no field for, so
+// that clients decoding the raw body see them as they would from the API.
+type listActivitiesResponse struct {
+	assembled.ListActivitiesResponse
+	ActivityTypes map[string]assembled.ActivityType `json:"activity_types,omitempty"`
+}
+
+func (s *Server) validateActivity(a assembled.Activity) string {
+	if _, ok := s.agents[a.AgentID]; !ok {
+		return "unknown agent " + a.AgentID
+	}
+	if _, ok := s.activityTypes[a.TypeID]; !ok {
+		return "unknown activity type " + a.TypeID
+	}
+	if isZero(a.StartTime) || !a.EndTime.After(a.StartTime) {
+		return "end_time must be after start_time"
+	}
+	return ""
+}
+
+func (s *Server) createActivityType(body []byte) (int, interface{}) {
+	var req assembled.CreateActivityTypeRequest
+	if err := decode(body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if req.Name == "" {
+		return http.StatusBadRequest, "name is required"
+	}
+	if req.Productive && req.Timeoff {
+		return http.StatusBadRequest, "an activity type cannot be both productive and timeoff"
+	}
+	t := assembled.ActivityType{
+		ID:              s.newID("activity_type"),
+		Channels:        req.Channels,
+		ImportID:        req.ImportID,
+		Value:           req.Value,
+		BackgroundColor: req.BackgroundColor,
+		FontColor:       req.FontColor,
+		Name:            req.Name,
+		Productive:      req.Productive,
+		ShortName:       req.ShortName,
+		Timeoff:         req.Timeoff,
+	}
+	s.activityTypes[t.ID] = t
+	return http.StatusOK, t
+}
+
+func (s *Server) deleteActivityType(id string) (int, interface{}) {
+	t, ok := s.activityTypes[id]
+	if !ok {
+		return http.StatusNotFound, "unknown activity type " + id
+	}
+	delete(s.activityTypes, id)
+	return http.StatusOK, t
+}
+
+func (s *Server) listActivityTypes() (int, interface{}) {
+	resp := assembled.ListActivityTypesResponse{ActivityTypes: make(map[string]assembled.ActivityType)}
+	for id, t := range s.activityTypes {
+		resp.ActivityTypes[id] = t
+	}
+	return http.StatusOK, resp
+}
+
+func overlaps(a assembled.Activity, start, end time.Time) bool {
+	return a.StartTime.Before(end) && a.EndTime.After(start)
+}
+
+// isZero reports whether t is unset, either as the zero time or as the Unix
+// epoch that an omitted timestamp decodes to.
+func isZero(t time.Time) bool {
+	return t.IsZero() || t.Unix() == 0
+}
+
+// window parses the start_time and end_time query parameters.
+func window(q url.Values) (start, end time.Time, ok bool) {
+	s, err1 := strconv.ParseInt(q.Get("start_time"), 10, 64)
+	e, err2 := strconv.ParseInt(q.Get("end_time"), 10, 64)
+	if err1 != nil || err2 != nil || e <= s {
+		return start, end, false
+	}
+	return time.Unix(s, 0), time.Unix(e, 0), true
+}
+
+func set(values []string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package assembledtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// AddAgent stores an agent, assigning it an ID if it has none, and returns
+// it. Filter IDs are not validated.
+func (s *Server) AddAgent(a assembled.Agent) assembled.Agent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.ID == "" {
+		a.ID = s.newID("agent")
+	}
+	s.agents[a.ID] = a
+	return a
+}
+
+// Agent returns the agent with the given ID.
+func (s *Server) Agent(id string) (assembled.Agent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.agents[id]
+	return a, ok
+}
+
+// AgentStatuses returns every status created for the given agent, in the
+// order they were received.
+func (s *Server) AgentStatuses(agentID string) []assembled.AgentStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]assembled.AgentStatus(nil), s.statusLog[agentID]...)
+}
+
+func (s *Server) createAgent(body []byte) (int, interface{}) {
+	var req assembled.CreateAgentRequest
+	if err := decode(body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	a := assembled.Agent{
+		ImportID: req.ImportID,
+		Channels: req.Channels,
+		Email:    req.Email,
+		Name:     req.Name,
+		Queues:   req.Queues,
+		Site:     req.Site,
+		Skills:   req.Skills,
+		Teams:    req.Teams,
+	}
+	if a.Name == "" {
+		return http.StatusBadRequest, "name is required"
+	}
+	if msg := s.validateAgent(a); msg != "" {
+		return http.StatusBadRequest, msg
+	}
+	a.ID = s.newID("agent")
+	s.agents[a.ID] = a
+	return http.StatusOK, a
+}
+
+func (s *Server) listAgents(q url.Values) (int, interface{}) {
+	channels := q["channels"]
+	resp := assembled.ListAgentsResponse{Agents: make(map[string]assembled.Agent)}
+	for id, a := range s.agents {
+		if len(channels) > 0 && !intersects(a.Channels, channels) {
+			continue
+		}
+		if v := q.Get("queue"); v != "" && !s.agentInFilter(a.Queues, "queues", v) {
+			continue
+		}
+		if v := q.Get("site"); v != "" && !s.agentInFilter([]string{a.Site}, "sites", v) {
+			continue
+		}
+		if v := q.Get("team"); v != "" && !s.agentInFilter(a.Teams, "teams", v) {
+			continue
+		}
+		resp.Agents[id] = a
+	}
+	return http.StatusOK, resp
+}
+
+// updateAgent applies PATCH semantics: fields missing from the body are left
+// alone, while fields set to null or an empty value are cleared.
+func (s *Server) updateAgent(id string, body []byte) (int, interface{}) {
+	a, ok := s.agents[id]
+	if !ok {
+		return http.StatusNotFound, "unknown agent " + id
+	}
+	var fields map[string]json.RawMessage
+	if err := decode(body, &fields); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	targets := map[string]interface{}{
+		"import_id": &a.ImportID,
+		"channels":  &a.Channels,
+		"email":     &a.Email,
+		"name":      &a.Name,
+		"queues":    &a.Queues,
+		"site":      &a.Site,
+		"skills":    &a.Skills,
+		"teams":     &a.Teams,
+	}
+	for key, raw := range fields {
+		target, ok := targets[key]
+		if !ok {
+			return http.StatusBadRequest, "unknown field " + key
+		}
+		if string(raw) == "null" {
+			clearField(target)
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return http.StatusBadRequest, key + ": " + err.Error()
+		}
+	}
+	if msg := s.validateAgent(a); msg != "" {
+		return http.StatusBadRequest, msg
+	}
+	s.agents[id] = a
+	return http.StatusOK, a
+}
+
+func (s *Server) validateAgent(a assembled.Agent) string {
+	for _, c := range a.Channels {
+		if c != "phone" && c != "email" && c != "chat" {
+			return "invalid channel " + c
+		}
+	}
+	if a.Site != "" {
+		if _, ok := s.filters["sites"][a.Site]; !ok {
+			return "unknown site " + a.Site
+		}
+	}
+	refs := []struct {
+		kind string
+		ids  []string
+	}{{"queues", a.Queues}, {"skills", a.Skills}, {"teams", a.Teams}}
+	for _, ref := range refs {
+		for _, id := range ref.ids {
+			if _, ok := s.filters[ref.kind][id]; !ok {
+				return "unknown " + ref.kind[:len(ref.kind)-1] + " " + id
+			}
+		}
+	}
+	return ""
+}
+
+// agentInFilter reports whether any of ids refers to the filter of the given
+// kind whose ID or name is v.
+func (s *Server) agentInFilter(ids []string, kind, v string) bool {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if id == v || s.filters[kind][id].Name == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) createAgentStatus(body []byte) (int, interface{}) {
+	var req assembled.CreateAgentStatusRequest
+	if err := decode(body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if _, ok := s.agents[req.AgentID]; !ok {
+		return http.StatusBadRequest, "unknown agent " + req.AgentID
+	}
+	if req.Status == "" || isZero(req.StartTime) {
+		return http.StatusBadRequest, "status and start_time are required"
+	}
+	status := assembled.AgentStatus(req)
+	s.statusLog[req.AgentID] = append(s.statusLog[req.AgentID], status)
+	if latest, ok := s.statuses[req.AgentID]; !ok || !status.StartTime.Before(latest.StartTime) {
+		s.statuses[req.AgentID] = status
+	}
+	return http.StatusOK, status
+}
+
+func (s *Server) getAgentStatus(id string) (int, interface{}) {
+	if _, ok := s.agents[id]; !ok {
+		return http.StatusNotFound, "unknown agent " + id
+	}
+	status, ok := s.statuses[id]
+	if !ok {
+		return http.StatusNotFound, "no status for agent " + id
+	}
+	return http.StatusOK, status
+}
+
+func clearField(target interface{}) {
+	switch t := target.(type) {
+	case *string:
+		*t = ""
+	case *[]string:
+		*t = nil
+	}
+}
+
+func intersects(a, b []string) bool {
+	for _, v := range a {
+		if contains(b, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package assembledtest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// Kinds of filters, named after their API paths.
+var filterKinds = []string{"queues", "sites", "teams", "skills"}
+
+func isFilterKind(kind string) bool {
+	return contains(filterKinds, kind)
+}
+
+// AddFilter stores a filter of the given kind, one of "queues", "sites",
+// "teams" or "skills", assigning it an ID if it has none, and returns it.
+func (s *Server) AddFilter(kind string, f assembled.Filter) assembled.Filter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.ID == "" {
+		f.ID = s.newID(kind[:len(kind)-1])
+	}
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = s.now()
+		f.UpdatedAt = f.CreatedAt
+	}
+	s.filters[kind][f.ID] = f
+	return f
+}
+
+// Filters returns the filters of the given kind keyed by ID.
+func (s *Server) Filters(kind string) map[string]assembled.Filter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]assembled.Filter)
+	for id, f := range s.filters[kind] {
+		out[id] = f
+	}
+	return out
+}
+
+func (s *Server) createFilters(kind string, body []byte) (int, interface{}) {
+	var req map[string][]assembled.Filter
+	if err := decode(body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	filters := s.filters[kind]
+	created := make(map[string]assembled.Filter)
+	for _, f := range req[kind] {
+		if f.Name == "" {
+			return http.StatusBadRequest, "name is required"
+		}
+		if f.ParentID != "" {
+			if _, ok := filters[f.ParentID]; !ok {
+				if _, ok := created[f.ParentID]; !ok {
+					return http.StatusBadRequest, "unknown parent " + f.ParentID
+				}
+			}
+		}
+		f.ID = s.newID(kind[:len(kind)-1])
+		f.CreatedAt = s.now()
+		f.UpdatedAt = f.CreatedAt
+		created[f.ID] = f
+	}
+	for id, f := range created {
+		filters[id] = f
+	}
+	return http.StatusOK, map[string]map[string]assembled.Filter{kind: created}
+}
+
+func (s *Server) deleteFilters(kind string, body []byte) (int, interface{}) {
+	var req map[string][]string
+	if err := decode(body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	filters := s.filters[kind]
+	ids := req[kind[:len(kind)-1]+"_ids"]
+	for _, id := range ids {
+		if _, ok := filters[id]; !ok {
+			return http.StatusBadRequest, "unknown filter " + id
+		}
+	}
+	for _, id := range ids {
+		delete(filters, id)
+	}
+	return http.StatusOK, nil
+}
+
+func (s *Server) listFilters(kind string) (int, interface{}) {
+	out := make(map[string]assembled.Filter)
+	for id, f := range s.filters[kind] {
+		out[id] = f
+	}
+	return http.StatusOK, map[string]map[string]assembled.Filter{kind: out}
+}
+
+// updateFilter changes the fields present in the body. A parent_id of null
+// or "" moves the filter to the top level.
+func (s *Server) updateFilter(kind, id string, body []byte) (int, interface{}) {
+	filters := s.filters[kind]
+	f, ok := filters[id]
+	if !ok {
+		return http.StatusNotFound, "unknown filter " + id
+	}
+	var fields map[string]json.RawMessage
+	if err := decode(body, &fields); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if raw, ok := fields["name"]; ok {
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil || name == "" {
+			return http.StatusBadRequest, "invalid name"
+		}
+		f.Name = name
+	}
+	if raw, ok := fields["parent_id"]; ok {
+		var parent string
+		if string(raw) != "null" {
+			if err := json.Unmarshal(raw, &parent); err != nil {
+				return http.StatusBadRequest, "invalid parent_id"
+			}
+		}
+		if parent != "" {
+			if _, ok := filters[parent]; !ok {
+				return http.StatusBadRequest, "unknown parent " + parent
+			}
+			for p := parent; p != ""; p = filters[p].ParentID {
+				if p == id {
+					return http.StatusBadRequest, "parent_id would create a cycle"
+				}
+			}
+		}
+		f.ParentID = parent
+	}
+	f.UpdatedAt = s.now()
+	filters[id] = f
+	return http.StatusOK, f
+}
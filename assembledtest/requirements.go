@@ -0,0 +1,75 @@
+package assembledtest
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// AddRequirementType stores a requirement type, assigning it an ID if it has
+// none, and returns it.
+func (s *Server) AddRequirementType(t assembled.RequirementType) assembled.RequirementType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.ID == "" {
+		t.ID = s.newID("requirement_type")
+	}
+	s.reqTypes[t.ID] = t
+	return t
+}
+
+// createRequirement stores a requirement, overwriting any requirement of the
+// same type over the same interval.
+func (s *Server) createRequirement(body []byte) (int, interface{}) {
+	var req assembled.CreateRequirementRequest
+	if err := decode(body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if _, ok := s.reqTypes[req.RequirementTypeID]; !ok {
+		return http.StatusBadRequest, "unknown requirement type " + req.RequirementTypeID
+	}
+	if isZero(req.StartTime) || !req.EndTime.After(req.StartTime) {
+		return http.StatusBadRequest, "end_time must be after start_time"
+	}
+
+	r := assembled.Requirement{
+		Required:          req.Required,
+		RequirementTypeID: req.RequirementTypeID,
+		StartTime:         req.StartTime,
+		EndTime:           req.EndTime,
+	}
+	for i, existing := range s.requirements {
+		if existing.RequirementTypeID == r.RequirementTypeID &&
+			existing.StartTime.Equal(r.StartTime) && existing.EndTime.Equal(r.EndTime) {
+			r.Scheduled = existing.Scheduled
+			s.requirements[i] = r
+			return http.StatusOK, r
+		}
+	}
+	s.requirements = append(s.requirements, r)
+	return http.StatusOK, r
+}
+
+func (s *Server) listRequirements(q url.Values) (int, interface{}) {
+	start, end, ok := window(q)
+	if !ok {
+		return http.StatusBadRequest, "start_time and end_time are required"
+	}
+	types := set(q["requirement_types"])
+	var resp assembled.ListRequirementsResponse
+	for _, r := range s.requirements {
+		if r.StartTime.Before(end) && r.EndTime.After(start) && (len(types) == 0 || types[r.RequirementTypeID]) {
+			resp.Requirements = append(resp.Requirements, r)
+		}
+	}
+	return http.StatusOK, resp
+}
+
+func (s *Server) listRequirementTypes() (int, interface{}) {
+	resp := assembled.ListRequirementTypesResponse{RequirementTypes: make(map[string]assembled.RequirementType)}
+	for id, t := range s.reqTypes {
+		resp.RequirementTypes[id] = t
+	}
+	return http.StatusOK, resp
+}
@@ -0,0 +1,369 @@
+// Package assembledtest provides an in-memory fake of the Assembled API for
+// testing code built on the assembled package.
+//
+// The fake implements every endpoint called by assembled.Client, keeps its
+// state in memory and can inject latency and failures:
+//
+//	srv := assembledtest.NewServer()
+//	defer srv.Close()
+//	agent := srv.AddAgent(assembled.Agent{Name: "Ada"})
+//	client := srv.Client()
+//	// or: assembled.NewClient(srv.APIKey, assembled.WithBaseURL(srv.URL))
+package assembledtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// DefaultAPIKey is the API key accepted by a Server unless changed.
+const DefaultAPIKey = "test_api_key"
+
+// Server is a stateful in-memory fake of the Assembled API. It is safe for
+// concurrent use.
+type Server struct {
+	URL    string
+	APIKey string
+
+	// Now, if set, returns the time used for the creation and update times
+	// of filters, so that they are predictable. Defaults to time.Now.
+	Now func() time.Time
+
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	nextID        int
+	latency       time.Duration
+	faults        []*Fault
+	requests      []Request
+	agents        map[string]assembled.Agent
+	statuses      map[string]assembled.AgentStatus   // Latest status by agent ID.
+	statusLog     map[string][]assembled.AgentStatus // Every status by agent ID.
+	activityTypes map[string]assembled.ActivityType
+	schedules     map[string]map[string]assembled.Activity // By schedule ID, then activity ID.
+	filters       map[string]map[string]assembled.Filter   // By kind, then filter ID.
+	reqTypes      map[string]assembled.RequirementType
+	requirements  []assembled.Requirement
+}
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   []byte
+}
+
+// Fault describes a failure injected into matching requests.
+type Fault struct {
+	// Restricts the fault to requests with this method and to paths with
+	// this prefix. Empty values match every request.
+	Method     string
+	PathPrefix string
+
+	// Number of matching requests the fault applies to. Zero or less applies
+	// it until ClearFaults is called.
+	Times int
+
+	// Delay before the request is handled.
+	Latency time.Duration
+
+	// Status code returned instead of handling the request. Zero lets the
+	// request through after Latency.
+	StatusCode int
+
+	// Value of the Retry-After header sent with StatusCode.
+	RetryAfter time.Duration
+
+	// If set, the request is handled before StatusCode is returned in place
+	// of its response, as when a response is lost after the server applied
+	// the request.
+	AfterHandling bool
+}
+
+// NewServer starts a fake API server accepting DefaultAPIKey. Call Close when
+// done with it.
+func NewServer() *Server {
+	s := &Server{
+		APIKey:        DefaultAPIKey,
+		agents:        make(map[string]assembled.Agent),
+		statuses:      make(map[string]assembled.AgentStatus),
+		statusLog:     make(map[string][]assembled.AgentStatus),
+		activityTypes: make(map[string]assembled.ActivityType),
+		schedules:     make(map[string]map[string]assembled.Activity),
+		filters:       make(map[string]map[string]assembled.Filter),
+		reqTypes:      make(map[string]assembled.RequirementType),
+	}
+	for _, kind := range filterKinds {
+		s.filters[kind] = make(map[string]assembled.Filter)
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns a client for the server, with telemetry disabled. Options
+// are applied after the server's base URL.
+func (s *Server) Client(opts ...assembled.Option) *assembled.Client {
+	opts = append([]assembled.Option{
+		assembled.WithBaseURL(s.URL),
+		assembled.WithTelemetry(false),
+	}, opts...)
+	return assembled.NewClient(s.APIKey, opts...)
+}
+
+// SetLatency delays every request by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// InjectFault applies f to matching requests. Faults are checked in the order
+// they were injected and at most one applies to each request.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// FailNext makes the next n requests fail with the given status code.
+func (s *Server) FailNext(n, statusCode int) {
+	s.InjectFault(Fault{Times: n, StatusCode: statusCode})
+}
+
+// RateLimitNext makes the next n requests fail with 429 and the given
+// Retry-After.
+func (s *Server) RateLimitNext(n int, retryAfter time.Duration) {
+	s.InjectFault(Fault{Times: n, StatusCode: http.StatusTooManyRequests, RetryAfter: retryAfter})
+}
+
+// ClearFaults removes all injected faults and latency.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+	s.latency = 0
+}
+
+// Requests returns the requests received so far, including those that
+// failed authentication or had a fault injected.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	w.Header().Set("Request-Id", fmt.Sprintf("req_%d", s.nextID))
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Body: body})
+	latency := s.latency
+	fault := s.matchFault(r)
+	s.mu.Unlock()
+
+	if fault != nil {
+		latency += fault.Latency
+	}
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fault != nil && fault.StatusCode != 0 && !fault.AfterHandling {
+		writeFault(w, fault)
+		return
+	}
+
+	if key, _, ok := r.BasicAuth(); !ok || key != s.APIKey {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid API key")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status, resp := s.route(r, body)
+	if fault != nil && fault.StatusCode != 0 {
+		writeFault(w, fault)
+		return
+	}
+	if status != http.StatusOK {
+		writeError(w, status, errorCode(status), resp.(string))
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func writeFault(w http.ResponseWriter, f *Fault) {
+	if f.RetryAfter > 0 {
+		secs := (f.RetryAfter + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", fmt.Sprint(int64(secs)))
+	}
+	writeError(w, f.StatusCode, "injected_fault", http.StatusText(f.StatusCode))
+}
+
+// matchFault returns the first fault matching r, consuming one of its uses.
+func (s *Server) matchFault(r *http.Request) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, f.PathPrefix) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// route dispatches a request to its handler. Handlers run with s.mu held and
+// return either http.StatusOK and a response body, or an error status and a
+// message.
+func (s *Server) route(r *http.Request, body []byte) (int, interface{}) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v0" {
+		return http.StatusNotFound, "no such endpoint"
+	}
+	q := r.URL.Query()
+	resource, rest := parts[1], parts[2:]
+
+	switch {
+	case resource == "activities" && len(rest) == 0:
+		switch r.Method {
+		case "POST":
+			return s.createActivity(body)
+		case "DELETE":
+			return s.deleteActivities(body)
+		case "GET":
+			return s.listActivities(q)
+		}
+	case resource == "activities" && len(rest) == 1 && rest[0] == "bulk" && r.Method == "POST":
+		return s.createBulkActivity(body)
+
+	case resource == "activity_types" && len(rest) == 0:
+		switch r.Method {
+		case "POST":
+			return s.createActivityType(body)
+		case "GET":
+			return s.listActivityTypes()
+		}
+	case resource == "activity_types" && len(rest) == 1 && r.Method == "DELETE":
+		return s.deleteActivityType(rest[0])
+
+	case resource == "agents" && len(rest) == 0:
+		switch r.Method {
+		case "POST":
+			return s.createAgent(body)
+		case "GET":
+			return s.listAgents(q)
+		}
+	case resource == "agents" && len(rest) == 1 && rest[0] == "status" && r.Method == "POST":
+		return s.createAgentStatus(body)
+	case resource == "agents" && len(rest) == 1 && r.Method == "PATCH":
+		return s.updateAgent(rest[0], body)
+	case resource == "agents" && len(rest) == 2 && rest[1] == "status" && r.Method == "GET":
+		return s.getAgentStatus(rest[0])
+
+	case isFilterKind(resource) && len(rest) == 0:
+		switch r.Method {
+		case "POST":
+			return s.createFilters(resource, body)
+		case "DELETE":
+			return s.deleteFilters(resource, body)
+		case "GET":
+			return s.listFilters(resource)
+		}
+	case isFilterKind(resource) && len(rest) == 1 && r.Method == "PUT":
+		return s.updateFilter(resource, rest[0], body)
+
+	case resource == "requirements" && len(rest) == 0:
+		switch r.Method {
+		case "POST":
+			return s.createRequirement(body)
+		case "GET":
+			return s.listRequirements(q)
+		}
+	case resource == "requirement_types" && len(rest) == 0 && r.Method == "GET":
+		return s.listRequirementTypes()
+	}
+	return http.StatusNotFound, "no such endpoint"
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now().Truncate(time.Second)
+	}
+	return time.Now().Truncate(time.Second)
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s_%d", prefix, s.nextID)
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	defer r.Body.Close()
+	return ioutil.ReadAll(r.Body)
+}
+
+func decode(body []byte, v interface{}) error {
+	if len(body) == 0 {
+		return fmt.Errorf("missing request body")
+	}
+	return json.Unmarshal(body, v)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if v == nil {
+		v = struct{}{}
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "message": message})
+}
+
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request"
+	case http.StatusNotFound:
+		return "not_found"
+	}
+	return "error"
+}
@@ -0,0 +1,486 @@
+package assembledtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+var (
+	ctx   = context.Background()
+	start = time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC)
+)
+
+func at(hours float64) time.Time {
+	return start.Add(time.Duration(hours * float64(time.Hour)))
+}
+
+func newServer(t *testing.T) (*assembledtest.Server, *assembled.Client) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	return srv, srv.Client(assembled.WithRetryPolicy(nil))
+}
+
+func TestCreateActivity(t *testing.T) {
+	srv, c := newServer(t)
+	agent := srv.AddAgent(assembled.Agent{Name: "Ada"})
+	typ := srv.AddActivityType(assembled.ActivityType{Name: "Phones"})
+	old := srv.AddActivity("", assembled.Activity{AgentID: agent.ID, TypeID: typ.ID, StartTime: at(0), EndTime: at(2)})
+
+	a, err := c.CreateActivity(ctx, &assembled.CreateActivityRequest{
+		AgentID: agent.ID, TypeID: typ.ID, StartTime: at(1), EndTime: at(3), Description: "calls",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID == "" || a.Description != "calls" || !a.StartTime.Equal(at(1)) {
+		t.Errorf("created %+v", a)
+	}
+	// Conflicting activities are replaced unless AllowConflicts is set.
+	if got := srv.Activities(""); len(got) != 1 || got[0].ID != a.ID {
+		t.Errorf("schedule = %+v, want only %s", got, a.ID)
+	}
+	if _, err := c.CreateActivity(ctx, &assembled.CreateActivityRequest{
+		AgentID: agent.ID, TypeID: typ.ID, StartTime: at(2), EndTime: at(4), AllowConflicts: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Activities(""); len(got) != 2 {
+		t.Errorf("got %d activities, want 2 (old activity %s)", len(got), old.ID)
+	}
+
+	_, err = c.CreateActivity(ctx, &assembled.CreateActivityRequest{AgentID: "nobody", TypeID: typ.ID, StartTime: at(1), EndTime: at(2)})
+	if !errors.Is(err, assembled.ErrValidation) {
+		t.Errorf("unknown agent: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestCreateBulkActivity(t *testing.T) {
+	srv, c := newServer(t)
+	agent := srv.AddAgent(assembled.Agent{Name: "Ada"})
+	typ := srv.AddActivityType(assembled.ActivityType{Name: "Phones"})
+	keep := srv.AddActivity("", assembled.Activity{AgentID: agent.ID, TypeID: typ.ID, StartTime: at(0), EndTime: at(1)})
+	drop := srv.AddActivity("", assembled.Activity{AgentID: agent.ID, TypeID: typ.ID, StartTime: at(1), EndTime: at(2)})
+
+	resp, err := c.CreateBulkActivity(ctx, &assembled.CreateBulkActivityRequest{Activities: []assembled.ActivityRequest{
+		{Action: "update", Activity: assembled.Activity{ID: keep.ID, Description: "moved", StartTime: at(3), EndTime: at(4)}},
+		{Action: "delete", Activity: assembled.Activity{ID: drop.ID}},
+		{Action: "create", Activity: assembled.Activity{AgentID: agent.ID, TypeID: typ.ID, StartTime: at(5), EndTime: at(6)}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Activities) != 2 || resp.Activities[keep.ID].Description != "moved" {
+		t.Errorf("response = %+v", resp.Activities)
+	}
+	if got := srv.Activities(""); len(got) != 2 || got[0].ID != keep.ID || !got[0].StartTime.Equal(at(3)) {
+		t.Errorf("schedule = %+v", got)
+	}
+
+	// A failing item rolls back the whole request.
+	_, err = c.CreateBulkActivity(ctx, &assembled.CreateBulkActivityRequest{Activities: []assembled.ActivityRequest{
+		{Action: "delete", Activity: assembled.Activity{ID: keep.ID}},
+		{Action: "delete", Activity: assembled.Activity{ID: "missing"}},
+	}})
+	if !errors.Is(err, assembled.ErrValidation) {
+		t.Errorf("err = %v, want ErrValidation", err)
+	}
+	if got := srv.Activities(""); len(got) != 2 {
+		t.Errorf("failed request changed the schedule: %+v", got)
+	}
+}
+
+func TestDeleteActivities(t *testing.T) {
+	srv, c := newServer(t)
+	agent := srv.AddAgent(assembled.Agent{Name: "Ada"})
+	other := srv.AddAgent(assembled.Agent{Name: "Grace"})
+	typ := srv.AddActivityType(assembled.ActivityType{Name: "Phones"})
+	long := srv.AddActivity("", assembled.Activity{AgentID: agent.ID, TypeID: typ.ID, StartTime: at(0), EndTime: at(4)})
+	srv.AddActivity("", assembled.Activity{AgentID: other.ID, TypeID: typ.ID, StartTime: at(0), EndTime: at(4)})
+
+	err := c.DeleteActivities(ctx, &assembled.DeleteActivitiesRequest{AgentIDs: []string{agent.ID}, StartTime: at(1), EndTime: at(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spans []string
+	for _, a := range srv.Activities("") {
+		if a.AgentID == agent.ID {
+			spans = append(spans, a.StartTime.Format("15")+"-"+a.EndTime.Format("15"))
+		}
+	}
+	if want := []string{"09-10", "11-13"}; !reflect.DeepEqual(spans, want) {
+		t.Errorf("activities of %s (split from %s) = %v, want %v", agent.ID, long.ID, spans, want)
+	}
+	if n := len(srv.Activities("")); n != 3 {
+		t.Errorf("got %d activities, want 3", n)
+	}
+}
+
+func TestListActivities(t *testing.T) {
+	srv, c := newServer(t)
+	queue := srv.AddFilter("queues", assembled.Filter{Name: "Billing"})
+	team := srv.AddFilter("teams", assembled.Filter{Name: "Tier 1"})
+	ada := srv.AddAgent(assembled.Agent{Name: "Ada", Queues: []string{queue.ID}, Teams: []string{team.ID}})
+	grace := srv.AddAgent(assembled.Agent{Name: "Grace"})
+	phone := srv.AddActivityType(assembled.ActivityType{Name: "Phones", Channels: []string{"phone"}, Productive: true})
+	lunch := srv.AddActivityType(assembled.ActivityType{Name: "Lunch"})
+	a1 := srv.AddActivity("", assembled.Activity{AgentID: ada.ID, TypeID: phone.ID, StartTime: at(0), EndTime: at(2)})
+	a2 := srv.AddActivity("", assembled.Activity{AgentID: ada.ID, TypeID: lunch.ID, StartTime: at(2), EndTime: at(3)})
+	a3 := srv.AddActivity("", assembled.Activity{AgentID: grace.ID, TypeID: phone.ID, StartTime: at(1), EndTime: at(5)})
+	f1 := srv.AddActivity("forecast", assembled.Activity{AgentID: ada.ID, TypeID: phone.ID, StartTime: at(0), EndTime: at(1)})
+
+	tests := []struct {
+		name string
+		req  assembled.ListActivitiesRequest
+		want []string
+	}{
+		{"window", assembled.ListActivitiesRequest{StartTime: at(2.5), EndTime: at(4)}, []string{a2.ID, a3.ID}},
+		{"agents", assembled.ListActivitiesRequest{StartTime: at(0), EndTime: at(8), Agents: []string{ada.ID}}, []string{a1.ID, a2.ID}},
+		{"types", assembled.ListActivitiesRequest{StartTime: at(0), EndTime: at(8), Types: []string{lunch.ID}}, []string{a2.ID}},
+		{"team", assembled.ListActivitiesRequest{StartTime: at(0), EndTime: at(8), Team: "Tier 1"}, []string{a1.ID, a2.ID}},
+		{"channel", assembled.ListActivitiesRequest{StartTime: at(0), EndTime: at(8), Channel: "phone"}, []string{a1.ID, a3.ID}},
+		{"schedule", assembled.ListActivitiesRequest{StartTime: at(0), EndTime: at(8), ScheduleID: "forecast"}, []string{f1.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := c.ListActivities(ctx, &tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keys(resp.Activities); !reflect.DeepEqual(got, sorted(tt.want)) {
+				t.Errorf("got %v, want %v", got, sorted(tt.want))
+			}
+			if resp.Agents != nil || resp.Queues != nil {
+				t.Error("agents or queues included without include_agents")
+			}
+		})
+	}
+
+	resp, err := c.ListActivities(ctx, &assembled.ListActivitiesRequest{
+		StartTime: at(0), EndTime: at(1), Agents: []string{ada.ID}, IncludeAgents: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(resp.Agents); !reflect.DeepEqual(got, []string{ada.ID}) {
+		t.Errorf("included agents = %v", got)
+	}
+	if q := resp.Queues[queue.ID]; q.Name != "Billing" || len(resp.Queues) != 1 {
+		t.Errorf("included queues = %+v", resp.Queues)
+	}
+
+	if _, err := c.ListActivities(ctx, &assembled.ListActivitiesRequest{}); !errors.Is(err, assembled.ErrValidation) {
+		t.Errorf("missing window: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestListActivitiesIncludeActivityTypes(t *testing.T) {
+	srv, _ := newServer(t)
+	agent := srv.AddAgent(assembled.Agent{Name: "Ada"})
+	typ := srv.AddActivityType(assembled.ActivityType{Name: "Phones"})
+	srv.AddActivityType(assembled.ActivityType{Name: "Unused"})
+	srv.AddActivity("", assembled.Activity{AgentID: agent.ID, TypeID: typ.ID, StartTime: at(0), EndTime: at(1)})
+
+	// The response type has no field for activity types, so read the body.
+	get := func(include bool) map[string]json.RawMessage {
+		q := url.Values{
+			"start_time": {strconv.FormatInt(at(0).Unix(), 10)},
+			"end_time":   {strconv.FormatInt(at(1).Unix(), 10)},
+		}
+		if include {
+			q.Set("include_activity_types", "true")
+		}
+		req, _ := http.NewRequest("GET", srv.URL+"/v0/activities?"+q.Encode(), nil)
+		req.SetBasicAuth(srv.APIKey, "")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		return body
+	}
+
+	if _, ok := get(false)["activity_types"]; ok {
+		t.Error("activity types included without include_activity_types")
+	}
+	var types map[string]assembled.ActivityType
+	if err := json.Unmarshal(get(true)["activity_types"], &types); err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 1 || types[typ.ID].Name != "Phones" {
+		t.Errorf("included activity types = %+v", types)
+	}
+}
+
+func TestActivityTypes(t *testing.T) {
+	_, c := newServer(t)
+
+	created, err := c.CreateActivityType(ctx, &assembled.CreateActivityTypeRequest{Name: "Phones", Channels: []string{"phone"}, Productive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := c.ListActivityTypes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := list.ActivityTypes[created.ID]; got.Name != "Phones" || !got.Productive {
+		t.Errorf("listed %+v", list.ActivityTypes)
+	}
+	if _, err := c.CreateActivityType(ctx, &assembled.CreateActivityTypeRequest{Name: "Both", Productive: true, Timeoff: true}); !errors.Is(err, assembled.ErrValidation) {
+		t.Errorf("productive timeoff type: err = %v, want ErrValidation", err)
+	}
+
+	deleted, err := c.DeleteActivityType(ctx, &assembled.DeleteActivityTypeRequest{ID: created.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.ID != created.ID {
+		t.Errorf("deleted %+v", deleted)
+	}
+	if _, err := c.DeleteActivityType(ctx, &assembled.DeleteActivityTypeRequest{ID: created.ID}); !errors.Is(err, assembled.ErrNotFound) {
+		t.Errorf("second delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAgents(t *testing.T) {
+	srv, c := newServer(t)
+	team := srv.AddFilter("teams", assembled.Filter{Name: "Tier 1"})
+	site := srv.AddFilter("sites", assembled.Filter{Name: "Lisbon"})
+
+	ada, err := c.CreateAgent(ctx, &assembled.CreateAgentRequest{Name: "Ada", Channels: []string{"phone"}, Teams: []string{team.ID}, Site: site.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	grace, err := c.CreateAgent(ctx, &assembled.CreateAgentRequest{Name: "Grace", Channels: []string{"chat"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateAgent(ctx, &assembled.CreateAgentRequest{Name: "Bad", Teams: []string{"nope"}}); !errors.Is(err, assembled.ErrValidation) {
+		t.Errorf("unknown team: err = %v, want ErrValidation", err)
+	}
+
+	tests := []struct {
+		req  *assembled.ListAgentsRequest
+		want []string
+	}{
+		{nil, []string{ada.ID, grace.ID}},
+		{&assembled.ListAgentsRequest{Team: "Tier 1"}, []string{ada.ID}},
+		{&assembled.ListAgentsRequest{Site: site.ID}, []string{ada.ID}},
+		{&assembled.ListAgentsRequest{Channels: []string{"chat"}}, []string{grace.ID}},
+	}
+	for _, tt := range tests {
+		resp, err := c.ListAgents(ctx, tt.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := keys(resp.Agents); !reflect.DeepEqual(got, sorted(tt.want)) {
+			t.Errorf("ListAgents(%+v) = %v, want %v", tt.req, got, tt.want)
+		}
+	}
+
+	updated, err := c.UpdateAgentFields(ctx, &assembled.UpdateAgentRequest{ID: ada.ID, Email: "ada@example.com"}, "email", "teams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Email != "ada@example.com" || len(updated.Teams) != 0 || updated.Site != site.ID || updated.Name != "Ada" {
+		t.Errorf("updated %+v", updated)
+	}
+	if got, _ := srv.Agent(ada.ID); got.Email != updated.Email || len(got.Teams) != 0 {
+		t.Errorf("stored %+v, returned %+v", got, *updated)
+	}
+	if _, err := c.UpdateAgent(ctx, &assembled.UpdateAgentRequest{ID: "nobody", Name: "X"}); !errors.Is(err, assembled.ErrNotFound) {
+		t.Errorf("unknown agent: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAgentStatus(t *testing.T) {
+	srv, c := newServer(t)
+	agent := srv.AddAgent(assembled.Agent{Name: "Ada"})
+
+	if _, err := c.GetAgentStatus(ctx, &assembled.GetAgentStatusRequest{ID: agent.ID}); !errors.Is(err, assembled.ErrNotFound) {
+		t.Errorf("no status yet: err = %v, want ErrNotFound", err)
+	}
+	for _, s := range []struct {
+		status string
+		start  time.Time
+	}{{"ready", at(1)}, {"busy", at(2)}, {"away", at(1.5)}} {
+		if _, err := c.CreateAgentStatus(ctx, &assembled.CreateAgentStatusRequest{AgentID: agent.ID, Status: s.status, StartTime: s.start}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The latest status by start time wins, even if it was received earlier.
+	got, err := c.GetAgentStatus(ctx, &assembled.GetAgentStatusRequest{ID: agent.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "busy" {
+		t.Errorf("status = %q, want busy", got.Status)
+	}
+	if n := len(srv.AgentStatuses(agent.ID)); n != 3 {
+		t.Errorf("logged %d statuses, want 3", n)
+	}
+	if _, err := c.CreateAgentStatus(ctx, &assembled.CreateAgentStatusRequest{AgentID: agent.ID, StartTime: at(3)}); !errors.Is(err, assembled.ErrValidation) {
+		t.Errorf("missing status: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	for _, kind := range assembled.FilterKinds {
+		t.Run(string(kind), func(t *testing.T) {
+			srv, c := newServer(t)
+
+			created, err := c.CreateFilters(ctx, kind, []assembled.Filter{{Name: "EMEA"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			parent := keys(created)[0]
+			child, err := c.CreateFilters(ctx, kind, []assembled.Filter{{Name: "Lisbon", ParentID: parent}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			childID := keys(child)[0]
+
+			list, err := c.ListFilters(ctx, kind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 2 || list[childID].ParentID != parent {
+				t.Errorf("listed %+v", list)
+			}
+
+			f, err := c.UpdateFilter(ctx, kind, &assembled.UpdateFilterRequest{ID: childID, Name: "Porto"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Name != "Porto" || f.ParentID != parent {
+				t.Errorf("renamed %+v", f)
+			}
+			if _, err := c.UpdateFilter(ctx, kind, &assembled.UpdateFilterRequest{ID: parent, ParentID: childID}); !errors.Is(err, assembled.ErrValidation) {
+				t.Errorf("cycle: err = %v, want ErrValidation", err)
+			}
+			f, err = c.UpdateFilterFields(ctx, kind, &assembled.UpdateFilterRequest{ID: childID}, "parent_id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.ParentID != "" || f.Name != "Porto" {
+				t.Errorf("moved to the top %+v", f)
+			}
+
+			if err := c.DeleteFilters(ctx, kind, []string{parent, childID}); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(srv.Filters(string(kind))); n != 0 {
+				t.Errorf("%d filters left", n)
+			}
+		})
+	}
+}
+
+func TestRequirements(t *testing.T) {
+	srv, c := newServer(t)
+	typ := srv.AddRequirementType(assembled.RequirementType{Name: "Phones"})
+	other := srv.AddRequirementType(assembled.RequirementType{Name: "Chat"})
+
+	types, err := c.ListRequirementTypes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(types.RequirementTypes); !reflect.DeepEqual(got, sorted([]string{typ.ID, other.ID})) {
+		t.Errorf("requirement types = %v", got)
+	}
+
+	for _, r := range []assembled.CreateRequirementRequest{
+		{RequirementTypeID: typ.ID, StartTime: at(0), EndTime: at(1), Required: 3},
+		{RequirementTypeID: typ.ID, StartTime: at(0), EndTime: at(1), Required: 5},
+		{RequirementTypeID: other.ID, StartTime: at(1), EndTime: at(2), Required: 1},
+	} {
+		if _, err := c.CreateRequirement(ctx, &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := c.ListRequirements(ctx, &assembled.ListRequirementsRequest{StartTime: at(0), EndTime: at(1), RequirementTypes: []string{typ.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Requirements) != 1 || resp.Requirements[0].Required != 5 {
+		t.Errorf("requirements = %+v, want the overwritten one", resp.Requirements)
+	}
+	if _, err := c.CreateRequirement(ctx, &assembled.CreateRequirementRequest{RequirementTypeID: "nope", StartTime: at(0), EndTime: at(1)}); !errors.Is(err, assembled.ErrValidation) {
+		t.Errorf("unknown type: err = %v, want ErrValidation", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	srv, _ := newServer(t)
+	c := assembled.NewClient("wrong", assembled.WithBaseURL(srv.URL), assembled.WithTelemetry(false))
+	if _, err := c.ListAgents(ctx, nil); !errors.Is(err, assembled.ErrUnauthorized) {
+		t.Errorf("err = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	srv, c := newServer(t)
+	srv.InjectFault(assembledtest.Fault{Method: "GET", PathPrefix: "/v0/agents", Times: 1, StatusCode: 503})
+
+	if _, err := c.ListActivityTypes(ctx); err != nil {
+		t.Errorf("unmatched request failed: %v", err)
+	}
+	var e *assembled.Error
+	if _, err := c.ListAgents(ctx, nil); !errors.As(err, &e) || e.StatusCode != 503 {
+		t.Errorf("err = %v, want 503", err)
+	}
+	if _, err := c.ListAgents(ctx, nil); err != nil {
+		t.Errorf("fault applied more than once: %v", err)
+	}
+
+	srv.RateLimitNext(1, time.Second)
+	if _, err := c.ListAgents(ctx, nil); !errors.As(err, &e) || e.RetryAfter != time.Second {
+		t.Errorf("err = %v, want 429 with Retry-After", err)
+	}
+
+	srv.SetLatency(20 * time.Millisecond)
+	begin := time.Now()
+	if _, err := c.ListAgents(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(begin); d < 20*time.Millisecond {
+		t.Errorf("request took %v despite 20ms of latency", d)
+	}
+	srv.ClearFaults()
+
+	reqs := srv.Requests()
+	if len(reqs) != 5 || reqs[1].Method != "GET" || reqs[1].Path != "/v0/agents" {
+		t.Errorf("requests = %+v", reqs)
+	}
+}
+
+func keys(m interface{}) []string {
+	var out []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		out = append(out, k.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sorted(s []string) []string {
+	s = append([]string(nil), s...)
+	sort.Strings(s)
+	return s
+}
@@ -4,48 +4,101 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"runtime"
+	"sync"
+	"time"
 
 	"github.com/google/go-querystring/query"
 )
 
+// Version is the version of this library, reported in the default
+// User-Agent header.
+const Version = "0.2.0"
+
+const (
+	DefaultBaseURL    = "https://api.assembledhq.com"
+	DefaultAPIVersion = "2019-06-20"
+)
+
 type Client struct {
 	Base            string
-	HTTP            http.Client
+	HTTP            *http.Client
 	EnableTelemetry bool
 
+	// Value of the API-Version header. Defaults to DefaultAPIVersion.
+	APIVersion string
+
+	// Value of the User-Agent header. Defaults to a string identifying this
+	// library and its version.
+	UserAgent string
+
+	// Retry controls how failed requests are retried. A nil policy disables
+	// retries.
+	Retry *RetryPolicy
+
+	// RateLimiter, if set, is waited on before every request attempt. A
+	// single limiter may be shared by several clients.
+	RateLimiter Limiter
+
+	// Observers receive a record of every request attempt, including its
+	// latency breakdown.
+	Observers []Observer
+
 	key     string
-	metrics chan *timing
+	timeout time.Duration
+
+	// Timings of completed requests, sent to Assembled with later requests.
+	metrics     chan *timing
+	metricsOnce sync.Once
 }
 
-func NewClient(key string) *Client {
+// NewClient returns a client authenticating with the given API key,
+// configured by any options passed.
+func NewClient(key string, opts ...Option) *Client {
 	c := &Client{
-		Base:            "https://api.assembledhq.com",
+		Base:            DefaultBaseURL,
+		HTTP:            &http.Client{},
 		EnableTelemetry: true,
+		APIVersion:      DefaultAPIVersion,
+		UserAgent:       defaultUserAgent,
+		Retry:           DefaultRetryPolicy(),
 		key:             key,
+		metrics:         make(chan *timing, telemetryBufferSize),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.timeout > 0 {
+		// Copy the client so that a shared *http.Client is left untouched.
+		var hc http.Client
+		if c.HTTP != nil {
+			hc = *c.HTTP
+		}
+		hc.Timeout = c.timeout
+		c.HTTP = &hc
 	}
 	return c
 }
 
-type Error struct {
-	message string `json:"message"`
-	code    int    `json:"code"`
-}
-
-func (e Error) Error() string {
-	return e.message
-}
+var defaultUserAgent = fmt.Sprintf("assembled-go/%s (%s; %s/%s)", Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
 
 func (c *Client) request(ctx context.Context, method, path string, params, in interface{}, out interface{}) error {
-	var body io.Reader
+	var payload []byte
+	if v, ok := in.(validator); ok {
+		if err := v.validate(); err != nil {
+			return err
+		}
+	}
 	if in != nil {
-		payload, err := json.Marshal(in)
+		var err error
+		payload, err = json.Marshal(in)
 		if err != nil {
 			return err
 		}
-		body = bytes.NewBuffer(payload)
 	}
 	if params != nil {
 		v, err := query.Values(params)
@@ -54,36 +107,128 @@ func (c *Client) request(ctx context.Context, method, path string, params, in in
 		}
 		path += "?" + v.Encode()
 	}
-	req, err := http.NewRequest(method, c.Base+path, body)
+
+	retry := c.Retry
+	if p, ok := ctx.Value(retryPolicyKey{}).(*RetryPolicy); ok {
+		retry = p
+	}
+	for attempt := 1; ; attempt++ {
+		if c.RateLimiter != nil {
+			if err := c.RateLimiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		err := c.do(ctx, method, path, payload, out, attempt)
+		if err == nil {
+			return nil
+		}
+		delay, ok := retry.next(ctx, method, attempt, err)
+		if !ok {
+			return err
+		}
+		if p, ok := c.RateLimiter.(pauser); ok && isRateLimited(err) {
+			// Hold back every request sharing the limiter, not just this one.
+			p.Pause(delay)
+		}
+		if sleep(ctx, delay) != nil {
+			return err
+		}
+	}
+}
+
+// do performs a single attempt of a request. The payload is re-buffered on
+// every call so that the body can be sent again on retry.
+func (c *Client) do(ctx context.Context, method, path string, payload []byte, out interface{}, attempt int) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	base := c.Base
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, body)
 	if err != nil {
 		return err
 	}
 
-	var cleanup func(*http.Response)
+	var trace *requestTrace
+	if c.EnableTelemetry || len(c.Observers) > 0 {
+		req, trace = traceRequest(req)
+	}
 	if c.EnableTelemetry {
-		req, cleanup = withTelemetry(ctx, c, req)
+		c.attachTelemetry(req)
 	}
 
-	req.SetBasicAuth(c.key, "")
-	req.Header.Set("API-Version", "2019-06-20")
-	resp, err := c.HTTP.Do(req.WithContext(ctx))
+	apiVersion := c.APIVersion
+	if apiVersion == "" {
+		apiVersion = DefaultAPIVersion
+	}
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
 
-	if c.EnableTelemetry {
-		defer func() {
-			cleanup(resp)
-		}()
+	req.SetBasicAuth(c.key, "")
+	req.Header.Set("API-Version", apiVersion)
+	req.Header.Set("User-Agent", userAgent)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := hc.Do(req)
+	if err == nil {
+		err = decodeResponse(resp, out)
+		resp.Body.Close()
 	}
 
-	if err != nil {
-		return err
+	if trace != nil {
+		// Finished after decoding so that the body decode time is measured.
+		trace.finish()
+		if c.EnableTelemetry && resp != nil {
+			c.recordTelemetry(trace, resp)
+		}
+		if len(c.Observers) > 0 {
+			c.observe(ctx, trace, method, path, attempt, resp, err)
+		}
 	}
-	defer resp.Body.Close()
+	return err
+}
+
+// retryPolicyKey is the context key of a retry policy used instead of the
+// client's own, for callers that retry differently.
+type retryPolicyKey struct{}
+
+func withRetryPolicy(ctx context.Context, p *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, p)
+}
+
+// validator is implemented by request bodies that can be checked before
+// they are sent.
+type validator interface {
+	validate() error
+}
+
+// bodyDecoder is implemented by response types that decode the body
+// themselves, for example to stream it.
+type bodyDecoder interface {
+	decodeBody(r io.Reader) error
+}
+
+func decodeResponse(resp *http.Response, out interface{}) error {
 	if resp.StatusCode != 200 {
-		message, _ := ioutil.ReadAll(resp.Body)
-		return Error{message: string(message), code: resp.StatusCode}
+		body, _ := ioutil.ReadAll(resp.Body)
+		return newError(resp, body)
 	}
-	if out == nil {
+	switch out := out.(type) {
+	case nil:
 		return nil
+	case bodyDecoder:
+		return out.decodeBody(resp.Body)
+	default:
+		return json.NewDecoder(resp.Body).Decode(out)
 	}
-	return json.NewDecoder(resp.Body).Decode(out)
 }
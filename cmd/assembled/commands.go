@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// command is a subcommand. Its run function returns the value to print, or
+// nil if there is nothing to print.
+type command struct {
+	run func(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error)
+}
+
+// result is the output of a command. Rows, if set, is what the table and CSV
+// formats print instead of Value; it is a map or slice of structs.
+type result struct {
+	Value interface{}
+	Rows  interface{}
+}
+
+var commands = map[string]map[string]command{
+	"agents": {
+		"list":   {listAgents},
+		"create": {createAgent},
+		"update": {updateAgent},
+	},
+	"activities": {
+		"list":   {listActivities},
+		"create": {createActivity},
+		"bulk":   {bulkActivities},
+		"delete": {deleteActivities},
+	},
+	"activity-types": {
+		"list":   {listActivityTypes},
+		"create": {createActivityType},
+		"delete": {deleteActivityType},
+	},
+	"agent-status": {
+		"get":    {getAgentStatus},
+		"list":   {listAgentStatuses},
+		"create": {createAgentStatus},
+	},
+	"requirements": {
+		"list":   {listRequirements},
+		"create": {createRequirement},
+	},
+	"requirement-types": {
+		"list": {listRequirementTypes},
+	},
+	"queues": filterCommands(assembled.FilterQueue),
+	"sites":  filterCommands(assembled.FilterSite),
+	"teams":  filterCommands(assembled.FilterTeam),
+	"skills": filterCommands(assembled.FilterSkill),
+}
+
+func listAgents(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.ListAgentsRequest
+	listVar(fs, &req.Channels, "channels", "only agents with these channels")
+	fs.StringVar(&req.Queue, "queue", "", "only agents in the queue with this name")
+	fs.StringVar(&req.Site, "site", "", "only agents at the site with this name")
+	fs.StringVar(&req.Team, "team", "", "only agents in the team with this name")
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	resp, err := e.client.ListAgents(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{resp, resp.Agents}, nil
+}
+
+func createAgent(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.CreateAgentRequest
+	fs.StringVar(&req.Name, "name", "", "name (required)")
+	fs.StringVar(&req.ImportID, "import-id", "", "third-party identifier")
+	fs.StringVar(&req.Email, "email", "", "email address")
+	listVar(fs, &req.Channels, "channels", "channels: phone, email or chat")
+	listVar(fs, &req.Queues, "queues", "queue IDs")
+	fs.StringVar(&req.Site, "site", "", "site ID")
+	listVar(fs, &req.Skills, "skills", "skill IDs")
+	listVar(fs, &req.Teams, "teams", "team IDs")
+	if err := parse(e, fs, args, &req); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "name"); err != nil {
+		return nil, err
+	}
+	agent, err := e.client.CreateAgent(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{agent, []assembled.Agent{*agent}}, nil
+}
+
+func updateAgent(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.UpdateAgentRequest
+	fs.StringVar(&req.ID, "id", "", "ID of the agent to update (required)")
+	fs.StringVar(&req.ImportID, "import-id", "", "third-party identifier")
+	fs.StringVar(&req.Name, "name", "", "name")
+	fs.StringVar(&req.Email, "email", "", "email address")
+	listVar(fs, &req.Channels, "channels", "channels: phone, email or chat")
+	listVar(fs, &req.Queues, "queues", "queue IDs")
+	fs.StringVar(&req.Site, "site", "", "site ID")
+	listVar(fs, &req.Skills, "skills", "skill IDs")
+	listVar(fs, &req.Teams, "teams", "team IDs")
+	var clear []string
+	listVar(fs, &clear, "clear", "JSON names of fields to clear, such as teams")
+	if err := parse(e, fs, args, &req); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "id"); err != nil {
+		return nil, err
+	}
+	var (
+		agent *assembled.Agent
+		err   error
+	)
+	if len(clear) > 0 {
+		var fields []assembled.AgentField
+		for _, f := range append(nonEmptyFields(&req), clear...) {
+			fields = append(fields, assembled.AgentField(f))
+		}
+		agent, err = e.client.UpdateAgentFields(ctx, &req, fields...)
+	} else {
+		agent, err = e.client.UpdateAgent(ctx, &req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result{agent, []assembled.Agent{*agent}}, nil
+}
+
+func listActivities(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.ListActivitiesRequest
+	timeVar(fs, &req.StartTime, "start", "start of the time window (required)")
+	timeVar(fs, &req.EndTime, "end", "end of the time window (required)")
+	listVar(fs, &req.Agents, "agents", "only activities of these agent IDs")
+	listVar(fs, &req.Types, "types", "only activities of these type IDs")
+	fs.StringVar(&req.Team, "team", "", "only activities of agents in this team")
+	fs.StringVar(&req.Channel, "channel", "", "only activities for this channel")
+	fs.StringVar(&req.ScheduleID, "schedule", "", "schedule ID (default the master schedule)")
+	fs.BoolVar(&req.IncludeAgents, "include-agents", false, "include the agents of the activities")
+	fs.BoolVar(&req.IncludeActivityTypes, "include-activity-types", false, "include the types of the activities")
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "start", "end"); err != nil {
+		return nil, err
+	}
+	resp, err := e.client.ListActivitiesChunked(ctx, &req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &result{resp, resp.Activities}, nil
+}
+
+func createActivity(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.CreateActivityRequest
+	fs.StringVar(&req.AgentID, "agent", "", "agent ID (required)")
+	fs.StringVar(&req.TypeID, "type", "", "activity type ID (required)")
+	timeVar(fs, &req.StartTime, "start", "start time (required)")
+	timeVar(fs, &req.EndTime, "end", "end time (required)")
+	fs.StringVar(&req.Description, "description", "", "description")
+	fs.StringVar(&req.ScheduleID, "schedule", "", "schedule ID (default the master schedule)")
+	fs.BoolVar(&req.AllowConflicts, "allow-conflicts", false, "keep overlapping activities instead of replacing them")
+	if err := parse(e, fs, args, &req); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "agent", "type", "start", "end"); err != nil {
+		return nil, err
+	}
+	activity, err := e.client.CreateActivity(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{activity, []assembled.Activity{*activity}}, nil
+}
+
+func bulkActivities(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.CreateBulkActivityRequest
+	fs.StringVar(&req.ScheduleID, "schedule", "", "schedule ID (default the master schedule)")
+	if err := parse(e, fs, args, &req); err != nil {
+		return nil, err
+	}
+	if len(req.Activities) == 0 {
+		return nil, usagef("no activities; pass them with -json")
+	}
+	resp, err := e.client.CreateBulkActivity(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{resp, resp.Activities}, nil
+}
+
+func deleteActivities(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.DeleteActivitiesRequest
+	listVar(fs, &req.AgentIDs, "agents", "agent IDs (required)")
+	timeVar(fs, &req.StartTime, "start", "start of the time window (required)")
+	timeVar(fs, &req.EndTime, "end", "end of the time window (required)")
+	fs.StringVar(&req.ScheduleID, "schedule", "", "schedule ID (default the master schedule)")
+	if err := parse(e, fs, args, &req); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "agents", "start", "end"); err != nil {
+		return nil, err
+	}
+	return nil, e.client.DeleteActivities(ctx, &req)
+}
+
+func listActivityTypes(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	resp, err := e.client.ListActivityTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &result{resp, resp.ActivityTypes}, nil
+}
+
+func createActivityType(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.CreateActivityTypeRequest
+	fs.StringVar(&req.Name, "name", "", "name (required)")
+	fs.StringVar(&req.ShortName, "short-name", "", "abbreviated name")
+	fs.StringVar(&req.ImportID, "import-id", "", "third-party identifier")
+	fs.StringVar(&req.Value, "value", "", "value")
+	fs.StringVar(&req.BackgroundColor, "background-color", "", "background color as a hex string")
+	fs.StringVar(&req.FontColor, "font-color", "", "font color as a hex string")
+	listVar(fs, &req.Channels, "channels", "channels: phone, email or chat")
+	fs.BoolVar(&req.Productive, "productive", false, "whether the activity is productive")
+	fs.BoolVar(&req.Timeoff, "timeoff", false, "whether the activity is time off")
+	if err := parse(e, fs, args, &req); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "name"); err != nil {
+		return nil, err
+	}
+	t, err := e.client.CreateActivityType(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{t, []assembled.ActivityType{*t}}, nil
+}
+
+func deleteActivityType(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.DeleteActivityTypeRequest
+	fs.StringVar(&req.ID, "id", "", "ID of the activity type to delete (required)")
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "id"); err != nil {
+		return nil, err
+	}
+	t, err := e.client.DeleteActivityType(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{t, []assembled.ActivityType{*t}}, nil
+}
+
+func getAgentStatus(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.GetAgentStatusRequest
+	fs.StringVar(&req.ID, "agent", "", "agent ID (required)")
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "agent"); err != nil {
+		return nil, err
+	}
+	status, err := e.client.GetAgentStatus(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{status, []assembled.AgentStatus{*status}}, nil
+}
+
+func listAgentStatuses(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var (
+		req   assembled.GetAgentStatusesRequest
+		scope assembled.ListAgentsRequest
+	)
+	listVar(fs, &req.IDs, "agents", "agent IDs")
+	fs.StringVar(&scope.Queue, "queue", "", "only agents in the queue with this name")
+	fs.StringVar(&scope.Site, "site", "", "only agents at the site with this name")
+	fs.StringVar(&scope.Team, "team", "", "only agents in the team with this name")
+	fs.IntVar(&req.Concurrency, "concurrency", 8, "number of statuses fetched at once")
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	if len(req.IDs) == 0 || scope.Queue != "" || scope.Site != "" || scope.Team != "" {
+		req.Scope = &scope
+	}
+	resp, err := e.client.GetAgentStatuses(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for id := range resp.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !errors.Is(resp.Errors[id], assembled.ErrNotFound) {
+			fmt.Fprintf(e.stderr, "agent %s: %v\n", id, resp.Errors[id])
+		}
+	}
+	rows := make([]assembled.AgentStatus, 0, len(resp.Statuses))
+	for _, s := range resp.Statuses {
+		rows = append(rows, s)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].AgentID < rows[j].AgentID })
+	return &result{resp.Statuses, rows}, nil
+}
+
+func createAgentStatus(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.CreateAgentStatusRequest
+	fs.StringVar(&req.AgentID, "agent", "", "agent ID")
+	fs.StringVar(&req.AgentName, "agent-name", "", "agent name, if no ID is given")
+	fs.StringVar(&req.Status, "status", "", "status (required)")
+	fs.StringVar(&req.Channel, "channel", "", "channel")
+	fs.StringVar(&req.EventID, "event-id", "", "identifier of the event, for deduplication")
+	timeVar(fs, &req.StartTime, "start", "start time (required)")
+	timeVar(fs, &req.EndTime, "end", "end time")
+	if err := parse(e, fs, args, &req); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "status", "start"); err != nil {
+		return nil, err
+	}
+	if req.AgentID == "" && req.AgentName == "" {
+		return nil, usagef("missing -agent or -agent-name")
+	}
+	status, err := e.client.CreateAgentStatus(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{status, []assembled.AgentStatus{*status}}, nil
+}
+
+func listRequirements(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.ListRequirementsRequest
+	timeVar(fs, &req.StartTime, "start", "start of the time window (required)")
+	timeVar(fs, &req.EndTime, "end", "end of the time window (required)")
+	listVar(fs, &req.RequirementTypes, "types", "only requirements of these type IDs")
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "start", "end"); err != nil {
+		return nil, err
+	}
+	resp, err := e.client.ListRequirements(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{resp, resp.Requirements}, nil
+}
+
+func createRequirement(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	var req assembled.CreateRequirementRequest
+	fs.StringVar(&req.RequirementTypeID, "type", "", "requirement type ID (required)")
+	timeVar(fs, &req.StartTime, "start", "start time (required)")
+	timeVar(fs, &req.EndTime, "end", "end time (required)")
+	fs.IntVar(&req.Required, "required", 0, "number of agents required")
+	if err := parse(e, fs, args, &req); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "type", "start", "end"); err != nil {
+		return nil, err
+	}
+	r, err := e.client.CreateRequirement(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return &result{r, []assembled.Requirement{*r}}, nil
+}
+
+func listRequirementTypes(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	resp, err := e.client.ListRequirementTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &result{resp, resp.RequirementTypes}, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// filterCommands returns the commands managing one kind of filter.
+func filterCommands(kind assembled.FilterKind) map[string]command {
+	return map[string]command{
+		"list": {func(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+			return listFilters(ctx, e, fs, args, kind)
+		}},
+		"create": {func(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+			return createFilters(ctx, e, fs, args, kind)
+		}},
+		"update": {func(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+			return updateFilter(ctx, e, fs, args, kind)
+		}},
+		"delete": {func(ctx context.Context, e *env, fs *flag.FlagSet, args []string) (*result, error) {
+			return deleteFilters(ctx, e, fs, args, kind)
+		}},
+	}
+}
+
+func listFilters(ctx context.Context, e *env, fs *flag.FlagSet, args []string, kind assembled.FilterKind) (*result, error) {
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	filters, err := e.client.ListFilters(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+	return &result{filters, filters}, nil
+}
+
+func createFilters(ctx context.Context, e *env, fs *flag.FlagSet, args []string, kind assembled.FilterKind) (*result, error) {
+	var (
+		f       assembled.Filter
+		filters []assembled.Filter
+	)
+	fs.StringVar(&f.Name, "name", "", "name")
+	fs.StringVar(&f.ParentID, "parent", "", "parent ID")
+	if err := parse(e, fs, args, &filters); err != nil {
+		return nil, err
+	}
+	if f.Name != "" {
+		filters = append(filters, f)
+	} else if f.ParentID != "" {
+		return nil, usagef("missing -name")
+	}
+	if len(filters) == 0 {
+		return nil, usagef("missing -name or -json")
+	}
+	created, err := e.client.CreateFilters(ctx, kind, filters)
+	if err != nil {
+		return nil, err
+	}
+	return &result{created, created}, nil
+}
+
+func updateFilter(ctx context.Context, e *env, fs *flag.FlagSet, args []string, kind assembled.FilterKind) (*result, error) {
+	var req assembled.UpdateFilterRequest
+	fs.StringVar(&req.ID, "id", "", "ID of the "+kind.Singular()+" to update (required)")
+	fs.StringVar(&req.Name, "name", "", "new name")
+	fs.StringVar(&req.ParentID, "parent", "", "new parent ID")
+	root := fs.Bool("root", false, "remove the parent, making the "+kind.Singular()+" a root")
+	if err := parse(e, fs, args, &req); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "id"); err != nil {
+		return nil, err
+	}
+	var (
+		f   *assembled.Filter
+		err error
+	)
+	if *root {
+		if req.ParentID != "" {
+			return nil, usagef("-root and -parent are mutually exclusive")
+		}
+		fields := []assembled.FilterField{assembled.FilterFieldParentID}
+		for _, name := range nonEmptyFields(&req) {
+			fields = append(fields, assembled.FilterField(name))
+		}
+		f, err = e.client.UpdateFilterFields(ctx, kind, &req, fields...)
+	} else {
+		f, err = e.client.UpdateFilter(ctx, kind, &req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result{f, []assembled.Filter{*f}}, nil
+}
+
+func deleteFilters(ctx context.Context, e *env, fs *flag.FlagSet, args []string, kind assembled.FilterKind) (*result, error) {
+	var ids []string
+	listVar(fs, &ids, "ids", "IDs of the "+string(kind)+" to delete (required)")
+	if err := parse(e, fs, args, nil); err != nil {
+		return nil, err
+	}
+	if err := require(fs, "ids"); err != nil {
+		return nil, err
+	}
+	return nil, e.client.DeleteFilters(ctx, kind, ids)
+}
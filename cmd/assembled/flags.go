@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// env is what commands run with.
+type env struct {
+	client *assembled.Client
+	stdin  io.Reader
+	stderr io.Writer // For warnings; results go to stdout.
+}
+
+// usageError is returned for invalid command-line arguments.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// listValue is a flag holding comma-separated values. Setting it replaces
+// the previous value, including one decoded from -json.
+type listValue struct {
+	p *[]string
+}
+
+func (v listValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.p = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.p = append(*v.p, item)
+		}
+	}
+	return nil
+}
+
+// timeValue is a flag holding a time as RFC 3339, as a date and time or a
+// date in the local time zone, or as Unix seconds.
+type timeValue struct {
+	p *time.Time
+}
+
+var timeLayouts = []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+func (v timeValue) String() string {
+	if v.p == nil || v.p.IsZero() || v.p.Unix() == 0 {
+		return ""
+	}
+	return v.p.Format(time.RFC3339)
+}
+
+func (v timeValue) Set(s string) error {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		*v.p = t
+		return nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			*v.p = t
+			return nil
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*v.p = time.Unix(n, 0)
+		return nil
+	}
+	return fmt.Errorf("invalid time %q; use RFC 3339, YYYY-MM-DD[THH:MM] or Unix seconds", s)
+}
+
+func listVar(fs *flag.FlagSet, p *[]string, name, usage string) {
+	fs.Var(listValue{p}, name, usage+" (comma-separated)")
+}
+
+func timeVar(fs *flag.FlagSet, p *time.Time, name, usage string) {
+	fs.Var(timeValue{p}, name, usage)
+}
+
+// parse parses args into the flags of fs, which are bound to the fields of
+// req. If req is not nil, a -json flag is added whose value is decoded into
+// req before the other flags are applied, so that they override its fields.
+func parse(e *env, fs *flag.FlagSet, args []string, req interface{}) error {
+	// Hold the flags back while parsing, until the request is decoded. The
+	// original values are put back before printing the usage, which
+	// describes flags by their type.
+	var deferred []*deferredValue
+	fs.VisitAll(func(f *flag.Flag) {
+		v := &deferredValue{Value: f.Value, flag: f}
+		f.Value = v
+		deferred = append(deferred, v)
+	})
+	restore := func() {
+		for _, v := range deferred {
+			v.flag.Value = v.Value
+		}
+	}
+	fs.Usage = func() {
+		restore()
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	var input string
+	if req != nil {
+		fs.StringVar(&input, "json", "", "request as JSON, @file to read it from a file or - for standard input")
+	}
+	err := fs.Parse(args)
+	restore()
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if input != "" {
+		if err := decodeInput(e, input, req); err != nil {
+			return err
+		}
+	}
+	for _, v := range deferred {
+		if err := v.apply(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeInput decodes the value of a -json flag into req.
+func decodeInput(e *env, input string, req interface{}) error {
+	var (
+		b   []byte
+		err error
+	)
+	switch {
+	case input == "-":
+		b, err = ioutil.ReadAll(e.stdin)
+	case strings.HasPrefix(input, "@"):
+		b, err = ioutil.ReadFile(input[1:])
+	default:
+		b = []byte(input)
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, req); err != nil {
+		return usagef("decoding -json: %v", err)
+	}
+	return nil
+}
+
+// deferredValue records the values a flag is set to, and sets them when
+// applied.
+type deferredValue struct {
+	flag.Value
+	flag *flag.Flag
+	sets []string
+}
+
+func (v *deferredValue) Set(s string) error {
+	v.sets = append(v.sets, s)
+	return nil
+}
+
+func (v *deferredValue) IsBoolFlag() bool {
+	b, ok := v.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func (v *deferredValue) apply() error {
+	for _, s := range v.sets {
+		if err := v.Value.Set(s); err != nil {
+			return usagef("invalid value %q for flag -%s: %v", s, v.flag.Name, err)
+		}
+	}
+	return nil
+}
+
+// require returns a usage error if any of the named flags has no value.
+func require(fs *flag.FlagSet, names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if f := fs.Lookup(name); f == nil || f.Value.String() == "" {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return usagef("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// nonEmptyFields returns the JSON names of the non-empty fields of the
+// request pointed to by req, other than its ID.
+func nonEmptyFields(req interface{}) []string {
+	v := reflect.ValueOf(req).Elem()
+	var fields []string
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || name == "id" {
+			continue
+		}
+		if f := v.Field(i); f.Kind() == reflect.Slice && f.Len() > 0 || f.Kind() == reflect.String && f.Len() > 0 {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
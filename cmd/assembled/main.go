@@ -0,0 +1,201 @@
+// Command assembled is a command-line interface to the Assembled API.
+//
+// Usage:
+//
+//	assembled [global flags] <resource> <action> [flags]
+//
+// For example:
+//
+//	assembled agents list -team "Tier 1"
+//	assembled activities create -agent agent_1 -type type_1 -start 2020-01-06T09:00:00Z -end 2020-01-06T10:00:00Z
+//	assembled -o table teams list
+//
+// Requests may also be given as JSON with -json, either inline, as @file or
+// as - for standard input. Flags given alongside -json override its fields.
+//
+// The API key is read from the -key flag, the ASSEMBLED_API_KEY environment
+// variable or the api_key field of the config file, in that order. The config
+// file is a JSON object read from -config, ASSEMBLED_CONFIG or
+// assembled/config.json in the user config directory:
+//
+//	{"api_key": "sk_live_...", "base_url": "https://api.assembledhq.com", "output": "table"}
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// config is the contents of the config file.
+type config struct {
+	APIKey  string `json:"api_key"`
+	BaseURL string `json:"base_url"`
+	Output  string `json:"output"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("assembled", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		key        = fs.String("key", "", "API key (default $ASSEMBLED_API_KEY)")
+		configPath = fs.String("config", "", "path of the config file (default $ASSEMBLED_CONFIG)")
+		baseURL    = fs.String("base-url", "", "base URL of the API")
+		output     = fs.String("o", "", "output format: json, table or csv (default json)")
+		timeout    = fs.Duration("timeout", time.Minute, "timeout of each request")
+	)
+	fs.Usage = func() { usage(stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 2 {
+		usage(stderr, fs)
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(stderr, "assembled:", err)
+		return 1
+	}
+	if *key == "" {
+		*key = os.Getenv("ASSEMBLED_API_KEY")
+	}
+	if *key == "" {
+		*key = cfg.APIKey
+	}
+	if *baseURL == "" {
+		*baseURL = cfg.BaseURL
+	}
+	if *output == "" {
+		*output = cfg.Output
+	}
+	if *output == "" {
+		*output = "json"
+	}
+	format, ok := formats[*output]
+	if !ok {
+		fmt.Fprintf(stderr, "assembled: unknown output format %q\n", *output)
+		return 2
+	}
+
+	resource, action := fs.Arg(0), fs.Arg(1)
+	cmd, ok := commands[resource][action]
+	if !ok {
+		fmt.Fprintf(stderr, "assembled: unknown command %q\n", resource+" "+action)
+		usage(stderr, fs)
+		return 2
+	}
+	if *key == "" {
+		fmt.Fprintln(stderr, "assembled: no API key; set -key, ASSEMBLED_API_KEY or api_key in the config file")
+		return 1
+	}
+
+	opts := []assembled.Option{assembled.WithTimeout(*timeout)}
+	if *baseURL != "" {
+		opts = append(opts, assembled.WithBaseURL(*baseURL))
+	}
+	env := &env{client: assembled.NewClient(*key, opts...), stdin: stdin, stderr: stderr}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	cmdFlags := flag.NewFlagSet(resource+" "+action, flag.ContinueOnError)
+	cmdFlags.SetOutput(stderr)
+	res, err := cmd.run(ctx, env, cmdFlags, fs.Args()[2:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if errors.As(err, new(usageError)) {
+		fmt.Fprintf(stderr, "assembled %s %s: %v\n", resource, action, err)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "assembled:", err)
+		return 1
+	}
+	if res == nil {
+		return 0
+	}
+	if err := format(stdout, res); err != nil {
+		fmt.Fprintln(stderr, "assembled:", err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: assembled [global flags] <resource> <action> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	var resources []string
+	for r := range commands {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+	for _, r := range resources {
+		var actions []string
+		for a := range commands[r] {
+			actions = append(actions, a)
+		}
+		sort.Strings(actions)
+		fmt.Fprintf(w, "  %-18s %s\n", r, strings.Join(actions, "|"))
+	}
+	fmt.Fprintln(w, "\nRun \"assembled <resource> <action> -h\" for the flags of a command.")
+	fmt.Fprintln(w, "\nGlobal flags:")
+	fs.PrintDefaults()
+}
+
+// loadConfig reads the config file at path, or at the default location if
+// path is empty. A missing default config file is not an error.
+func loadConfig(path string) (*config, error) {
+	explicit := path != ""
+	if path == "" {
+		path = os.Getenv("ASSEMBLED_CONFIG")
+		explicit = path != ""
+	}
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return &config{}, nil
+		}
+		path = filepath.Join(dir, "assembled", "config.json")
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestRun")
+
+func TestMain(m *testing.M) {
+	// Times are printed in the local time zone, and the API key of the
+	// environment would take precedence over the config file.
+	time.Local = time.UTC
+	os.Unsetenv("ASSEMBLED_API_KEY")
+	os.Exit(m.Run())
+}
+
+var start = time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC)
+
+// newTestServer returns a fake API with two agents in two teams, an activity
+// type and a status.
+func newTestServer(t *testing.T) *assembledtest.Server {
+	srv := assembledtest.NewServer()
+	srv.Now = func() time.Time { return start }
+	t.Cleanup(srv.Close)
+	tier1 := srv.AddFilter("teams", assembled.Filter{Name: "Tier 1"})
+	tier2 := srv.AddFilter("teams", assembled.Filter{Name: "Tier 2", ParentID: tier1.ID})
+	ada := srv.AddAgent(assembled.Agent{Name: "Ada", Email: "ada@example.com", Channels: []string{"chat"}, Teams: []string{tier1.ID}})
+	srv.AddAgent(assembled.Agent{Name: "Grace", Email: "grace@example.com", Teams: []string{tier2.ID}})
+	srv.AddActivityType(assembled.ActivityType{Name: "Phones", Productive: true})
+	_, err := srv.Client().CreateAgentStatus(context.Background(), &assembled.CreateAgentStatusRequest{
+		AgentID: ada.ID, Status: "ready", Channel: "chat", StartTime: start,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// TestRun runs commands against a fake API and compares their exit code and
+// output with testdata/<name>.golden. Run with -update to rewrite the files.
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+	}{
+		{"agents-list", []string{"agents", "list"}, ""},
+		{"agents-list-table", []string{"-o", "table", "agents", "list", "-team", "Tier 1"}, ""},
+		{"agents-update-clear", []string{"agents", "update", "-id", "agent_3", "-name", "Ada L", "-clear", "teams"}, ""},
+		{"teams-list-csv", []string{"-o", "csv", "teams", "list"}, ""},
+		{"teams-update-root", []string{"-o", "table", "teams", "update", "-id", "team_2", "-root"}, ""},
+		{"teams-delete", []string{"teams", "delete", "-ids", "team_2"}, ""},
+		{"activities-create-json", []string{"activities", "create",
+			"-json", `{"agent_id":"agent_3","type_id":"activity_type_5","start_time":1614848400,"end_time":1614852000,"description":"from JSON"}`,
+			"-description", "from flags"}, ""},
+		{"activities-create-stdin", []string{"-o", "csv", "activities", "create", "-json", "-", "-end", "2021-03-04T11:00:00Z"},
+			`{"agent_id":"agent_4","type_id":"activity_type_5","start_time":1614848400,"end_time":1614852000}`},
+		{"activities-create-missing", []string{"activities", "create", "-agent", "agent_3"}, ""},
+		{"activity-types-list-table", []string{"-o", "table", "activity-types", "list"}, ""},
+		{"agent-status-list-table", []string{"-o", "table", "agent-status", "list"}, ""},
+		{"agent-status-get-unknown", []string{"agent-status", "get", "-agent", "nobody"}, ""},
+		{"unknown-command", []string{"agents", "frobnicate"}, ""},
+		{"bad-format", []string{"-o", "yaml", "agents", "list"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			config := filepath.Join(t.TempDir(), "config.json")
+			if err := ioutil.WriteFile(config, []byte(`{"api_key": "`+srv.APIKey+`"}`), 0600); err != nil {
+				t.Fatal(err)
+			}
+			args := append([]string{"-config", config, "-base-url", srv.URL}, tt.args...)
+			var stdout, stderr bytes.Buffer
+			code := run(args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			got := fmt.Sprintf("exit %d\n-- stdout --\n%s-- stderr --\n%s", code, stdout.String(), stderr.String())
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("assembled %s:\n%s\nwant:\n%s", strings.Join(tt.args, " "), got, want)
+			}
+		})
+	}
+}
+
+func TestTabulate(t *testing.T) {
+	type row struct {
+		Name  string   `json:"name"`
+		Tags  []string `json:"tags,omitempty"`
+		Debug string   `json:"-"`
+	}
+	tests := []struct {
+		rows   interface{}
+		header string
+		cells  string
+	}{
+		{[]row{{Name: "a", Tags: []string{"x", "y"}}}, "name,tags", "a,x;y"},
+		{map[string]*row{"2": {Name: "b"}, "1": {Name: "a"}, "3": nil}, "name,tags", "a,|b,|,"},
+		{map[string]string{"b": "2", "a": "1"}, "value", "1|2"},
+		{[]int{3, 4}, "value", "3|4"},
+		{"not rows", "", ""},
+	}
+	for _, tt := range tests {
+		header, rows := tabulate(&result{Rows: tt.rows})
+		var cells []string
+		for _, r := range rows {
+			cells = append(cells, strings.Join(r, ","))
+		}
+		if h, c := strings.Join(header, ","), strings.Join(cells, "|"); h != tt.header || c != tt.cells {
+			t.Errorf("tabulate(%#v) = %q, %q, want %q, %q", tt.rows, h, c, tt.header, tt.cells)
+		}
+	}
+}
+
+// countValue is a flag counting how many times it is set.
+type countValue struct{ n *int }
+
+func (v countValue) String() string   { return "" }
+func (v countValue) Set(string) error { *v.n++; return nil }
+
+func TestParseJSON(t *testing.T) {
+	var (
+		req  assembled.CreateAgentRequest
+		sets int
+	)
+	fs := flag.NewFlagSet("agents create", flag.ContinueOnError)
+	fs.StringVar(&req.Name, "name", "", "name")
+	listVar(fs, &req.Teams, "teams", "team IDs")
+	fs.Var(countValue{&sets}, "count", "")
+	e := &env{stdin: strings.NewReader(`{"name":"Ada","email":"ada@example.com","teams":["t1"]}`)}
+
+	if err := parse(e, fs, []string{"-json", "-", "-teams", "t2,t3", "-count", "x"}, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "Ada" || req.Email != "ada@example.com" || strings.Join(req.Teams, ",") != "t2,t3" {
+		t.Errorf("parsed %+v", req)
+	}
+	if sets != 1 {
+		t.Errorf("-count set %d times, want 1", sets)
+	}
+}
+
+func TestParseInvalidValue(t *testing.T) {
+	var when time.Time
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	timeVar(fs, &when, "start", "start")
+	err := parse(&env{}, fs, []string{"-start", "soon"}, nil)
+	if _, ok := err.(usageError); !ok || !strings.Contains(err.Error(), `invalid value "soon" for flag -start`) {
+		t.Errorf("err = %v, want a usage error", err)
+	}
+}
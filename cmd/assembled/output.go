@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// formats prints the result of a command.
+var formats = map[string]func(w io.Writer, r *result) error{
+	"json":  printJSON,
+	"table": printTable,
+	"csv":   printCSV,
+}
+
+func printJSON(w io.Writer, r *result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Value)
+}
+
+func printTable(w io.Writer, r *result) error {
+	header, rows := tabulate(r)
+	if len(rows) == 0 {
+		return nil
+	}
+	// Drop columns that are empty in every row.
+	keep := make([]bool, len(header))
+	for _, row := range rows {
+		for i, cell := range row {
+			keep[i] = keep[i] || cell != ""
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		var cells []string
+		for i, cell := range row {
+			if keep[i] {
+				cells = append(cells, cell)
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func printCSV(w io.Writer, r *result) error {
+	header, rows := tabulate(r)
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
+
+// tabulate flattens the rows of a result, a map or slice of structs, into
+// cells. Columns are the JSON names of the struct fields, in field order.
+// Maps are ordered by key. Elements other than structs, or pointers to them,
+// are printed in a single value column.
+func tabulate(r *result) ([]string, [][]string) {
+	v := reflect.ValueOf(r.Rows)
+	var elems []reflect.Value
+	switch v.Kind() {
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			elems = append(elems, v.MapIndex(k))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, v.Index(i))
+		}
+	default:
+		return nil, nil
+	}
+
+	t := v.Type().Elem()
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		t = t.Elem()
+		for i, elem := range elems {
+			if elem.IsNil() {
+				elems[i] = reflect.Zero(t)
+			} else {
+				elems[i] = elem.Elem()
+			}
+		}
+	}
+	if t.Kind() != reflect.Struct {
+		rows := make([][]string, len(elems))
+		for i, elem := range elems {
+			rows[i] = []string{cell(elem.Interface())}
+		}
+		return []string{"value"}, rows
+	}
+
+	var (
+		header []string
+		fields []int
+	)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	rows := make([][]string, len(elems))
+	for i, elem := range elems {
+		row := make([]string, len(fields))
+		for j, f := range fields {
+			row[j] = cell(elem.Field(f).Interface())
+		}
+		rows[i] = row
+	}
+	return header, rows
+}
+
+func cell(v interface{}) string {
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() || v.Unix() == 0 {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, ";")
+	case bool:
+		if !v {
+			return ""
+		}
+		return "true"
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,145 @@
+package csvio
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+var (
+	activityColumns = []string{"id", "action", "schedule_id", "agent", "type", "start", "end", "description"}
+	activityAliases = map[string]string{
+		"activity_id":   "id",
+		"schedule":      "schedule_id",
+		"agent_id":      "agent",
+		"activity_type": "type",
+		"activity type": "type",
+		"type_id":       "type",
+		"start_time":    "start",
+		"end_time":      "end",
+	}
+)
+
+// ActivityRow is an activity request read from a CSV file, with names
+// resolved to IDs.
+type ActivityRow struct {
+	Line       int
+	ScheduleID string
+	Request    assembled.ActivityRequest
+}
+
+// ReadActivities reads activity requests with the columns id, action,
+// schedule_id, agent, type, start, end and description. The action is one of
+// create, update or delete and defaults to create. Agents may be given by
+// name, email, import ID or ID, and types by name or ID. Times are RFC 3339,
+// or "2006-01-02 15:04" in the location of opts.
+//
+// All problems found are returned together as Errors.
+func ReadActivities(r io.Reader, res *Resolver, opts *Options) ([]ActivityRow, error) {
+	t, err := newTable(r, activityColumns, activityAliases, nil, opts.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []ActivityRow
+	for {
+		ok, err := t.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		action := t.get("action")
+		if action == "" {
+			action = "create"
+		}
+		a := assembled.Activity{ID: t.get("id"), Description: t.get("description")}
+		switch action {
+		case "create", "update":
+			a.AgentID = t.resolve(res, assembled.EntityAgent, "agent")
+			a.TypeID = t.resolve(res, assembled.EntityActivityType, "type")
+			a.StartTime = t.time("start")
+			a.EndTime = t.time("end")
+			if action == "create" && (t.get("agent") == "" || t.get("type") == "") {
+				t.fail("", fmt.Errorf("agent and type are required to create an activity"))
+			}
+			if !a.StartTime.IsZero() && !a.EndTime.After(a.StartTime) {
+				t.fail("end", fmt.Errorf("must be after start"))
+			}
+		case "delete":
+		default:
+			t.fail("action", fmt.Errorf("invalid action %q", action))
+		}
+		if action != "create" && a.ID == "" {
+			t.fail("id", fmt.Errorf("required to %s an activity", action))
+		}
+		rows = append(rows, ActivityRow{
+			Line:       t.line,
+			ScheduleID: t.get("schedule_id"),
+			Request:    assembled.ActivityRequest{Action: action, Activity: a},
+		})
+	}
+	if len(t.errs) > 0 {
+		return rows, t.errs
+	}
+	return rows, nil
+}
+
+// WriteActivities writes activities ordered by start time, with the IDs of
+// their agents, since agent names are often shared, and the names of their
+// types.
+func WriteActivities(w io.Writer, activities []assembled.Activity, res *Resolver, opts *Options) error {
+	o := opts.withDefaults()
+	sorted := append([]assembled.Activity(nil), activities...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].StartTime.Equal(sorted[j].StartTime) {
+			return sorted[i].StartTime.Before(sorted[j].StartTime)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "agent", "type", "start", "end", "description"})
+	for _, a := range sorted {
+		cw.Write([]string{
+			a.ID,
+			a.AgentID,
+			res.name(assembled.EntityActivityType, a.TypeID),
+			a.StartTime.In(o.Location).Format(o.TimeLayout),
+			a.EndTime.In(o.Location).Format(o.TimeLayout),
+			a.Description,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ApplyActivities sends the rows through CreateBulkActivityBatched. The
+// results of the report are in the order of rows; rows that were not
+// committed are also returned as Errors. Those whose outcome is unknown may
+// still have been created: see BulkActivityReport.Unknown.
+func ApplyActivities(ctx context.Context, c *assembled.Client, rows []ActivityRow, opts *assembled.BulkActivityOptions) (*assembled.BulkActivityReport, error) {
+	items := make([]assembled.BulkActivityItem, len(rows))
+	for i, row := range rows {
+		items[i] = assembled.BulkActivityItem{ScheduleID: row.ScheduleID, Request: row.Request}
+	}
+	report, err := c.CreateBulkActivityBatched(ctx, items, opts)
+	if report == nil {
+		return nil, err
+	}
+	var errs Errors
+	for _, r := range report.Results {
+		if r.Outcome != assembled.BulkCommitted {
+			errs = append(errs, &RowError{Line: rows[r.Index].Line, Err: r.Err})
+		}
+	}
+	if len(errs) > 0 {
+		return report, errs
+	}
+	return report, nil
+}
@@ -0,0 +1,217 @@
+package csvio
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+var (
+	agentColumns = []string{"id", "import_id", "name", "email", "channels", "queues", "site", "skills", "teams"}
+	agentAliases = map[string]string{
+		"agent_id":  "id",
+		"agent id":  "id",
+		"import id": "import_id",
+		"channel":   "channels",
+		"queue":     "queues",
+		"skill":     "skills",
+		"team":      "teams",
+	}
+)
+
+// AgentRow is an agent read from a CSV file, with names resolved to IDs.
+type AgentRow struct {
+	Line  int
+	Agent assembled.Agent
+
+	// Columns present in the file. Only these are changed when updating an
+	// existing agent.
+	Columns []string
+}
+
+// ReadAgents reads agents with the columns id, import_id, name, email,
+// channels, queues, site, skills and teams. Queues, sites, skills and teams
+// may be given by name or ID. Every row needs an id, import_id or name.
+//
+// All problems found are returned together as Errors.
+func ReadAgents(r io.Reader, res *Resolver, opts *Options) ([]AgentRow, error) {
+	t, err := newTable(r, agentColumns, agentAliases, nil, opts.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for _, c := range agentColumns {
+		if t.has(c) {
+			columns = append(columns, c)
+		}
+	}
+
+	var rows []AgentRow
+	for {
+		ok, err := t.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		a := assembled.Agent{
+			ID:       t.get("id"),
+			ImportID: t.get("import_id"),
+			Name:     t.get("name"),
+			Email:    t.get("email"),
+			Channels: t.list("channels"),
+			Queues:   t.ids(res, assembled.EntityQueue, "queues"),
+			Site:     t.resolve(res, assembled.EntitySite, "site"),
+			Skills:   t.ids(res, assembled.EntitySkill, "skills"),
+			Teams:    t.ids(res, assembled.EntityTeam, "teams"),
+		}
+		if a.ID == "" && a.ImportID == "" && a.Name == "" {
+			t.fail("", fmt.Errorf("an id, import_id or name is required"))
+		}
+		for _, ch := range a.Channels {
+			if ch != "phone" && ch != "email" && ch != "chat" {
+				t.fail("channels", fmt.Errorf("invalid channel %q", ch))
+			}
+		}
+		rows = append(rows, AgentRow{Line: t.line, Agent: a, Columns: columns})
+	}
+	if len(t.errs) > 0 {
+		return rows, t.errs
+	}
+	return rows, nil
+}
+
+// WriteAgents writes agents ordered by name, with the names of their queues,
+// site, skills and teams.
+func WriteAgents(w io.Writer, agents []assembled.Agent, res *Resolver, opts *Options) error {
+	o := opts.withDefaults()
+	sorted := append([]assembled.Agent(nil), agents...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	cw := csv.NewWriter(w)
+	cw.Write(agentColumns)
+	for _, a := range sorted {
+		site := ""
+		if a.Site != "" {
+			site = res.name(assembled.EntitySite, a.Site)
+		}
+		cw.Write([]string{
+			a.ID,
+			a.ImportID,
+			a.Name,
+			a.Email,
+			joinList(a.Channels, o),
+			joinList(res.namesOf(assembled.EntityQueue, a.Queues), o),
+			site,
+			joinList(res.namesOf(assembled.EntitySkill, a.Skills), o),
+			joinList(res.namesOf(assembled.EntityTeam, a.Teams), o),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ApplyResult is the outcome of applying a single row.
+type ApplyResult struct {
+	Line   int
+	ID     string // ID of the created or updated object.
+	Action string // "created" or "updated".
+	Err    error
+}
+
+// ApplyAgents creates or updates the agents of rows. A row updates the agent
+// with its id or, failing that, its import_id, and creates a new agent
+// otherwise. Updates only change the columns present in the file, and empty
+// cells in those columns clear the field.
+//
+// Every row is attempted; failures are returned together as Errors.
+func ApplyAgents(ctx context.Context, c *assembled.Client, res *Resolver, rows []AgentRow) ([]ApplyResult, error) {
+	var (
+		results []ApplyResult
+		errs    Errors
+		created = make(map[string]string) // Agents created so far, by import ID.
+	)
+	for _, row := range rows {
+		a := row.Agent
+		id := a.ID
+		if id == "" && a.ImportID != "" {
+			id = created[a.ImportID]
+			if id == "" {
+				id = res.agentByImportID(a.ImportID)
+			}
+		}
+
+		result := ApplyResult{Line: row.Line}
+		var (
+			agent *assembled.Agent
+			err   error
+		)
+		if id == "" {
+			result.Action = "created"
+			agent, err = c.CreateAgent(ctx, &assembled.CreateAgentRequest{
+				ImportID: a.ImportID,
+				Channels: a.Channels,
+				Email:    a.Email,
+				Name:     a.Name,
+				Queues:   a.Queues,
+				Site:     a.Site,
+				Skills:   a.Skills,
+				Teams:    a.Teams,
+			})
+		} else {
+			result.Action = "updated"
+			agent, err = c.UpdateAgentFields(ctx, agentUpdate(id, a), agentFields(row.Columns)...)
+		}
+		if err != nil {
+			result.Err = err
+			errs = append(errs, &RowError{Line: row.Line, Err: err})
+		} else {
+			result.ID = agent.ID
+			if agent.ImportID != "" {
+				created[agent.ImportID] = agent.ID
+			}
+		}
+		results = append(results, result)
+	}
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
+
+// agentUpdate returns an update of agent id to a.
+func agentUpdate(id string, a assembled.Agent) *assembled.UpdateAgentRequest {
+	return &assembled.UpdateAgentRequest{
+		ID:       id,
+		ImportID: a.ImportID,
+		Channels: a.Channels,
+		Email:    a.Email,
+		Name:     a.Name,
+		Queues:   a.Queues,
+		Site:     a.Site,
+		Skills:   a.Skills,
+		Teams:    a.Teams,
+	}
+}
+
+// agentFields returns the fields of an agent update for the given columns.
+// Empty cells clear their field.
+func agentFields(columns []string) []assembled.AgentField {
+	var fields []assembled.AgentField
+	for _, c := range columns {
+		if c != "id" {
+			fields = append(fields, assembled.AgentField(c))
+		}
+	}
+	return fields
+}
@@ -0,0 +1,214 @@
+// Package csvio reads and writes agents, activities and requirements as CSV,
+// using human-readable names for teams, sites, queues, skills, activity types
+// and requirement types, and applies the rows read through an
+// assembled.Client.
+//
+// Columns are matched by header, case-insensitively and in any order.
+// Multi-valued cells, such as an agent's teams, separate their values with
+// semicolons.
+package csvio
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Options customizes reading and writing.
+type Options struct {
+	// Location of times written without a UTC offset. Defaults to UTC.
+	Location *time.Location
+
+	// Layout used to write times. Defaults to time.RFC3339.
+	TimeLayout string
+
+	// Separator between values of multi-valued cells. Defaults to ";".
+	ListSeparator string
+
+	// If true, columns that are not recognized are ignored instead of
+	// reported as errors.
+	IgnoreUnknownColumns bool
+}
+
+func (o *Options) withDefaults() Options {
+	var opts Options
+	if o != nil {
+		opts = *o
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.TimeLayout == "" {
+		opts.TimeLayout = time.RFC3339
+	}
+	if opts.ListSeparator == "" {
+		opts.ListSeparator = ";"
+	}
+	return opts
+}
+
+// RowError is a problem with a single row or cell. Line numbers count
+// records, starting with the header as line 1, so they match the lines of the
+// file unless a quoted cell spans several lines.
+type RowError struct {
+	Line   int
+	Column string // Empty when the error concerns the whole row.
+	Err    error
+}
+
+func (e *RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %s: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Errors collects every RowError found while reading a file, so that all of
+// them can be fixed at once.
+type Errors []*RowError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// table reads CSV records and looks up cells by column name.
+type table struct {
+	r       *csv.Reader
+	columns map[string]int
+	line    int
+	record  []string
+	errs    Errors
+	opts    Options
+}
+
+// newTable reads the header of r. Columns are canonicalized through aliases
+// and must appear in known.
+func newTable(r io.Reader, known []string, aliases map[string]string, required []string, opts Options) (*table, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("missing header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := &table{r: cr, columns: make(map[string]int), line: 1, opts: opts}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if canonical, ok := aliases[name]; ok {
+			name = canonical
+		}
+		if !contains(known, name) {
+			if !opts.IgnoreUnknownColumns {
+				t.errs = append(t.errs, &RowError{Line: 1, Column: header[i], Err: fmt.Errorf("unknown column")})
+			}
+			continue
+		}
+		if _, dup := t.columns[name]; dup {
+			t.errs = append(t.errs, &RowError{Line: 1, Column: name, Err: fmt.Errorf("duplicate column")})
+			continue
+		}
+		t.columns[name] = i
+	}
+	for _, name := range required {
+		if _, ok := t.columns[name]; !ok {
+			t.errs = append(t.errs, &RowError{Line: 1, Column: name, Err: fmt.Errorf("missing required column")})
+		}
+	}
+	if len(t.errs) > 0 {
+		return nil, t.errs
+	}
+	return t, nil
+}
+
+// next advances to the next record, skipping blank ones.
+func (t *table) next() (bool, error) {
+	for {
+		record, err := t.r.Read()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		t.line++
+		t.record = record
+		if strings.TrimSpace(strings.Join(record, "")) != "" {
+			return true, nil
+		}
+	}
+}
+
+func (t *table) get(column string) string {
+	i, ok := t.columns[column]
+	if !ok || i >= len(t.record) {
+		return ""
+	}
+	return strings.TrimSpace(t.record[i])
+}
+
+func (t *table) has(column string) bool {
+	_, ok := t.columns[column]
+	return ok
+}
+
+func (t *table) list(column string) []string {
+	var out []string
+	for _, v := range strings.Split(t.get(column), t.opts.ListSeparator) {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// fail records an error for the current row.
+func (t *table) fail(column string, err error) {
+	t.errs = append(t.errs, &RowError{Line: t.line, Column: column, Err: err})
+}
+
+// time parses a time cell, accepting RFC 3339 and a few common spreadsheet
+// layouts in the configured location.
+func (t *table) time(column string) time.Time {
+	v := t.get(column)
+	if v == "" {
+		t.fail(column, fmt.Errorf("missing value"))
+		return time.Time{}
+	}
+	if ts, err := time.Parse(time.RFC3339, v); err == nil {
+		return ts
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if ts, err := time.ParseInLocation(layout, v, t.opts.Location); err == nil {
+			return ts
+		}
+	}
+	t.fail(column, fmt.Errorf("invalid time %q", v))
+	return time.Time{}
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func joinList(values []string, opts Options) string {
+	return strings.Join(values, opts.ListSeparator)
+}
@@ -0,0 +1,182 @@
+package csvio_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+	"github.com/assembledhq/assembled-go/csvio"
+)
+
+var (
+	ctx   = context.Background()
+	start = time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC)
+)
+
+func at(hours int) time.Time {
+	return start.Add(time.Duration(hours) * time.Hour)
+}
+
+func newResolver(t *testing.T, srv *assembledtest.Server) (*csvio.Resolver, *assembled.Client) {
+	c := srv.Client(assembled.WithRetryPolicy(nil))
+	res, err := csvio.NewResolver(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, c
+}
+
+func TestActivitiesRoundTrip(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	// Two agents share a name, as do two activity types.
+	ada1 := srv.AddAgent(assembled.Agent{Name: "Ada", Email: "ada1@example.com"})
+	ada2 := srv.AddAgent(assembled.Agent{Name: "Ada", Email: "ada2@example.com"})
+	phones := srv.AddActivityType(assembled.ActivityType{Name: "Phones"})
+	lunch1 := srv.AddActivityType(assembled.ActivityType{Name: "Lunch"})
+	lunch2 := srv.AddActivityType(assembled.ActivityType{Name: "lunch"})
+	res, _ := newResolver(t, srv)
+
+	activities := []assembled.Activity{
+		{ID: "a1", AgentID: ada1.ID, TypeID: phones.ID, StartTime: at(0), EndTime: at(3), Description: "calls, mostly"},
+		{ID: "a2", AgentID: ada2.ID, TypeID: lunch1.ID, StartTime: at(3), EndTime: at(4)},
+		{ID: "a3", AgentID: ada1.ID, TypeID: lunch2.ID, StartTime: at(4), EndTime: at(5)},
+	}
+	var buf bytes.Buffer
+	if err := csvio.WriteActivities(&buf, activities, res, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), ",Phones,") {
+		t.Errorf("unambiguous type not written by name:\n%s", buf.String())
+	}
+
+	// Written rows are read back as updates of the same activities.
+	data := strings.Replace(buf.String(), "id,", "action,id,", 1)
+	data = strings.Replace(data, "\na", "\nupdate,a", -1)
+	rows, err := csvio.ReadActivities(strings.NewReader(data), res, nil)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, data)
+	}
+	var got []assembled.Activity
+	for _, row := range rows {
+		got = append(got, row.Request.Activity)
+	}
+	if !reflect.DeepEqual(got, activities) {
+		t.Errorf("read back\n%+v\nwant\n%+v", got, activities)
+	}
+}
+
+func TestReadActivitiesErrors(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddAgent(assembled.Agent{Name: "Ada"})
+	srv.AddAgent(assembled.Agent{Name: "Ada"})
+	srv.AddAgent(assembled.Agent{Name: "Grace", Email: "grace@example.com"})
+	srv.AddActivityType(assembled.ActivityType{Name: "Phones"})
+	res, _ := newResolver(t, srv)
+
+	const data = "Agent,Activity Type,Start_Time,End,action,id\n" +
+		"grace@example.com,phones,2021-03-04 09:00,2021-03-04 10:00,,\n" +
+		"Ada,Phones,2021-03-04 09:00,2021-03-04 10:00,,\n" +
+		"Grace,Chat,2021-03-04 10:00,2021-03-04 09:00,,\n" +
+		",,,,delete,\n" +
+		",,,,move,a1\n"
+	_, err := csvio.ReadActivities(strings.NewReader(data), res, nil)
+	var errs csvio.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want Errors", err)
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`line 3: agent: ambiguous agent "Ada" matches IDs`,
+		`line 4: type: unknown activity type "Chat"`,
+		`line 4: end: must be after start`,
+		`line 5: id: required to delete an activity`,
+		`line 6: action: invalid action "move"`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("errors:\n%s", strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("error %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestApplyActivities(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ada := srv.AddAgent(assembled.Agent{Name: "Ada"})
+	phones := srv.AddActivityType(assembled.ActivityType{Name: "Phones"})
+	res, c := newResolver(t, srv)
+
+	data := "schedule_id,agent,type,start,end\n" +
+		",Ada,Phones,2021-03-04T09:00:00Z,2021-03-04T10:00:00Z\n" +
+		"s2,Ada,Phones,2021-03-04T09:00:00Z,2021-03-04T10:00:00Z\n"
+	rows, err := csvio.ReadActivities(strings.NewReader(data), res, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The batch of the master schedule, sent first, is rejected.
+	srv.InjectFault(assembledtest.Fault{Method: "POST", Times: 1, StatusCode: 400})
+
+	report, err := csvio.ApplyActivities(ctx, c, rows, &assembled.BulkActivityOptions{Concurrency: 1})
+	var errs csvio.Errors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Line != 2 {
+		t.Fatalf("err = %v, want an error on line 2", err)
+	}
+	if report.Results[1].Outcome != assembled.BulkCommitted {
+		t.Errorf("second row: %v", report.Results[1].Err)
+	}
+	if got := srv.Activities("s2"); len(got) != 1 || got[0].AgentID != ada.ID || got[0].TypeID != phones.ID {
+		t.Errorf("schedule s2 = %+v", got)
+	}
+}
+
+func TestAgentsRoundTrip(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	tier1 := srv.AddFilter("teams", assembled.Filter{Name: "Tier 1"})
+	billing := srv.AddFilter("teams", assembled.Filter{Name: "Billing"})
+	dupe := srv.AddFilter("skills", assembled.Filter{Name: "Spanish"})
+	spanish := srv.AddFilter("skills", assembled.Filter{Name: "Spanish"})
+	site := srv.AddFilter("sites", assembled.Filter{Name: "Lisbon"})
+	ada := srv.AddAgent(assembled.Agent{
+		Name: "Ada", ImportID: "e1", Email: "ada@example.com", Channels: []string{"chat", "email"},
+		Site: site.ID, Teams: []string{tier1.ID, billing.ID}, Skills: []string{spanish.ID},
+	})
+	res, c := newResolver(t, srv)
+
+	var buf bytes.Buffer
+	if err := csvio.WriteAgents(&buf, []assembled.Agent{ada}, res, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,import_id,name,email,channels,queues,site,skills,teams\n" +
+		ada.ID + ",e1,Ada,ada@example.com,chat;email,,Lisbon," + spanish.ID + ",Tier 1;Billing\n"
+	if buf.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s(%s is also named Spanish)", buf.String(), want, dupe.ID)
+	}
+
+	rows, err := csvio.ReadAgents(&buf, res, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rows[0].Agent; !reflect.DeepEqual(got, ada) {
+		t.Errorf("read back %+v, want %+v", got, ada)
+	}
+
+	results, err := csvio.ApplyAgents(ctx, c, res, rows)
+	if err != nil || len(results) != 1 || results[0].Action != "updated" || results[0].ID != ada.ID {
+		t.Errorf("ApplyAgents = %+v, %v", results, err)
+	}
+}
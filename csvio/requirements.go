@@ -0,0 +1,122 @@
+package csvio
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+var (
+	requirementColumns = []string{"type", "start", "end", "required", "scheduled"}
+	requirementAliases = map[string]string{
+		"requirement_type":    "type",
+		"requirement type":    "type",
+		"requirement_type_id": "type",
+		"start_time":          "start",
+		"end_time":            "end",
+	}
+)
+
+// RequirementRow is a requirement read from a CSV file, with its type
+// resolved to an ID.
+type RequirementRow struct {
+	Line    int
+	Request assembled.CreateRequirementRequest
+}
+
+// ReadRequirements reads requirements with the columns type, start, end and
+// required. Types may be given by name or ID. A scheduled column, as written
+// by WriteRequirements, is accepted and ignored.
+//
+// All problems found are returned together as Errors.
+func ReadRequirements(r io.Reader, res *Resolver, opts *Options) ([]RequirementRow, error) {
+	t, err := newTable(r, requirementColumns, requirementAliases, []string{"type", "start", "end", "required"}, opts.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []RequirementRow
+	for {
+		ok, err := t.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		req := assembled.CreateRequirementRequest{
+			RequirementTypeID: t.resolve(res, assembled.EntityRequirementType, "type"),
+			StartTime:         t.time("start"),
+			EndTime:           t.time("end"),
+		}
+		if t.get("type") == "" {
+			t.fail("type", fmt.Errorf("missing value"))
+		}
+		if !req.StartTime.IsZero() && !req.EndTime.After(req.StartTime) {
+			t.fail("end", fmt.Errorf("must be after start"))
+		}
+		required, err := strconv.Atoi(t.get("required"))
+		if err != nil || required < 0 {
+			t.fail("required", fmt.Errorf("must be a non-negative integer"))
+		}
+		req.Required = required
+		rows = append(rows, RequirementRow{Line: t.line, Request: req})
+	}
+	if len(t.errs) > 0 {
+		return rows, t.errs
+	}
+	return rows, nil
+}
+
+// WriteRequirements writes requirements ordered by start time and type name.
+func WriteRequirements(w io.Writer, requirements []assembled.Requirement, res *Resolver, opts *Options) error {
+	o := opts.withDefaults()
+	sorted := append([]assembled.Requirement(nil), requirements...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].StartTime.Equal(sorted[j].StartTime) {
+			return sorted[i].StartTime.Before(sorted[j].StartTime)
+		}
+		return res.name(assembled.EntityRequirementType, sorted[i].RequirementTypeID) < res.name(assembled.EntityRequirementType, sorted[j].RequirementTypeID)
+	})
+
+	cw := csv.NewWriter(w)
+	cw.Write(requirementColumns)
+	for _, r := range sorted {
+		cw.Write([]string{
+			res.name(assembled.EntityRequirementType, r.RequirementTypeID),
+			r.StartTime.In(o.Location).Format(o.TimeLayout),
+			r.EndTime.In(o.Location).Format(o.TimeLayout),
+			strconv.Itoa(r.Required),
+			strconv.Itoa(r.Scheduled),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ApplyRequirements creates or overwrites the requirements of rows. Every
+// row is attempted; failures are returned together as Errors.
+func ApplyRequirements(ctx context.Context, c *assembled.Client, rows []RequirementRow) ([]ApplyResult, error) {
+	var (
+		results []ApplyResult
+		errs    Errors
+	)
+	for _, row := range rows {
+		req := row.Request
+		result := ApplyResult{Line: row.Line, Action: "created"}
+		if _, err := c.CreateRequirement(ctx, &req); err != nil {
+			result.Err = err
+			errs = append(errs, &RowError{Line: row.Line, Err: err})
+		}
+		results = append(results, result)
+	}
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
@@ -0,0 +1,99 @@
+package csvio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// Resolver maps the names used in CSV files to the IDs used by the API, and
+// back.
+type Resolver struct {
+	dir *assembled.Directory
+}
+
+// NewResolver loads the queues, sites, teams, skills, activity types,
+// requirement types and agents of the account.
+func NewResolver(ctx context.Context, c *assembled.Client) (*Resolver, error) {
+	// Everything is loaded up front and never expires, so that later
+	// lookups need no context.
+	dir := assembled.NewDirectory(c, 0)
+	if err := dir.Load(ctx); err != nil {
+		return nil, fmt.Errorf("csvio: %w", err)
+	}
+	return &Resolver{dir: dir}, nil
+}
+
+// id returns the ID of the item of the given kind whose ID or name, compared
+// case-insensitively, is v. Agents are also matched by email and import ID.
+func (r *Resolver) id(kind assembled.EntityKind, v string) (string, error) {
+	id, err := r.dir.Resolve(context.Background(), kind, v)
+	var ambiguous *assembled.AmbiguousNameError
+	switch {
+	case errors.As(err, &ambiguous):
+		return "", fmt.Errorf("ambiguous %s %q matches IDs %s", kind, v, strings.Join(ambiguous.IDs, ", "))
+	case errors.Is(err, assembled.ErrNotFound):
+		return "", fmt.Errorf("unknown %s %q", kind, v)
+	}
+	return id, err
+}
+
+// agentByImportID returns the ID of the agent with the given import ID, or
+// the empty string.
+func (r *Resolver) agentByImportID(importID string) string {
+	id, _ := r.dir.ResolveImportID(context.Background(), assembled.EntityAgent, importID)
+	return id
+}
+
+// name returns the name of the item of the given kind with the given ID, or
+// the ID itself if it is unknown or the name does not resolve back to it, so
+// that whatever is written can be read again.
+func (r *Resolver) name(kind assembled.EntityKind, id string) string {
+	name, err := r.dir.Name(context.Background(), kind, id)
+	if err != nil || name == "" {
+		return id
+	}
+	if back, err := r.id(kind, name); err != nil || back != id {
+		return id
+	}
+	return name
+}
+
+// ids resolves every value of a multi-valued cell, recording failures.
+func (t *table) ids(r *Resolver, kind assembled.EntityKind, column string) []string {
+	var out []string
+	for _, v := range t.list(column) {
+		id, err := r.id(kind, v)
+		if err != nil {
+			t.fail(column, err)
+			continue
+		}
+		out = append(out, id)
+	}
+	return out
+}
+
+// resolve resolves a single-valued cell, recording failures. Empty cells
+// resolve to the empty string.
+func (t *table) resolve(r *Resolver, kind assembled.EntityKind, column string) string {
+	v := t.get(column)
+	if v == "" {
+		return ""
+	}
+	id, err := r.id(kind, v)
+	if err != nil {
+		t.fail(column, err)
+	}
+	return id
+}
+
+func (r *Resolver) namesOf(kind assembled.EntityKind, ids []string) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = r.name(kind, id)
+	}
+	return out
+}
@@ -0,0 +1,342 @@
+package assembled
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EntityKind is a kind of object that a Directory maps between names and
+// IDs.
+type EntityKind string
+
+const (
+	EntityQueue           EntityKind = "queue"
+	EntitySite            EntityKind = "site"
+	EntityTeam            EntityKind = "team"
+	EntitySkill           EntityKind = "skill"
+	EntityActivityType    EntityKind = "activity type"
+	EntityRequirementType EntityKind = "requirement type"
+	EntityAgent           EntityKind = "agent"
+)
+
+// EntityKinds lists every EntityKind.
+var EntityKinds = []EntityKind{
+	EntityQueue, EntitySite, EntityTeam, EntitySkill,
+	EntityActivityType, EntityRequirementType, EntityAgent,
+}
+
+// AmbiguousNameError is returned by a Directory when a name matches several
+// objects.
+type AmbiguousNameError struct {
+	Kind EntityKind
+	Name string
+	IDs  []string // Sorted.
+}
+
+func (e *AmbiguousNameError) Error() string {
+	return fmt.Sprintf("assembled: ambiguous %s %q matches IDs %s", e.Kind, e.Name, strings.Join(e.IDs, ", "))
+}
+
+// Directory maps the names of queues, sites, teams, skills, activity types,
+// requirement types and agents to their IDs, and back. Each kind is listed
+// from the API the first time it is needed and cached, for at most the TTL
+// if one is set.
+//
+// Lookups accept an ID, an import ID for agents and activity types, a name,
+// compared case-insensitively, or an email address for agents. Names shared
+// by several objects fail with an *AmbiguousNameError, and unknown names
+// with an error matching ErrNotFound.
+//
+// A Directory is safe for concurrent use.
+type Directory struct {
+	client *Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[EntityKind]*directoryEntry
+}
+
+type directoryEntry struct {
+	mu     sync.Mutex
+	loaded time.Time // Zero if not loaded or invalidated.
+	directoryIndex
+}
+
+// directoryIndex holds the lookups of one kind, built from a single list.
+type directoryIndex struct {
+	names     map[string]string   // By ID.
+	importIDs map[string]string   // ID by import ID.
+	ids       map[string][]string // IDs by lowercased name or alias.
+}
+
+// filterKinds maps the entity kinds that are filters to their FilterKind.
+var filterKinds = map[EntityKind]FilterKind{
+	EntityQueue: FilterQueue,
+	EntitySite:  FilterSite,
+	EntityTeam:  FilterTeam,
+	EntitySkill: FilterSkill,
+}
+
+// NewDirectory returns a directory listing objects with c. If ttl is
+// positive, cached lists older than ttl are listed again when next needed.
+func NewDirectory(c *Client, ttl time.Duration) *Directory {
+	d := &Directory{client: c, ttl: ttl, entries: make(map[EntityKind]*directoryEntry)}
+	for _, kind := range EntityKinds {
+		d.entries[kind] = &directoryEntry{}
+	}
+	return d
+}
+
+// Resolve returns the ID of the object of the given kind with the given
+// ID, import ID, name or, for agents, email address.
+func (d *Directory) Resolve(ctx context.Context, kind EntityKind, name string) (string, error) {
+	e, err := d.entry(ctx, kind)
+	if err != nil {
+		return "", err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.names[name]; ok {
+		return name, nil
+	}
+	if id, ok := e.importIDs[name]; ok {
+		return id, nil
+	}
+	switch ids := e.ids[strings.ToLower(name)]; len(ids) {
+	case 0:
+		return "", fmt.Errorf("%w: %s %q", ErrNotFound, kind, name)
+	case 1:
+		return ids[0], nil
+	default:
+		sorted := append([]string(nil), ids...)
+		sort.Strings(sorted)
+		return "", &AmbiguousNameError{Kind: kind, Name: name, IDs: sorted}
+	}
+}
+
+// ResolveAll resolves several names of the same kind, as for the teams of
+// an agent. It fails on the first name that cannot be resolved.
+func (d *Directory) ResolveAll(ctx context.Context, kind EntityKind, names []string) ([]string, error) {
+	ids := make([]string, len(names))
+	for i, name := range names {
+		id, err := d.Resolve(ctx, kind, name)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// Name returns the name of the object of the given kind with the given ID.
+func (d *Directory) Name(ctx context.Context, kind EntityKind, id string) (string, error) {
+	e, err := d.entry(ctx, kind)
+	if err != nil {
+		return "", err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	name, ok := e.names[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %s ID %q", ErrNotFound, kind, id)
+	}
+	return name, nil
+}
+
+// ResolveImportID returns the ID of the agent or activity type with the
+// given import ID. Unlike Resolve, it never matches names.
+func (d *Directory) ResolveImportID(ctx context.Context, kind EntityKind, importID string) (string, error) {
+	e, err := d.entry(ctx, kind)
+	if err != nil {
+		return "", err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id, ok := e.importIDs[importID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s import ID %q", ErrNotFound, kind, importID)
+	}
+	return id, nil
+}
+
+// Load lists the given kinds, or every kind if none is given, unless they
+// are already cached.
+func (d *Directory) Load(ctx context.Context, kinds ...EntityKind) error {
+	if len(kinds) == 0 {
+		kinds = EntityKinds
+	}
+	for _, kind := range kinds {
+		if _, err := d.entry(ctx, kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Invalidate drops the cached lists of the given kinds, or of every kind if
+// none is given, so that they are listed again when next needed.
+func (d *Directory) Invalidate(kinds ...EntityKind) {
+	if len(kinds) == 0 {
+		kinds = EntityKinds
+	}
+	for _, kind := range kinds {
+		if e := d.entries[kind]; e != nil {
+			e.mu.Lock()
+			e.loaded = time.Time{}
+			e.mu.Unlock()
+		}
+	}
+}
+
+// ResolveQueue and the following Resolve methods are shorthands for Resolve
+// with a fixed kind.
+func (d *Directory) ResolveQueue(ctx context.Context, name string) (string, error) {
+	return d.Resolve(ctx, EntityQueue, name)
+}
+
+func (d *Directory) ResolveSite(ctx context.Context, name string) (string, error) {
+	return d.Resolve(ctx, EntitySite, name)
+}
+
+func (d *Directory) ResolveTeam(ctx context.Context, name string) (string, error) {
+	return d.Resolve(ctx, EntityTeam, name)
+}
+
+func (d *Directory) ResolveSkill(ctx context.Context, name string) (string, error) {
+	return d.Resolve(ctx, EntitySkill, name)
+}
+
+func (d *Directory) ResolveActivityType(ctx context.Context, name string) (string, error) {
+	return d.Resolve(ctx, EntityActivityType, name)
+}
+
+func (d *Directory) ResolveRequirementType(ctx context.Context, name string) (string, error) {
+	return d.Resolve(ctx, EntityRequirementType, name)
+}
+
+func (d *Directory) ResolveAgent(ctx context.Context, name string) (string, error) {
+	return d.Resolve(ctx, EntityAgent, name)
+}
+
+// QueueName and the following Name methods are shorthands for Name with a
+// fixed kind.
+func (d *Directory) QueueName(ctx context.Context, id string) (string, error) {
+	return d.Name(ctx, EntityQueue, id)
+}
+
+func (d *Directory) SiteName(ctx context.Context, id string) (string, error) {
+	return d.Name(ctx, EntitySite, id)
+}
+
+func (d *Directory) TeamName(ctx context.Context, id string) (string, error) {
+	return d.Name(ctx, EntityTeam, id)
+}
+
+func (d *Directory) SkillName(ctx context.Context, id string) (string, error) {
+	return d.Name(ctx, EntitySkill, id)
+}
+
+func (d *Directory) ActivityTypeName(ctx context.Context, id string) (string, error) {
+	return d.Name(ctx, EntityActivityType, id)
+}
+
+func (d *Directory) RequirementTypeName(ctx context.Context, id string) (string, error) {
+	return d.Name(ctx, EntityRequirementType, id)
+}
+
+func (d *Directory) AgentName(ctx context.Context, id string) (string, error) {
+	return d.Name(ctx, EntityAgent, id)
+}
+
+// entry returns the cache of the given kind, listing it first if it is not
+// loaded or has expired. Concurrent callers wait for a single listing. If
+// listing fails, the previous lists are kept, and listed again when next
+// needed.
+func (d *Directory) entry(ctx context.Context, kind EntityKind) (*directoryEntry, error) {
+	e := d.entries[kind]
+	if e == nil {
+		return nil, fmt.Errorf("assembled: unknown entity kind %q", string(kind))
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.loaded.IsZero() && (d.ttl <= 0 || time.Since(e.loaded) < d.ttl) {
+		return e, nil
+	}
+
+	idx, err := d.load(ctx, kind)
+	if err != nil {
+		return nil, fmt.Errorf("assembled: listing %s: %w", kind, err)
+	}
+	e.directoryIndex = *idx
+	e.loaded = time.Now()
+	return e, nil
+}
+
+// load lists the objects of the given kind into a new index.
+func (d *Directory) load(ctx context.Context, kind EntityKind) (*directoryIndex, error) {
+	idx := &directoryIndex{
+		names:     make(map[string]string),
+		importIDs: make(map[string]string),
+		ids:       make(map[string][]string),
+	}
+	switch kind {
+	case EntityQueue, EntitySite, EntityTeam, EntitySkill:
+		filters, err := d.client.ListFilters(ctx, filterKinds[kind])
+		if err != nil {
+			return nil, err
+		}
+		for id, f := range filters {
+			idx.add(id, f.Name)
+		}
+	case EntityActivityType:
+		resp, err := d.client.ListActivityTypes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for id, t := range resp.ActivityTypes {
+			idx.add(id, t.Name)
+			if t.ImportID != "" {
+				idx.importIDs[t.ImportID] = id
+			}
+		}
+	case EntityRequirementType:
+		resp, err := d.client.ListRequirementTypes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for id, t := range resp.RequirementTypes {
+			idx.add(id, t.Name)
+		}
+	case EntityAgent:
+		resp, err := d.client.ListAgents(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		for id, a := range resp.Agents {
+			idx.add(id, a.Name)
+			if a.Email != "" && !strings.EqualFold(a.Email, a.Name) {
+				idx.alias(id, a.Email)
+			}
+			if a.ImportID != "" {
+				idx.importIDs[a.ImportID] = id
+			}
+		}
+	}
+	return idx, nil
+}
+
+func (idx *directoryIndex) add(id, name string) {
+	idx.names[id] = name
+	if name != "" {
+		idx.alias(id, name)
+	}
+}
+
+func (idx *directoryIndex) alias(id, alias string) {
+	key := strings.ToLower(alias)
+	idx.ids[key] = append(idx.ids[key], id)
+}
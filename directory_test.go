@@ -0,0 +1,97 @@
+package assembled_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+func TestDirectory(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+	queue := srv.AddFilter("queues", assembled.Filter{Name: "Billing"})
+	site := srv.AddFilter("sites", assembled.Filter{Name: "Lisbon"})
+	team := srv.AddFilter("teams", assembled.Filter{Name: "Tier 1"})
+	skill1 := srv.AddFilter("skills", assembled.Filter{Name: "Spanish"})
+	skill2 := srv.AddFilter("skills", assembled.Filter{Name: "spanish"})
+	phones := srv.AddActivityType(assembled.ActivityType{Name: "Phones", ImportID: "ph"})
+	sla := srv.AddRequirementType(assembled.RequirementType{Name: "SLA"})
+	ada := srv.AddAgent(assembled.Agent{Name: "Ada", Email: "ada@example.com", ImportID: "e1"})
+	d := assembled.NewDirectory(srv.Client(), 0)
+
+	tests := []struct {
+		kind assembled.EntityKind
+		name string
+		want string
+	}{
+		{assembled.EntityQueue, "billing", queue.ID},
+		{assembled.EntitySite, "Lisbon", site.ID},
+		{assembled.EntityTeam, team.ID, team.ID},
+		{assembled.EntitySkill, skill2.ID, skill2.ID},
+		{assembled.EntityActivityType, "ph", phones.ID},
+		{assembled.EntityRequirementType, "sla", sla.ID},
+		{assembled.EntityAgent, "ADA@example.com", ada.ID},
+		{assembled.EntityAgent, "e1", ada.ID},
+	}
+	for _, tt := range tests {
+		if got, err := d.Resolve(ctx, tt.kind, tt.name); err != nil || got != tt.want {
+			t.Errorf("Resolve(%s, %q) = %q, %v, want %q", tt.kind, tt.name, got, err, tt.want)
+		}
+	}
+
+	_, err := d.ResolveSkill(ctx, "SPANISH")
+	var ambiguous *assembled.AmbiguousNameError
+	if !errors.As(err, &ambiguous) || !reflect.DeepEqual(ambiguous.IDs, []string{skill1.ID, skill2.ID}) {
+		t.Errorf("ambiguous skill: err = %v", err)
+	}
+	if _, err := d.ResolveTeam(ctx, "Tier 2"); !errors.Is(err, assembled.ErrNotFound) {
+		t.Errorf("unknown team: err = %v, want ErrNotFound", err)
+	}
+	if name, err := d.AgentName(ctx, ada.ID); err != nil || name != "Ada" {
+		t.Errorf("AgentName = %q, %v", name, err)
+	}
+	if _, err := d.ResolveImportID(ctx, assembled.EntityAgent, "Ada"); !errors.Is(err, assembled.ErrNotFound) {
+		t.Errorf("ResolveImportID by name: err = %v, want ErrNotFound", err)
+	}
+	if _, err := d.Resolve(ctx, "region", "x"); err == nil {
+		t.Error("unknown kind resolved")
+	}
+}
+
+func TestDirectoryReload(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+	tier1 := srv.AddFilter("teams", assembled.Filter{Name: "Tier 1"})
+	d := assembled.NewDirectory(srv.Client(assembled.WithRetryPolicy(nil)), 0)
+	if err := d.Load(ctx, assembled.EntityTeam); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cached lists are used until invalidated.
+	tier2 := srv.AddFilter("teams", assembled.Filter{Name: "Tier 2"})
+	if _, err := d.ResolveTeam(ctx, "Tier 2"); !errors.Is(err, assembled.ErrNotFound) {
+		t.Errorf("before Invalidate: err = %v, want ErrNotFound", err)
+	}
+	n := len(srv.Requests())
+
+	// A failed listing is reported, and listed again when next needed.
+	d.Invalidate(assembled.EntityTeam)
+	srv.InjectFault(assembledtest.Fault{Method: "GET", PathPrefix: "/v0/teams", Times: 1, StatusCode: 500})
+	if _, err := d.ResolveTeam(ctx, "Tier 1"); err == nil {
+		t.Error("listing failure not reported")
+	}
+	for _, tt := range []struct{ name, want string }{{"Tier 1", tier1.ID}, {"Tier 2", tier2.ID}} {
+		if got, err := d.ResolveTeam(ctx, tt.name); err != nil || got != tt.want {
+			t.Errorf("after reload: ResolveTeam(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+	if got := len(srv.Requests()) - n; got != 2 {
+		t.Errorf("%d requests after Invalidate, want 2", got)
+	}
+}
@@ -0,0 +1,9 @@
+// Package assembled is a client for the Assembled API.
+//
+// Most methods, such as ListAgents and UpdateAgent, are generated from the
+// API description. Their update requests omit empty fields, which the API
+// then leaves unchanged. To clear a field, use UpdateAgentFields or
+// UpdateFilterFields instead of UpdateAgent or the per-kind methods such as
+// UpdateTeams, and list the fields to send with the AgentField and
+// FilterField constants.
+package assembled
@@ -0,0 +1,177 @@
+package assembled
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sentinel errors matched by *Error through errors.Is, for example:
+//
+//	if errors.Is(err, assembled.ErrNotFound) {
+//		// ...
+//	}
+var (
+	ErrNotFound     = errors.New("assembled: not found")
+	ErrUnauthorized = errors.New("assembled: unauthorized")
+	ErrForbidden    = errors.New("assembled: forbidden")
+	ErrRateLimited  = errors.New("assembled: rate limited")
+	ErrValidation   = errors.New("assembled: validation failed")
+)
+
+// Error is returned when the API responds with a non-200 status code. Client
+// methods wrap it with their own name, so use errors.As to inspect it.
+type Error struct {
+	StatusCode int
+	RequestID  string // Value of the Request-Id response header.
+
+	// Error code and message parsed from the response body, when it is JSON.
+	Code    string
+	Message string
+
+	// Per-field details of a validation failure, when provided.
+	Details []ErrorDetail
+
+	// How long the server asked the client to wait before retrying.
+	RetryAfter time.Duration
+
+	// Raw response body.
+	Body []byte
+}
+
+// ErrorDetail describes a problem with a single field of a request.
+type ErrorDetail struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "assembled: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	switch {
+	case e.Message != "":
+		b.WriteString(": ")
+		b.WriteString(e.Message)
+	case len(e.Body) > 0:
+		b.WriteString(": ")
+		b.WriteString(truncate(string(bytes.TrimSpace(e.Body)), 200))
+	}
+	for _, d := range e.Details {
+		b.WriteString("; ")
+		if d.Field != "" {
+			b.WriteString(d.Field)
+			b.WriteString(": ")
+		}
+		b.WriteString(d.Message)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request ID %s)", e.RequestID)
+	}
+	return b.String()
+}
+
+// Is reports whether target is the sentinel error corresponding to the
+// status code of e.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying: a
+// request timeout, a rate limited request, a 5xx gateway or availability
+// error, or a network error. It does not take the request method into
+// account.
+func IsRetryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		switch e.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return isNetworkError(err)
+}
+
+func isRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// errorBody matches the shapes of error payloads returned by the API: either
+// the fields at the top level or nested under "error".
+type errorBody struct {
+	Message string          `json:"message"`
+	Code    json.RawMessage `json:"code"`
+	Type    string          `json:"type"`
+	Details []ErrorDetail   `json:"details"`
+	Errors  []ErrorDetail   `json:"errors"`
+	Error   json.RawMessage `json:"error"`
+}
+
+func newError(resp *http.Response, body []byte) *Error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("Request-Id"),
+		RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+		Body:       body,
+	}
+
+	var b errorBody
+	if json.Unmarshal(body, &b) != nil {
+		return e
+	}
+	if len(b.Error) > 0 {
+		var nested errorBody
+		var message string
+		if json.Unmarshal(b.Error, &nested) == nil {
+			b = nested
+		} else if json.Unmarshal(b.Error, &message) == nil {
+			b.Message = message
+		}
+	}
+
+	e.Message = b.Message
+	e.Code = rawString(b.Code)
+	if e.Code == "" {
+		e.Code = b.Type
+	}
+	e.Details = append(b.Details, b.Errors...)
+	return e
+}
+
+// rawString returns a JSON string or number as a plain string.
+func rawString(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,91 @@
+package assembled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestErrorSentinels(t *testing.T) {
+	sentinels := []error{ErrNotFound, ErrUnauthorized, ErrForbidden, ErrRateLimited, ErrValidation}
+	tests := []struct {
+		code int
+		want error
+	}{
+		{400, ErrValidation},
+		{401, ErrUnauthorized},
+		{403, ErrForbidden},
+		{404, ErrNotFound},
+		{422, ErrValidation},
+		{429, ErrRateLimited},
+		{500, nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.code), func(t *testing.T) {
+			srv, _ := newScriptedServer(t, nil, tt.code)
+			c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false), WithRetryPolicy(nil))
+
+			_, err := c.ListAgents(context.Background(), nil)
+			for _, s := range sentinels {
+				if got := errors.Is(err, s); got != (s == tt.want) {
+					t.Errorf("errors.Is(err, %v) = %v", s, got)
+				}
+			}
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("err = %v, want an *Error", err)
+			}
+			if e.StatusCode != tt.code || e.RequestID != "req_1" || e.Message != "scripted failure" || e.Code != "scripted" {
+				t.Errorf("got %+v", e)
+			}
+		})
+	}
+}
+
+// timeoutError is a net.Error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	opErr := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"408", &Error{StatusCode: 408}, true},
+		{"429", &Error{StatusCode: 429}, true},
+		{"500", &Error{StatusCode: 500}, true},
+		{"502", &Error{StatusCode: 502}, true},
+		{"503", &Error{StatusCode: 503}, true},
+		{"504", &Error{StatusCode: 504}, true},
+		{"501", &Error{StatusCode: 501}, false},
+		{"400", &Error{StatusCode: 400}, false},
+		{"401", &Error{StatusCode: 401}, false},
+		{"404", &Error{StatusCode: 404}, false},
+		{"409", &Error{StatusCode: 409}, false},
+		{"422", &Error{StatusCode: 422}, false},
+		{"wrapped 503", fmt.Errorf("ListAgents: %w", &Error{StatusCode: 503}), true},
+		{"wrapped 404", fmt.Errorf("ListAgents: %w", &Error{StatusCode: 404}), false},
+		{"connection reset", fmt.Errorf("ListAgents: %w", opErr), true},
+		{"connection refused", syscall.ECONNREFUSED, true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"timeout", timeoutError{}, true},
+		{"canceled", fmt.Errorf("ListAgents: %w", context.Canceled), false},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+		{"other", errors.New("decoding response"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
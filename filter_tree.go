@@ -0,0 +1,226 @@
+package assembled
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FilterTree is the hierarchy formed by the ParentID of a set of filters of
+// one kind, such as the Teams of a TeamsList.
+//
+// Filters whose parent is not in the set are orphans, and filters whose
+// parents form a cycle are cyclic. Both are reported, and both are treated as
+// roots so that the tree can always be navigated: an orphan becomes a root,
+// and a cycle is broken by making its member with the smallest ID a root.
+type FilterTree struct {
+	nodes   map[string]*FilterNode
+	roots   []*FilterNode
+	orphans []*FilterNode
+	cycles  [][]*FilterNode
+	paths   map[string][]*FilterNode
+}
+
+// FilterNode is a filter within a FilterTree.
+type FilterNode struct {
+	Filter
+
+	Parent   *FilterNode
+	Children []*FilterNode // Ordered by name, then ID.
+}
+
+// NewFilterTree builds the tree of filters, which are keyed by ID.
+func NewFilterTree(filters map[string]Filter) *FilterTree {
+	t := &FilterTree{
+		nodes: make(map[string]*FilterNode, len(filters)),
+		paths: make(map[string][]*FilterNode, len(filters)),
+	}
+	for id, f := range filters {
+		f.ID = id
+		t.nodes[id] = &FilterNode{Filter: f}
+	}
+	for _, n := range t.nodes {
+		if n.ParentID == "" {
+			continue
+		}
+		if parent, ok := t.nodes[n.ParentID]; ok {
+			n.Parent = parent
+		} else {
+			t.orphans = append(t.orphans, n)
+		}
+	}
+	t.breakCycles()
+
+	for _, n := range t.nodes {
+		if n.Parent == nil {
+			t.roots = append(t.roots, n)
+		} else {
+			n.Parent.Children = append(n.Parent.Children, n)
+		}
+	}
+	sortNodes(t.roots)
+	sortNodes(t.orphans)
+	for _, n := range t.nodes {
+		sortNodes(n.Children)
+		path := n.Path()
+		t.paths[path] = append(t.paths[path], n)
+	}
+	return t
+}
+
+// breakCycles finds every cycle of parents and detaches its member with the
+// smallest ID from its parent.
+func (t *FilterTree) breakCycles() {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[*FilterNode]int, len(t.nodes))
+	for _, start := range t.nodes {
+		var chain []*FilterNode
+		n := start
+		for n != nil && state[n] == 0 {
+			state[n] = visiting
+			chain = append(chain, n)
+			n = n.Parent
+		}
+		if n != nil && state[n] == visiting {
+			// n is both an ancestor and a descendant of itself.
+			var cycle []*FilterNode
+			for i := len(chain) - 1; i >= 0; i-- {
+				cycle = append(cycle, chain[i])
+				if chain[i] == n {
+					break
+				}
+			}
+			sortNodesByID(cycle)
+			cycle[0].Parent = nil
+			t.cycles = append(t.cycles, cycle)
+		}
+		for _, c := range chain {
+			state[c] = done
+		}
+	}
+	sort.Slice(t.cycles, func(i, j int) bool { return t.cycles[i][0].ID < t.cycles[j][0].ID })
+}
+
+// Len returns the number of filters in the tree.
+func (t *FilterTree) Len() int {
+	return len(t.nodes)
+}
+
+// Node returns the filter with the given ID, or nil if there is none.
+func (t *FilterTree) Node(id string) *FilterNode {
+	return t.nodes[id]
+}
+
+// Roots returns the filters without a parent, ordered by name, including
+// orphans and the filters chosen to break cycles.
+func (t *FilterTree) Roots() []*FilterNode {
+	return t.roots
+}
+
+// Nodes returns every filter, parents before their children, with siblings
+// ordered by name.
+func (t *FilterTree) Nodes() []*FilterNode {
+	nodes := make([]*FilterNode, 0, len(t.nodes))
+	for _, r := range t.roots {
+		nodes = append(nodes, r)
+		nodes = append(nodes, r.Descendants()...)
+	}
+	return nodes
+}
+
+// Orphans returns the filters whose ParentID is not in the tree.
+func (t *FilterTree) Orphans() []*FilterNode {
+	return t.orphans
+}
+
+// Cycles returns the sets of filters whose parents form a cycle, each
+// ordered by ID. The first filter of each set was made a root.
+func (t *FilterTree) Cycles() [][]*FilterNode {
+	return t.cycles
+}
+
+// Lookup returns the filter with the given path of names, such as
+// "EMEA/Tier 2/Billing". It fails if no filter or several filters have the
+// path.
+func (t *FilterTree) Lookup(path string) (*FilterNode, error) {
+	switch nodes := t.paths[path]; len(nodes) {
+	case 0:
+		return nil, fmt.Errorf("assembled: no filter with path %q", path)
+	case 1:
+		return nodes[0], nil
+	default:
+		return nil, fmt.Errorf("assembled: %d filters with path %q", len(nodes), path)
+	}
+}
+
+// Ancestors returns the parent of n, its parent, and so on up to a root.
+func (n *FilterNode) Ancestors() []*FilterNode {
+	var ancestors []*FilterNode
+	for p := n.Parent; p != nil; p = p.Parent {
+		ancestors = append(ancestors, p)
+	}
+	return ancestors
+}
+
+// Descendants returns every filter below n, depth first, with siblings
+// ordered by name.
+func (n *FilterNode) Descendants() []*FilterNode {
+	var descendants []*FilterNode
+	var walk func(*FilterNode)
+	walk = func(n *FilterNode) {
+		for _, c := range n.Children {
+			descendants = append(descendants, c)
+			walk(c)
+		}
+	}
+	walk(n)
+	return descendants
+}
+
+// IsAncestorOf reports whether n is an ancestor of other.
+func (n *FilterNode) IsAncestorOf(other *FilterNode) bool {
+	for p := other.Parent; p != nil; p = p.Parent {
+		if p == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Depth returns the number of ancestors of n.
+func (n *FilterNode) Depth() int {
+	depth := 0
+	for p := n.Parent; p != nil; p = p.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Path returns the names of the ancestors of n and of n itself, from the
+// root down, separated by slashes.
+func (n *FilterNode) Path() string {
+	names := []string{n.Name}
+	for p := n.Parent; p != nil; p = p.Parent {
+		names = append(names, p.Name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, "/")
+}
+
+func sortNodes(nodes []*FilterNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Name != nodes[j].Name {
+			return nodes[i].Name < nodes[j].Name
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+}
+
+func sortNodesByID(nodes []*FilterNode) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+}
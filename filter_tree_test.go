@@ -0,0 +1,128 @@
+package assembled_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// filters builds filters from "id:name:parentID" strings.
+func filters(specs ...string) map[string]assembled.Filter {
+	out := make(map[string]assembled.Filter)
+	for _, s := range specs {
+		parts := strings.Split(s, ":")
+		out[parts[0]] = assembled.Filter{Name: parts[1], ParentID: parts[2]}
+	}
+	return out
+}
+
+func nodeIDs(nodes []*assembled.FilterNode) string {
+	var ids []string
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestFilterTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters map[string]assembled.Filter
+		paths   string // Paths of Nodes, in order.
+		roots   string
+		orphans string
+		cycles  string
+	}{{
+		name:    "tree",
+		filters: filters("a:EMEA:", "b:Tier 2:a", "c:Billing:b", "d:Tier 1:a", "e:APAC:"),
+		paths:   "APAC EMEA EMEA/Tier 1 EMEA/Tier 2 EMEA/Tier 2/Billing",
+		roots:   "e,a",
+	}, {
+		name:    "self parent",
+		filters: filters("a:A:a", "b:B:a"),
+		paths:   "A A/B",
+		roots:   "a",
+		cycles:  "[a]",
+	}, {
+		name:    "two-node cycle",
+		filters: filters("b:B:a", "a:A:b", "c:C:b"),
+		paths:   "A A/B A/B/C",
+		roots:   "a",
+		cycles:  "[a,b]",
+	}, {
+		name:    "separate cycles",
+		filters: filters("a:A:b", "b:B:a", "c:C:d", "d:D:c", "e:E:e"),
+		paths:   "A A/B C C/D E",
+		roots:   "a,c,e",
+		cycles:  "[a,b] [c,d] [e]",
+	}, {
+		name:    "orphans",
+		filters: filters("a:A:", "b:B:gone", "c:C:b", "d:D:gone"),
+		paths:   "A B B/C D",
+		roots:   "a,b,d",
+		orphans: "b,d",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := assembled.NewFilterTree(tt.filters)
+			var paths []string
+			for _, n := range tree.Nodes() {
+				paths = append(paths, n.Path())
+			}
+			if got := strings.Join(paths, " "); got != tt.paths {
+				t.Errorf("paths %q, want %q", got, tt.paths)
+			}
+			if got := nodeIDs(tree.Roots()); got != tt.roots {
+				t.Errorf("roots %q, want %q", got, tt.roots)
+			}
+			if got := nodeIDs(tree.Orphans()); got != tt.orphans {
+				t.Errorf("orphans %q, want %q", got, tt.orphans)
+			}
+			var cycles []string
+			for _, c := range tree.Cycles() {
+				cycles = append(cycles, "["+nodeIDs(c)+"]")
+			}
+			if got := strings.Join(cycles, " "); got != tt.cycles {
+				t.Errorf("cycles %q, want %q", got, tt.cycles)
+			}
+			if tree.Len() != len(tt.filters) {
+				t.Errorf("Len() = %d, want %d", tree.Len(), len(tt.filters))
+			}
+		})
+	}
+}
+
+func TestFilterTreeLookup(t *testing.T) {
+	tree := assembled.NewFilterTree(filters("a:EMEA:", "b:Tier 1:a", "c:Tier 1:a", "d:Billing:b", "e:Billing:"))
+	tests := []struct {
+		path string
+		want string // ID, or an error.
+	}{
+		{"EMEA", "a"},
+		{"Billing", "e"},
+		{"EMEA/Tier 1", "assembled: 2 filters with path \"EMEA/Tier 1\""},
+		{"EMEA/Tier 1/Billing", "d"},
+		{"Tier 1", "assembled: no filter with path \"Tier 1\""},
+		{"EMEA/Tier 2", "assembled: no filter with path \"EMEA/Tier 2\""},
+	}
+	for _, tt := range tests {
+		n, err := tree.Lookup(tt.path)
+		got := fmt.Sprint(err)
+		if err == nil {
+			got = n.ID
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%q) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+
+	d := tree.Node("d")
+	if nodeIDs(d.Ancestors()) != "b,a" || d.Depth() != 2 || !tree.Node("a").IsAncestorOf(d) || d.IsAncestorOf(d) {
+		t.Errorf("ancestors of d: %s, depth %d", nodeIDs(d.Ancestors()), d.Depth())
+	}
+	if got := nodeIDs(tree.Node("a").Descendants()); got != "b,d,c" {
+		t.Errorf("descendants of a: %s, want b,d,c", got)
+	}
+}
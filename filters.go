@@ -0,0 +1,171 @@
+package assembled
+
+import (
+	"context"
+	"fmt"
+)
+
+// FilterKind is one of the kinds of filters used to group agents and
+// activities. Queues, sites, teams and skills share the same endpoints apart
+// from their paths, so the methods taking a FilterKind manage any of them.
+//
+// The per-kind methods, such as ListTeams and UpdateTeams, are generated
+// from the API description and left as they are. They send the same
+// requests as the methods taking a FilterKind.
+type FilterKind string
+
+const (
+	FilterQueue FilterKind = "queues"
+	FilterSite  FilterKind = "sites"
+	FilterTeam  FilterKind = "teams"
+	FilterSkill FilterKind = "skills"
+)
+
+// FilterKinds lists every FilterKind.
+var FilterKinds = []FilterKind{FilterQueue, FilterSite, FilterTeam, FilterSkill}
+
+// Singular returns the singular name of the kind, such as "team", or the
+// kind itself if it is unknown.
+func (k FilterKind) Singular() string {
+	switch k {
+	case FilterQueue:
+		return "queue"
+	case FilterSite:
+		return "site"
+	case FilterTeam:
+		return "team"
+	case FilterSkill:
+		return "skill"
+	}
+	return string(k)
+}
+
+func (k FilterKind) validate() error {
+	for _, kind := range FilterKinds {
+		if k == kind {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown filter kind %q", string(k))
+}
+
+// FilterField is the JSON name of a field of UpdateFilterRequest, as passed
+// to UpdateFilterFields.
+type FilterField string
+
+const (
+	FilterFieldName     FilterField = "name"
+	FilterFieldParentID FilterField = "parent_id"
+)
+
+// UpdateFilterRequest is the request of UpdateFilter, with the fields of the
+// generated per-kind requests such as UpdateTeamsRequest.
+type UpdateFilterRequest struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+// Returns UpdateFilterRequest with ID set to the empty string so that it's
+// not included in the JSON request body.
+func (r *UpdateFilterRequest) body() interface{} {
+	if r == nil {
+		return r
+	}
+	req := *r
+	req.ID = ""
+	return &req
+}
+
+// ListFilters returns every filter of the given kind, by ID.
+func (c *Client) ListFilters(ctx context.Context, kind FilterKind) (map[string]Filter, error) {
+	filters, err := c.listFilters(ctx, kind)
+	if err != nil {
+		return nil, fmt.Errorf("ListFilters: %w", err)
+	}
+	return filters, nil
+}
+
+// CreateFilters creates filters of the given kind and returns them by ID.
+func (c *Client) CreateFilters(ctx context.Context, kind FilterKind, filters []Filter) (map[string]Filter, error) {
+	created, err := c.createFilters(ctx, kind, filters)
+	if err != nil {
+		return nil, fmt.Errorf("CreateFilters: %w", err)
+	}
+	return created, nil
+}
+
+// UpdateFilter renames or re-parents a filter of the given kind. Empty
+// fields of r are left unchanged; use UpdateFilterFields to clear them.
+func (c *Client) UpdateFilter(ctx context.Context, kind FilterKind, r *UpdateFilterRequest) (*Filter, error) {
+	f, err := c.updateFilter(ctx, kind, r.ID, r.body())
+	if err != nil {
+		return nil, fmt.Errorf("UpdateFilter: %w", err)
+	}
+	return f, nil
+}
+
+// UpdateFilterFields is like UpdateFilter, but sends exactly the given
+// fields of r, as UpdateAgentFields does. To make a filter a root, pass
+// FilterFieldParentID and leave ParentID empty.
+func (c *Client) UpdateFilterFields(ctx context.Context, kind FilterKind, r *UpdateFilterRequest, fields ...FilterField) (*Filter, error) {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = string(f)
+	}
+	f, err := c.updateFilter(ctx, kind, r.ID, partial{r, names})
+	if err != nil {
+		return nil, fmt.Errorf("UpdateFilterFields: %w", err)
+	}
+	return f, nil
+}
+
+// DeleteFilters deletes the filters of the given kind with the given IDs.
+func (c *Client) DeleteFilters(ctx context.Context, kind FilterKind, ids []string) error {
+	if err := c.deleteFilters(ctx, kind, ids); err != nil {
+		return fmt.Errorf("DeleteFilters: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) listFilters(ctx context.Context, kind FilterKind) (map[string]Filter, error) {
+	if err := kind.validate(); err != nil {
+		return nil, err
+	}
+	var resp map[string]map[string]Filter
+	if err := c.request(ctx, "GET", "/v0/"+string(kind), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp[string(kind)], nil
+}
+
+func (c *Client) createFilters(ctx context.Context, kind FilterKind, filters []Filter) (map[string]Filter, error) {
+	if err := kind.validate(); err != nil {
+		return nil, err
+	}
+	in := map[string][]Filter{string(kind): filters}
+	var resp map[string]map[string]Filter
+	if err := c.request(ctx, "POST", "/v0/"+string(kind), nil, in, &resp); err != nil {
+		return nil, err
+	}
+	return resp[string(kind)], nil
+}
+
+func (c *Client) updateFilter(ctx context.Context, kind FilterKind, id string, body interface{}) (*Filter, error) {
+	if err := kind.validate(); err != nil {
+		return nil, err
+	}
+	var resp Filter
+	if err := c.request(ctx, "PUT", fmt.Sprintf("/v0/%s/%s", kind, id), nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) deleteFilters(ctx context.Context, kind FilterKind, ids []string) error {
+	if err := kind.validate(); err != nil {
+		return err
+	}
+	in := map[string][]string{kind.Singular() + "_ids": ids}
+	return c.request(ctx, "DELETE", "/v0/"+string(kind), nil, in, nil)
+}
@@ -0,0 +1,416 @@
+package assembled
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SyncFiltersRequest describes the hierarchy of filters of one kind that
+// should exist, for example the teams of an HR system.
+type SyncFiltersRequest struct {
+	Kind FilterKind
+
+	// Filters that should exist. Names must be unique, and each Parent must
+	// be the name of another desired filter.
+	Desired []DesiredFilter
+
+	// If true, existing filters that match no desired filter are left alone
+	// instead of deleted.
+	KeepUnmatched bool
+
+	// If true, filters are deleted even while agents reference them.
+	// Otherwise such filters, and their ancestors, are reported in the plan
+	// as blocked.
+	DeleteReferenced bool
+
+	// If true, the plan is computed but not applied.
+	DryRun bool
+}
+
+// DesiredFilter is a filter that should exist.
+type DesiredFilter struct {
+	// Optional ID of the existing filter this corresponds to. Setting it
+	// allows a filter to be renamed; otherwise filters are matched by name.
+	ID string
+
+	Name   string
+	Parent string // Name of the parent filter, or empty for a root.
+}
+
+// FilterPlan lists the changes needed to make the filters of one kind match
+// a desired hierarchy.
+type FilterPlan struct {
+	Kind FilterKind
+
+	Create []FilterChange // Parents before children.
+	Update []FilterChange // Renames and moves, parents before children.
+	Delete []FilterChange // Children before parents.
+
+	// Deletions withheld because agents still reference the filter or one
+	// of its descendants.
+	Blocked []FilterChange
+
+	// Existing filters already matching a desired filter.
+	Unchanged []FilterChange
+
+	// Whether the plan was sent to the API.
+	Applied bool
+}
+
+// FilterChange is a single change of a FilterPlan.
+type FilterChange struct {
+	ID       string // Empty for filters not yet created.
+	Name     string
+	Path     string // Slash-separated names from the root, as desired or, for deletions, as existing.
+	ParentID string // Empty for roots and parents not yet created.
+
+	// Previous name and parent of updated filters.
+	OldName     string
+	OldParentID string
+
+	// Agents referencing a blocked filter. Empty if only a descendant is
+	// referenced.
+	AgentIDs []string
+
+	parent string // Desired parent name.
+	depth  int
+}
+
+// Empty reports whether the plan makes no changes.
+func (p *FilterPlan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// String describes the plan, one change per line, for review before it is
+// applied.
+func (p *FilterPlan) String() string {
+	var b strings.Builder
+	kind := p.Kind.Singular()
+	for _, c := range p.Create {
+		fmt.Fprintf(&b, "create %s %s\n", kind, c.Path)
+	}
+	for _, c := range p.Update {
+		if c.Name != c.OldName {
+			fmt.Fprintf(&b, "rename %s %s to %q\n", kind, c.OldName, c.Name)
+		}
+		if c.ParentID != c.OldParentID || c.parent != "" && c.ParentID == "" {
+			fmt.Fprintf(&b, "move %s %s to %s\n", kind, c.Name, c.Path)
+		}
+	}
+	for _, c := range p.Delete {
+		fmt.Fprintf(&b, "delete %s %s\n", kind, c.Path)
+	}
+	for _, c := range p.Blocked {
+		switch len(c.AgentIDs) {
+		case 0:
+			fmt.Fprintf(&b, "keep %s %s: a descendant is referenced by agents\n", kind, c.Path)
+		case 1:
+			fmt.Fprintf(&b, "keep %s %s: referenced by agent %s\n", kind, c.Path, c.AgentIDs[0])
+		default:
+			fmt.Fprintf(&b, "keep %s %s: referenced by %d agents\n", kind, c.Path, len(c.AgentIDs))
+		}
+	}
+	return b.String()
+}
+
+// SyncFilters compares the desired hierarchy of r against the filters in
+// Assembled and applies the difference, unless r.DryRun is set.
+//
+// Filters are created parents first, with one CreateFilters call per level
+// of the hierarchy, then renamed and moved with UpdateFilter, then deleted
+// children first with one DeleteFilters call per level. If a call fails the
+// plan is returned with the error, with the IDs of the filters created so
+// far filled in.
+func (c *Client) SyncFilters(ctx context.Context, r *SyncFiltersRequest) (*FilterPlan, error) {
+	if err := r.Kind.validate(); err != nil {
+		return nil, fmt.Errorf("SyncFilters: %w", err)
+	}
+	existing, err := c.ListFilters(ctx, r.Kind)
+	if err != nil {
+		return nil, fmt.Errorf("SyncFilters: %w", err)
+	}
+	plan, err := planFilters(r, existing)
+	if err != nil {
+		return nil, fmt.Errorf("SyncFilters: %w", err)
+	}
+
+	if len(plan.Delete) > 0 && !r.DeleteReferenced {
+		agents, err := c.ListAgents(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("SyncFilters: %w", err)
+		}
+		plan.block(NewFilterTree(existing), filterReferences(r.Kind, agents.Agents))
+	}
+	if r.DryRun || plan.Empty() {
+		return plan, nil
+	}
+	if err := c.applyFilterPlan(ctx, plan); err != nil {
+		return plan, fmt.Errorf("SyncFilters: %w", err)
+	}
+	plan.Applied = true
+	return plan, nil
+}
+
+// planFilters computes the changes turning existing into the desired
+// filters of r. Nothing is blocked yet.
+func planFilters(r *SyncFiltersRequest, existing map[string]Filter) (*FilterPlan, error) {
+	desired := make(map[string]DesiredFilter, len(r.Desired))
+	for _, d := range r.Desired {
+		if d.Name == "" {
+			return nil, fmt.Errorf("desired %s without a name", r.Kind.Singular())
+		}
+		if _, dup := desired[d.Name]; dup {
+			return nil, fmt.Errorf("several desired %s named %q", r.Kind, d.Name)
+		}
+		desired[d.Name] = d
+	}
+	paths := make(map[string]string, len(desired))
+	depths := make(map[string]int, len(desired))
+	for _, d := range r.Desired {
+		names := []string{d.Name}
+		for p := d.Parent; p != ""; p = desired[p].Parent {
+			if _, ok := desired[p]; !ok {
+				return nil, fmt.Errorf("desired %s %q has unknown parent %q", r.Kind.Singular(), d.Name, p)
+			}
+			if len(names) > len(desired) {
+				return nil, fmt.Errorf("desired %s %q is its own ancestor", r.Kind.Singular(), d.Name)
+			}
+			names = append(names, p)
+		}
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+		paths[d.Name] = strings.Join(names, "/")
+		depths[d.Name] = len(names) - 1
+	}
+
+	// Match desired filters to existing ones, first by ID, then by name.
+	matched := make(map[string]string, len(desired)) // Desired name to existing ID.
+	taken := make(map[string]bool, len(existing))
+	for _, d := range r.Desired {
+		if d.ID == "" {
+			continue
+		}
+		if _, ok := existing[d.ID]; !ok {
+			return nil, fmt.Errorf("desired %s %q has unknown ID %s", r.Kind.Singular(), d.Name, d.ID)
+		}
+		if taken[d.ID] {
+			return nil, fmt.Errorf("several desired %s with ID %s", r.Kind, d.ID)
+		}
+		matched[d.Name] = d.ID
+		taken[d.ID] = true
+	}
+	byName := make(map[string][]string)
+	for id, f := range existing {
+		if !taken[id] {
+			byName[f.Name] = append(byName[f.Name], id)
+		}
+	}
+	for _, d := range r.Desired {
+		if d.ID != "" {
+			continue
+		}
+		switch ids := byName[d.Name]; len(ids) {
+		case 0:
+		case 1:
+			matched[d.Name] = ids[0]
+			taken[ids[0]] = true
+		default:
+			sort.Strings(ids)
+			return nil, fmt.Errorf("several existing %s named %q (%s); set the ID of the desired one", r.Kind, d.Name, strings.Join(ids, ", "))
+		}
+	}
+
+	plan := &FilterPlan{Kind: r.Kind}
+	for _, d := range r.Desired {
+		change := FilterChange{
+			Name:     d.Name,
+			Path:     paths[d.Name],
+			ParentID: matched[d.Parent],
+			parent:   d.Parent,
+			depth:    depths[d.Name],
+		}
+		id, ok := matched[d.Name]
+		if !ok {
+			plan.Create = append(plan.Create, change)
+			continue
+		}
+		f := existing[id]
+		change.ID = id
+		change.OldName = f.Name
+		change.OldParentID = f.ParentID
+		// A parent that is not yet created never matches the current one.
+		if f.Name == d.Name && f.ParentID == change.ParentID && (d.Parent == "" || change.ParentID != "") {
+			plan.Unchanged = append(plan.Unchanged, change)
+		} else {
+			plan.Update = append(plan.Update, change)
+		}
+	}
+
+	if !r.KeepUnmatched {
+		tree := NewFilterTree(existing)
+		for id := range existing {
+			if taken[id] {
+				continue
+			}
+			n := tree.Node(id)
+			plan.Delete = append(plan.Delete, FilterChange{
+				ID:          id,
+				Name:        n.Name,
+				Path:        n.Path(),
+				ParentID:    n.ParentID,
+				OldName:     n.Name,
+				OldParentID: n.ParentID,
+				depth:       n.Depth(),
+			})
+		}
+	}
+
+	sortChanges(plan.Create, false)
+	sortChanges(plan.Update, false)
+	sortChanges(plan.Unchanged, false)
+	sortChanges(plan.Delete, true)
+	return plan, nil
+}
+
+// block moves to Blocked the deletions of filters referenced by agents, and
+// of their ancestors, which cannot be deleted without orphaning them.
+func (p *FilterPlan) block(tree *FilterTree, refs map[string][]string) {
+	blocked := make(map[string]bool)
+	for id := range refs {
+		n := tree.Node(id)
+		if n == nil {
+			continue
+		}
+		blocked[id] = true
+		for _, a := range n.Ancestors() {
+			blocked[a.ID] = true
+		}
+	}
+	var keep []FilterChange
+	for _, c := range p.Delete {
+		if blocked[c.ID] {
+			c.AgentIDs = refs[c.ID]
+			p.Blocked = append(p.Blocked, c)
+		} else {
+			keep = append(keep, c)
+		}
+	}
+	p.Delete = keep
+}
+
+// filterReferences returns the IDs of the agents referencing each filter of
+// the given kind, by filter ID.
+func filterReferences(kind FilterKind, agents map[string]Agent) map[string][]string {
+	refs := make(map[string][]string)
+	for id, a := range agents {
+		var ids []string
+		switch kind {
+		case FilterQueue:
+			ids = a.Queues
+		case FilterSite:
+			if a.Site != "" {
+				ids = []string{a.Site}
+			}
+		case FilterTeam:
+			ids = a.Teams
+		case FilterSkill:
+			ids = a.Skills
+		}
+		for _, f := range ids {
+			refs[f] = append(refs[f], id)
+		}
+	}
+	for _, ids := range refs {
+		sort.Strings(ids)
+	}
+	return refs
+}
+
+func (c *Client) applyFilterPlan(ctx context.Context, p *FilterPlan) error {
+	ids := make(map[string]string) // Desired name to ID.
+	for _, ch := range p.Unchanged {
+		ids[ch.Name] = ch.ID
+	}
+	for _, ch := range p.Update {
+		ids[ch.Name] = ch.ID
+	}
+
+	for _, level := range changeLevels(p.Create) {
+		filters := make([]Filter, len(level))
+		for i, ch := range level {
+			ch.ParentID = ids[ch.parent]
+			filters[i] = Filter{Name: ch.Name, ParentID: ch.ParentID}
+		}
+		created, err := c.createFilters(ctx, p.Kind, filters)
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", p.Kind, err)
+		}
+		for id, f := range created {
+			ids[f.Name] = id
+		}
+		for _, ch := range level {
+			ch.ID = ids[ch.Name]
+		}
+	}
+
+	for i := range p.Update {
+		ch := &p.Update[i]
+		ch.ParentID = ids[ch.parent]
+		var fields []string
+		if ch.Name != ch.OldName {
+			fields = append(fields, string(FilterFieldName))
+		}
+		if ch.ParentID != ch.OldParentID {
+			fields = append(fields, string(FilterFieldParentID))
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		req := &UpdateFilterRequest{ID: ch.ID, Name: ch.Name, ParentID: ch.ParentID}
+		if _, err := c.updateFilter(ctx, p.Kind, ch.ID, partial{req, fields}); err != nil {
+			return fmt.Errorf("updating %s %s: %w", p.Kind.Singular(), ch.ID, err)
+		}
+	}
+
+	for _, level := range changeLevels(p.Delete) {
+		batch := make([]string, len(level))
+		for i, ch := range level {
+			batch[i] = ch.ID
+		}
+		if err := c.deleteFilters(ctx, p.Kind, batch); err != nil {
+			return fmt.Errorf("deleting %s: %w", p.Kind, err)
+		}
+	}
+	return nil
+}
+
+// changeLevels groups consecutive changes of the same depth, pointing into
+// changes so that they can be updated in place.
+func changeLevels(changes []FilterChange) [][]*FilterChange {
+	var levels [][]*FilterChange
+	for i := range changes {
+		if i == 0 || changes[i].depth != changes[i-1].depth {
+			levels = append(levels, nil)
+		}
+		levels[len(levels)-1] = append(levels[len(levels)-1], &changes[i])
+	}
+	return levels
+}
+
+// sortChanges orders changes by depth, shallowest first unless deepest is
+// set, then by path.
+func sortChanges(changes []FilterChange, deepest bool) {
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.depth != b.depth {
+			return a.depth < b.depth != deepest
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.ID < b.ID
+	})
+}
@@ -0,0 +1,232 @@
+package assembled_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+// addTeam adds a team below the one with ID parent, or a root if empty.
+func addTeam(srv *assembledtest.Server, name, parent string) string {
+	return srv.AddFilter("teams", assembled.Filter{Name: name, ParentID: parent}).ID
+}
+
+// teamPaths returns the paths of the teams of srv, parents first.
+func teamPaths(srv *assembledtest.Server) string {
+	var paths []string
+	for _, n := range assembled.NewFilterTree(srv.Filters("teams")).Nodes() {
+		paths = append(paths, n.Path())
+	}
+	return strings.Join(paths, ", ")
+}
+
+// writes returns the requests of srv other than GET since the n-th.
+func writes(srv *assembledtest.Server, n int) []assembledtest.Request {
+	var out []assembledtest.Request
+	for _, r := range srv.Requests()[n:] {
+		if r.Method != "GET" {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func syncTeams(t *testing.T, srv *assembledtest.Server, r *assembled.SyncFiltersRequest) *assembled.FilterPlan {
+	t.Helper()
+	r.Kind = assembled.FilterTeam
+	plan, err := srv.Client().SyncFilters(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestSyncFiltersOrder(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	old := addTeam(srv, "Old", "")
+	child := addTeam(srv, "Child", old)
+	leaf := addTeam(srv, "Leaf", child)
+	n := len(srv.Requests())
+
+	plan := syncTeams(t, srv, &assembled.SyncFiltersRequest{Desired: []assembled.DesiredFilter{
+		{Name: "Billing", Parent: "Tier 1"},
+		{Name: "Tier 1", Parent: "EMEA"},
+		{Name: "EMEA"},
+		{Name: "APAC"},
+	}})
+	if !plan.Applied {
+		t.Error("plan not applied")
+	}
+	if got, want := teamPaths(srv), "APAC, EMEA, EMEA/Tier 1, EMEA/Tier 1/Billing"; got != want {
+		t.Errorf("teams %s, want %s", got, want)
+	}
+	for _, c := range plan.Create {
+		if c.ID == "" {
+			t.Errorf("created %s without an ID in the plan", c.Path)
+		}
+	}
+
+	// One call per level: parents are created first, and deleted last.
+	var calls []string
+	for _, r := range writes(srv, n) {
+		switch r.Method {
+		case "POST":
+			var body map[string][]assembled.Filter
+			json.Unmarshal(r.Body, &body)
+			var names []string
+			for _, f := range body["teams"] {
+				names = append(names, f.Name)
+			}
+			sort.Strings(names)
+			calls = append(calls, "create "+strings.Join(names, " "))
+		case "DELETE":
+			var body map[string][]string
+			json.Unmarshal(r.Body, &body)
+			calls = append(calls, "delete "+strings.Join(body["team_ids"], " "))
+		default:
+			calls = append(calls, r.Method+" "+r.Path)
+		}
+	}
+	want := []string{"create APAC EMEA", "create Tier 1", "create Billing", "delete " + leaf, "delete " + child, "delete " + old}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("calls %q, want %q", calls, want)
+	}
+}
+
+func TestSyncFiltersRenameAndMove(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	a := addTeam(srv, "A", "")
+	b := addTeam(srv, "B", "")
+	x := addTeam(srv, "X", a)
+	y := addTeam(srv, "Y", a)
+	n := len(srv.Requests())
+
+	plan := syncTeams(t, srv, &assembled.SyncFiltersRequest{Desired: []assembled.DesiredFilter{
+		{ID: a, Name: "Alpha"},
+		{Name: "B"},
+		{Name: "X", Parent: "B"},
+		{Name: "Y"},
+	}})
+	if len(plan.Create) != 0 || len(plan.Delete) != 0 || len(plan.Update) != 3 || len(plan.Unchanged) != 1 {
+		t.Errorf("plan:\n%s", plan)
+	}
+	if got, want := teamPaths(srv), "Alpha, B, B/X, Y"; got != want {
+		t.Errorf("teams %s, want %s", got, want)
+	}
+
+	// Only the fields changed are sent, and a move to the top level clears
+	// the parent.
+	bodies := make(map[string]string)
+	for _, r := range writes(srv, n) {
+		bodies[r.Method+" "+r.Path] = string(r.Body)
+	}
+	want := map[string]string{
+		"PUT /v0/teams/" + a: `{"name":"Alpha"}`,
+		"PUT /v0/teams/" + x: `{"parent_id":"` + b + `"}`,
+		"PUT /v0/teams/" + y: `{"parent_id":null}`,
+	}
+	if fmt.Sprint(bodies) != fmt.Sprint(want) {
+		t.Errorf("requests %v, want %v", bodies, want)
+	}
+}
+
+func TestSyncFiltersBlocked(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	old := addTeam(srv, "Old", "")
+	used := addTeam(srv, "Used", old)
+	addTeam(srv, "Unused", old)
+	ada := srv.AddAgent(assembled.Agent{Name: "Ada", Teams: []string{used}}).ID
+
+	plan := syncTeams(t, srv, &assembled.SyncFiltersRequest{})
+	want := "delete team Old/Unused\n" +
+		"keep team Old/Used: referenced by agent " + ada + "\n" +
+		"keep team Old: a descendant is referenced by agents\n"
+	if got := plan.String(); got != want {
+		t.Errorf("plan:\n%s\nwant:\n%s", got, want)
+	}
+	if got := teamPaths(srv); got != "Old, Old/Used" {
+		t.Errorf("teams %s, want Old, Old/Used", got)
+	}
+
+	plan = syncTeams(t, srv, &assembled.SyncFiltersRequest{DeleteReferenced: true})
+	if len(plan.Delete) != 2 || len(plan.Blocked) != 0 || teamPaths(srv) != "" {
+		t.Errorf("plan:\n%s\nteams left: %s", plan, teamPaths(srv))
+	}
+}
+
+func TestSyncFiltersKeepUnmatchedAndDryRun(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	addTeam(srv, "Kept", "")
+	desired := []assembled.DesiredFilter{{Name: "New"}}
+	n := len(srv.Requests())
+
+	plan := syncTeams(t, srv, &assembled.SyncFiltersRequest{Desired: desired, DryRun: true})
+	if plan.Applied || plan.String() != "create team New\ndelete team Kept\n" {
+		t.Errorf("dry run plan (applied %v):\n%s", plan.Applied, plan)
+	}
+	if w := writes(srv, n); len(w) != 0 {
+		t.Errorf("dry run sent %v", w)
+	}
+
+	plan = syncTeams(t, srv, &assembled.SyncFiltersRequest{Desired: desired, KeepUnmatched: true})
+	if len(plan.Delete) != 0 || !plan.Applied {
+		t.Errorf("plan (applied %v):\n%s", plan.Applied, plan)
+	}
+	if got := teamPaths(srv); got != "Kept, New" {
+		t.Errorf("teams %s, want Kept, New", got)
+	}
+}
+
+func TestSyncFiltersInvalid(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	tier1 := addTeam(srv, "Tier 1", "")
+	addTeam(srv, "Tier 1", "")
+	n := len(srv.Requests())
+
+	tests := []struct {
+		name    string
+		desired []assembled.DesiredFilter
+		err     string
+	}{
+		{"ambiguous existing name", []assembled.DesiredFilter{{Name: "Tier 1"}}, "several existing teams named"},
+		{"duplicate name", []assembled.DesiredFilter{{ID: tier1, Name: "A"}, {Name: "A"}}, "several desired teams named"},
+		{"cycle", []assembled.DesiredFilter{{ID: tier1, Name: "Tier 1"}, {Name: "A", Parent: "B"}, {Name: "B", Parent: "A"}}, "is its own ancestor"},
+		{"self parent", []assembled.DesiredFilter{{ID: tier1, Name: "Tier 1", Parent: "Tier 1"}}, "is its own ancestor"},
+		{"unknown parent", []assembled.DesiredFilter{{ID: tier1, Name: "Tier 1", Parent: "EMEA"}}, "unknown parent"},
+		{"unknown ID", []assembled.DesiredFilter{{ID: "team_0", Name: "Tier 1"}}, "unknown ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := srv.Client().SyncFilters(context.Background(), &assembled.SyncFiltersRequest{
+				Kind:    assembled.FilterTeam,
+				Desired: tt.desired,
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+	if w := writes(srv, n); len(w) != 0 {
+		t.Errorf("invalid requests sent %v", w)
+	}
+
+	// Setting the ID resolves the ambiguity.
+	plan := syncTeams(t, srv, &assembled.SyncFiltersRequest{
+		Desired:       []assembled.DesiredFilter{{ID: tier1, Name: "Tier 1"}},
+		KeepUnmatched: true,
+	})
+	if !plan.Empty() || len(plan.Unchanged) != 1 {
+		t.Errorf("plan:\n%s", plan)
+	}
+}
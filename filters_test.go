@@ -0,0 +1,252 @@
+package assembled_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+func TestFilterKindSingular(t *testing.T) {
+	want := map[assembled.FilterKind]string{
+		assembled.FilterQueue: "queue",
+		assembled.FilterSite:  "site",
+		assembled.FilterTeam:  "team",
+		assembled.FilterSkill: "skill",
+		"regions":             "regions",
+	}
+	for kind, singular := range want {
+		if got := kind.Singular(); got != singular {
+			t.Errorf("%q.Singular() = %q, want %q", kind, got, singular)
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	c := srv.Client()
+	ctx := context.Background()
+
+	for _, kind := range assembled.FilterKinds {
+		created, err := c.CreateFilters(ctx, kind, []assembled.Filter{{Name: "a"}, {Name: "b"}})
+		if err != nil || len(created) != 2 {
+			t.Fatalf("CreateFilters(%s) = %v, %v", kind, created, err)
+		}
+		var ids []string
+		for id := range created {
+			ids = append(ids, id)
+		}
+		if err := c.DeleteFilters(ctx, kind, ids[:1]); err != nil {
+			t.Fatalf("DeleteFilters(%s): %v", kind, err)
+		}
+		left, err := c.ListFilters(ctx, kind)
+		if err != nil || len(left) != 1 || left[ids[1]].Name == "" {
+			t.Errorf("ListFilters(%s) = %v, %v, want only %s", kind, left, err, ids[1])
+		}
+	}
+
+	// The generated per-kind methods see the same filters.
+	teams, err := c.ListTeams(ctx)
+	if err != nil || len(teams.Teams) != 1 {
+		t.Errorf("ListTeams = %+v, %v", teams, err)
+	}
+	if _, err := c.ListFilters(ctx, "regions"); err == nil {
+		t.Error("ListFilters(regions) succeeded")
+	}
+}
+
+// filterOps are the operations on the filters of one kind.
+type filterOps struct {
+	create func(c *assembled.Client, filters []assembled.Filter) (map[string]assembled.Filter, error)
+	update func(c *assembled.Client, id, name string) error
+	list   func(c *assembled.Client) (map[string]assembled.Filter, error)
+	delete func(c *assembled.Client, ids []string) error
+}
+
+func genericOps(kind assembled.FilterKind) filterOps {
+	ctx := context.Background()
+	return filterOps{
+		create: func(c *assembled.Client, filters []assembled.Filter) (map[string]assembled.Filter, error) {
+			return c.CreateFilters(ctx, kind, filters)
+		},
+		update: func(c *assembled.Client, id, name string) error {
+			_, err := c.UpdateFilter(ctx, kind, &assembled.UpdateFilterRequest{ID: id, Name: name})
+			return err
+		},
+		list: func(c *assembled.Client) (map[string]assembled.Filter, error) {
+			return c.ListFilters(ctx, kind)
+		},
+		delete: func(c *assembled.Client, ids []string) error {
+			return c.DeleteFilters(ctx, kind, ids)
+		},
+	}
+}
+
+// generatedOps are the generated per-kind methods, which the methods taking
+// a FilterKind must match.
+var generatedOps = map[assembled.FilterKind]filterOps{
+	assembled.FilterQueue: {
+		create: func(c *assembled.Client, filters []assembled.Filter) (map[string]assembled.Filter, error) {
+			l, err := c.CreateQueue(context.Background(), &assembled.CreateQueueRequest{Queues: filters})
+			if err != nil {
+				return nil, err
+			}
+			return l.Queues, nil
+		},
+		update: func(c *assembled.Client, id, name string) error {
+			_, err := c.UpdateQueues(context.Background(), &assembled.UpdateQueuesRequest{ID: id, Name: name})
+			return err
+		},
+		list: func(c *assembled.Client) (map[string]assembled.Filter, error) {
+			l, err := c.ListQueues(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			return l.Queues, nil
+		},
+		delete: func(c *assembled.Client, ids []string) error {
+			return c.DeleteQueues(context.Background(), &assembled.DeleteQueuesRequest{QueueIDs: ids})
+		},
+	},
+	assembled.FilterSite: {
+		create: func(c *assembled.Client, filters []assembled.Filter) (map[string]assembled.Filter, error) {
+			l, err := c.CreateSite(context.Background(), &assembled.CreateSiteRequest{Sites: filters})
+			if err != nil {
+				return nil, err
+			}
+			return l.Sites, nil
+		},
+		update: func(c *assembled.Client, id, name string) error {
+			_, err := c.UpdateSites(context.Background(), &assembled.UpdateSitesRequest{ID: id, Name: name})
+			return err
+		},
+		list: func(c *assembled.Client) (map[string]assembled.Filter, error) {
+			l, err := c.ListSites(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			return l.Sites, nil
+		},
+		delete: func(c *assembled.Client, ids []string) error {
+			return c.DeleteSites(context.Background(), &assembled.DeleteSitesRequest{SiteIDs: ids})
+		},
+	},
+	assembled.FilterTeam: {
+		create: func(c *assembled.Client, filters []assembled.Filter) (map[string]assembled.Filter, error) {
+			l, err := c.CreateTeam(context.Background(), &assembled.CreateTeamRequest{Teams: filters})
+			if err != nil {
+				return nil, err
+			}
+			return l.Teams, nil
+		},
+		update: func(c *assembled.Client, id, name string) error {
+			_, err := c.UpdateTeams(context.Background(), &assembled.UpdateTeamsRequest{ID: id, Name: name})
+			return err
+		},
+		list: func(c *assembled.Client) (map[string]assembled.Filter, error) {
+			l, err := c.ListTeams(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			return l.Teams, nil
+		},
+		delete: func(c *assembled.Client, ids []string) error {
+			return c.DeleteTeams(context.Background(), &assembled.DeleteTeamsRequest{TeamIDs: ids})
+		},
+	},
+	assembled.FilterSkill: {
+		create: func(c *assembled.Client, filters []assembled.Filter) (map[string]assembled.Filter, error) {
+			l, err := c.CreateSkill(context.Background(), &assembled.CreateSkillRequest{Skills: filters})
+			if err != nil {
+				return nil, err
+			}
+			return l.Skills, nil
+		},
+		update: func(c *assembled.Client, id, name string) error {
+			_, err := c.UpdateSkills(context.Background(), &assembled.UpdateSkillsRequest{ID: id, Name: name})
+			return err
+		},
+		list: func(c *assembled.Client) (map[string]assembled.Filter, error) {
+			l, err := c.ListSkills(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			return l.Skills, nil
+		},
+		delete: func(c *assembled.Client, ids []string) error {
+			return c.DeleteSkills(context.Background(), &assembled.DeleteSkillsRequest{SkillIDs: ids})
+		},
+	},
+}
+
+// filterRequests runs every operation of ops on a new server, and returns
+// the requests received and the filters left.
+func filterRequests(t *testing.T, ops filterOps) ([]assembledtest.Request, map[string]assembled.Filter) {
+	t.Helper()
+	srv := assembledtest.NewServer()
+	defer srv.Close()
+	c := srv.Client()
+	created, err := ops.create(c, []assembled.Filter{{Name: "a"}, {Name: "b"}})
+	if err != nil || len(created) != 2 {
+		t.Fatalf("create: %v, %v", created, err)
+	}
+	var ids []string
+	for id, f := range created {
+		if f.Name == "a" {
+			ids = append(ids, id)
+		} else {
+			ids = append([]string{id}, ids...)
+		}
+	}
+	if err := ops.update(c, ids[1], "c"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := ops.delete(c, ids[:1]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	left, err := ops.list(c)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	return srv.Requests(), left
+}
+
+// The per-kind methods are generated, and so left as they are, rather than
+// made wrappers of the methods taking a FilterKind. Both must send the same
+// requests.
+func TestFilterKindMatchesGenerated(t *testing.T) {
+	for _, kind := range assembled.FilterKinds {
+		t.Run(string(kind), func(t *testing.T) {
+			want, wantLeft := filterRequests(t, generatedOps[kind])
+			got, left := filterRequests(t, genericOps(kind))
+			if len(got) != len(want) {
+				t.Fatalf("%d requests, want %d", len(got), len(want))
+			}
+			for i := range got {
+				g := fmt.Sprintf("%s %s?%s %s", got[i].Method, got[i].Path, got[i].Query, got[i].Body)
+				w := fmt.Sprintf("%s %s?%s %s", want[i].Method, want[i].Path, want[i].Query, want[i].Body)
+				if g != w {
+					t.Errorf("request %d:\n%s\nwant:\n%s", i, g, w)
+				}
+			}
+			if filterNames(left) != filterNames(wantLeft) || len(left) != 1 {
+				t.Errorf("filters left %s, want %s", filterNames(left), filterNames(wantLeft))
+			}
+		})
+	}
+}
+
+// filterNames formats filters as "id:name", ignoring their times.
+func filterNames(filters map[string]assembled.Filter) string {
+	var out []string
+	for id, f := range filters {
+		out = append(out, id+":"+f.Name)
+	}
+	sort.Strings(out)
+	return strings.Join(out, " ")
+}
@@ -0,0 +1,488 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// DecodeOptions controls how Decode turns events into activities.
+type DecodeOptions struct {
+	// Window in which activities are returned. Recurring events are expanded
+	// up to End, which must be set.
+	Start time.Time
+	End   time.Time
+
+	// Maps event categories, compared case-insensitively, to activity type
+	// IDs. The first category with a mapping wins. Events without one get
+	// DefaultTypeID.
+	Categories    map[string]string
+	DefaultTypeID string
+
+	// Maps attendee and organizer email addresses, compared
+	// case-insensitively, to agent IDs. An event yields one activity per
+	// mapped attendee, or for the organizer when no attendee is mapped.
+	// Events without any get DefaultAgentID.
+	Agents         map[string]string
+	DefaultAgentID string
+
+	// Location of floating times, which have no time zone. Defaults to UTC.
+	Location *time.Location
+
+	// Extra time zones by TZID, for identifiers that are not IANA names
+	// such as "Eastern Standard Time".
+	TimeZones map[string]*time.Location
+
+	// Copied to every request returned.
+	AllowConflicts bool
+	ScheduleID     string
+}
+
+// event is a parsed VEVENT.
+type event struct {
+	Line         int
+	UID          string
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	Duration     time.Duration
+	Summary      string
+	Description  string
+	Categories   []string
+	Attendees    []string
+	Organizer    string
+	AgentID      string
+	TypeID       string
+	RRule        string
+	ExDates      []time.Time
+	RDates       []time.Time
+	RecurrenceID time.Time
+	Cancelled    bool
+}
+
+// Decode parses iCalendar data and returns one CreateActivityRequest for
+// every occurrence of every event overlapping the window of opts, ordered by
+// start time. Recurring events are expanded from their RRULE, RDATE and
+// EXDATE properties, and modified occurrences (RECURRENCE-ID) replace the
+// ones they override. Cancelled events are skipped.
+//
+// Events written by Encode carry their agent and activity type IDs, which
+// take precedence over the mappings in opts.
+func Decode(r io.Reader, opts *DecodeOptions) ([]assembled.CreateActivityRequest, error) {
+	if opts == nil || opts.End.IsZero() || !opts.End.After(opts.Start) {
+		return nil, errors.New("ical: a window with End after Start is required")
+	}
+	o := *opts
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+
+	props, err := readProperties(r)
+	if err != nil {
+		return nil, fmt.Errorf("ical: %w", err)
+	}
+	events, err := parseEvents(props, &o)
+	if err != nil {
+		return nil, fmt.Errorf("ical: %w", err)
+	}
+
+	// Occurrences overridden by a RECURRENCE-ID event, by UID.
+	overridden := make(map[string]map[int64]bool)
+	for _, ev := range events {
+		if !ev.RecurrenceID.IsZero() {
+			if overridden[ev.UID] == nil {
+				overridden[ev.UID] = make(map[int64]bool)
+			}
+			overridden[ev.UID][ev.RecurrenceID.Unix()] = true
+		}
+	}
+
+	var out []assembled.CreateActivityRequest
+	for _, ev := range events {
+		if ev.Cancelled {
+			continue
+		}
+		starts, err := occurrences(ev, o.End)
+		if err != nil {
+			return nil, fmt.Errorf("ical: line %d: %w", ev.Line, err)
+		}
+		agents, typeID, err := resolve(ev, &o)
+		if err != nil {
+			return nil, fmt.Errorf("ical: line %d: %w", ev.Line, err)
+		}
+		for _, start := range starts {
+			if ev.RecurrenceID.IsZero() && overridden[ev.UID][start.Unix()] {
+				continue
+			}
+			end := start.Add(ev.Duration)
+			if ev.AllDay {
+				// Keep whole days across daylight saving changes.
+				end = start.AddDate(0, 0, int(ev.Duration/(24*time.Hour)))
+			}
+			if !end.After(o.Start) || !start.Before(o.End) {
+				continue
+			}
+			for _, agentID := range agents {
+				out = append(out, assembled.CreateActivityRequest{
+					AllowConflicts: o.AllowConflicts,
+					Description:    ev.description(),
+					ScheduleID:     o.ScheduleID,
+					AgentID:        agentID,
+					StartTime:      start,
+					EndTime:        end,
+					TypeID:         typeID,
+				})
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StartTime.Before(out[j].StartTime) })
+	return out, nil
+}
+
+// description returns the description of the activities of ev. Events
+// written by Encode always carry it in DESCRIPTION, and their SUMMARY may be
+// the name of the activity type instead.
+func (ev *event) description() string {
+	if ev.Description != "" || ev.TypeID != "" {
+		return ev.Description
+	}
+	return ev.Summary
+}
+
+// occurrences returns the start times of the occurrences of ev before limit.
+func occurrences(ev *event, limit time.Time) ([]time.Time, error) {
+	starts := []time.Time{ev.Start}
+	if ev.RRule != "" && ev.RecurrenceID.IsZero() {
+		rule, err := parseRRule(ev.RRule, ev.Start.Location())
+		if err != nil {
+			return nil, fmt.Errorf("RRULE: %w", err)
+		}
+		starts = rule.expand(ev.Start, limit)
+	}
+	starts = append(starts, ev.RDates...)
+
+	excluded := make(map[int64]bool)
+	for _, t := range ev.ExDates {
+		excluded[t.Unix()] = true
+	}
+	seen := make(map[int64]bool)
+	var out []time.Time
+	for _, t := range starts {
+		if excluded[t.Unix()] || seen[t.Unix()] {
+			continue
+		}
+		seen[t.Unix()] = true
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// resolve returns the agents and activity type of ev.
+func resolve(ev *event, o *DecodeOptions) ([]string, string, error) {
+	typeID := ev.TypeID
+	for _, c := range ev.Categories {
+		if typeID != "" {
+			break
+		}
+		typeID = lookupFold(o.Categories, c)
+	}
+	if typeID == "" {
+		typeID = o.DefaultTypeID
+	}
+	if typeID == "" {
+		return nil, "", fmt.Errorf("event %q has no activity type for categories %v", ev.UID, ev.Categories)
+	}
+
+	if ev.AgentID != "" {
+		return []string{ev.AgentID}, typeID, nil
+	}
+	var agents []string
+	for _, email := range ev.Attendees {
+		if id := lookupFold(o.Agents, email); id != "" {
+			agents = append(agents, id)
+		}
+	}
+	if len(agents) == 0 {
+		if id := lookupFold(o.Agents, ev.Organizer); id != "" {
+			agents = append(agents, id)
+		} else if o.DefaultAgentID != "" {
+			agents = append(agents, o.DefaultAgentID)
+		}
+	}
+	if len(agents) == 0 {
+		return nil, "", fmt.Errorf("event %q has no known attendee or organizer", ev.UID)
+	}
+	return agents, typeID, nil
+}
+
+func lookupFold(m map[string]string, key string) string {
+	if key == "" {
+		return ""
+	}
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseEvents collects the top-level VEVENTs of props, ignoring nested
+// components such as VALARM and other components such as VTIMEZONE.
+func parseEvents(props []property, o *DecodeOptions) ([]*event, error) {
+	var (
+		events []*event
+		stack  []string
+		ev     *event
+		hasEnd bool
+	)
+	for _, p := range props {
+		switch p.Name {
+		case "BEGIN":
+			name := strings.ToUpper(p.Value)
+			stack = append(stack, name)
+			if name == "VEVENT" && len(stack) == 2 {
+				ev = &event{Line: p.Line}
+				hasEnd = false
+			}
+			continue
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", p.Line, p.Value)
+			}
+			if ev != nil && len(stack) == 2 {
+				if err := ev.finish(hasEnd); err != nil {
+					return nil, fmt.Errorf("line %d: %w", ev.Line, err)
+				}
+				events = append(events, ev)
+				ev = nil
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if ev == nil || len(stack) != 2 {
+			continue
+		}
+
+		var err error
+		switch p.Name {
+		case "UID":
+			ev.UID = p.Value
+		case "DTSTART":
+			ev.Start, ev.AllDay, err = parseTimeProperty(p, o)
+		case "DTEND":
+			ev.End, _, err = parseTimeProperty(p, o)
+			hasEnd = true
+		case "DURATION":
+			ev.Duration, err = parseDuration(p.Value)
+		case "SUMMARY":
+			ev.Summary = unescapeText(p.Value)
+		case "DESCRIPTION":
+			ev.Description = unescapeText(p.Value)
+		case "CATEGORIES":
+			ev.Categories = append(ev.Categories, splitText(p.Value)...)
+		case "ATTENDEE":
+			if p.Params["PARTSTAT"] != "DECLINED" {
+				ev.Attendees = append(ev.Attendees, mailto(p.Value))
+			}
+		case "ORGANIZER":
+			ev.Organizer = mailto(p.Value)
+		case "X-ASSEMBLED-AGENT-ID":
+			ev.AgentID = p.Value
+		case "X-ASSEMBLED-TYPE-ID":
+			ev.TypeID = p.Value
+		case "RRULE":
+			ev.RRule = p.Value
+		case "EXDATE", "RDATE":
+			var times []time.Time
+			times, err = parseTimeList(p, o)
+			if p.Name == "EXDATE" {
+				ev.ExDates = append(ev.ExDates, times...)
+			} else {
+				ev.RDates = append(ev.RDates, times...)
+			}
+		case "RECURRENCE-ID":
+			ev.RecurrenceID, _, err = parseTimeProperty(p, o)
+		case "STATUS":
+			ev.Cancelled = strings.EqualFold(p.Value, "CANCELLED")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", p.Line, p.Name, err)
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unterminated %s", stack[len(stack)-1])
+	}
+	return events, nil
+}
+
+// finish validates ev and derives its duration.
+func (ev *event) finish(hasEnd bool) error {
+	if ev.Start.IsZero() {
+		return errors.New("event has no DTSTART")
+	}
+	switch {
+	case hasEnd:
+		if ev.AllDay {
+			ev.Duration = time.Duration(daysBetween(ev.Start, ev.End)) * 24 * time.Hour
+		} else {
+			ev.Duration = ev.End.Sub(ev.Start)
+		}
+	case ev.Duration == 0 && ev.AllDay:
+		ev.Duration = 24 * time.Hour
+	}
+	if ev.Duration <= 0 {
+		return errors.New("event has no duration")
+	}
+	return nil
+}
+
+func daysBetween(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	da := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	db := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da) / (24 * time.Hour))
+}
+
+func mailto(v string) string {
+	if len(v) >= 7 && strings.EqualFold(v[:7], "mailto:") {
+		return v[7:]
+	}
+	return v
+}
+
+// parseTimeProperty parses a DATE or DATE-TIME value, honoring its TZID and
+// VALUE parameters. It reports whether the value is a date.
+func parseTimeProperty(p property, o *DecodeOptions) (time.Time, bool, error) {
+	loc, err := location(p, o)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	t, isDate, err := parseDateTime(p.Value, loc, o.Location)
+	if err == nil && p.Params["VALUE"] == "DATE" && !isDate {
+		err = fmt.Errorf("%q is not a date", p.Value)
+	}
+	return t, isDate, err
+}
+
+func parseTimeList(p property, o *DecodeOptions) ([]time.Time, error) {
+	var out []time.Time
+	for _, v := range strings.Split(p.Value, ",") {
+		q := p
+		q.Value = v
+		t, _, err := parseTimeProperty(q, o)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func location(p property, o *DecodeOptions) (*time.Location, error) {
+	tzid := p.Params["TZID"]
+	if tzid == "" {
+		return nil, nil
+	}
+	if loc, ok := o.TimeZones[tzid]; ok {
+		return loc, nil
+	}
+	// Some producers prefix IANA names, as in "/mozilla.org/20070129_1/Europe/Paris".
+	// An empty name would load UTC, so stop once the prefixes are used up.
+	name := tzid
+	for name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc, nil
+		}
+		i := strings.IndexByte(name[1:], '/')
+		if i < 0 {
+			break
+		}
+		name = name[i+2:]
+	}
+	return nil, fmt.Errorf("unknown time zone %q", tzid)
+}
+
+// parseDateTime parses a DATE or DATE-TIME value. UTC values end with Z;
+// other values are in loc, or in floating when loc is nil.
+func parseDateTime(v string, loc, floating *time.Location) (time.Time, bool, error) {
+	if loc == nil {
+		loc = floating
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	switch {
+	case len(v) == 8:
+		t, err := time.ParseInLocation("20060102", v, loc)
+		return t, true, err
+	case strings.HasSuffix(v, "Z"):
+		t, err := time.Parse(utcFormat, v)
+		return t, false, err
+	default:
+		t, err := time.ParseInLocation("20060102T150405", v, loc)
+		return t, false, err
+	}
+}
+
+// parseDuration parses a DURATION value such as "PT1H30M" or "P1W".
+func parseDuration(v string) (time.Duration, error) {
+	s := v
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign = -1
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("malformed duration %q", v)
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	for len(s) > 0 {
+		if s[0] == 'T' {
+			inTime = true
+			s = s[1:]
+			continue
+		}
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return 0, fmt.Errorf("malformed duration %q", v)
+		}
+		n, _ := strconv.Atoi(s[:i])
+		unit := s[i]
+		s = s[i+1:]
+		switch {
+		case unit == 'W' && !inTime:
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case unit == 'D' && !inTime:
+			d += time.Duration(n) * 24 * time.Hour
+		case unit == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case unit == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case unit == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("malformed duration %q", v)
+		}
+	}
+	return sign * d, nil
+}
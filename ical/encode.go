@@ -0,0 +1,121 @@
+package ical
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+const utcFormat = "20060102T150405Z"
+
+// EncodeOptions customizes the calendar written by Encode.
+type EncodeOptions struct {
+	// Activity types, as returned by ListActivityTypes, used to name events.
+	// Events of unknown types are named after their description.
+	ActivityTypes map[string]assembled.ActivityType
+
+	// Value of the PRODID property. Defaults to
+	// "-//Assembled//assembled-go//EN".
+	ProdID string
+
+	// Value of the X-WR-CALNAME property, which most calendar applications
+	// display as the calendar name. Omitted when empty.
+	Name string
+
+	// Domain appended to activity IDs to form globally unique event UIDs.
+	// Defaults to "assembledhq.com".
+	UIDDomain string
+
+	// Time used for the DTSTAMP of every event. Defaults to the current
+	// time.
+	Timestamp time.Time
+}
+
+// Encode writes the activities of resp as an iCalendar object, ordered by
+// start time. Each event gets a stable UID derived from the activity ID, and
+// agents included in resp.Agents (see ListActivitiesRequest.IncludeAgents)
+// are listed as attendees.
+func Encode(w io.Writer, resp *assembled.ListActivitiesResponse, opts *EncodeOptions) error {
+	var o EncodeOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.ProdID == "" {
+		o.ProdID = "-//Assembled//assembled-go//EN"
+	}
+	if o.UIDDomain == "" {
+		o.UIDDomain = "assembledhq.com"
+	}
+	if o.Timestamp.IsZero() {
+		o.Timestamp = time.Now()
+	}
+
+	var activities []assembled.Activity
+	if resp != nil {
+		for _, a := range resp.Activities {
+			activities = append(activities, a)
+		}
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		a, b := activities[i], activities[j]
+		if !a.StartTime.Equal(b.StartTime) {
+			return a.StartTime.Before(b.StartTime)
+		}
+		return a.ID < b.ID
+	})
+
+	lw := &lineWriter{w: w}
+	lw.line("BEGIN:VCALENDAR")
+	lw.line("VERSION:2.0")
+	lw.line("PRODID:" + o.ProdID)
+	lw.line("CALSCALE:GREGORIAN")
+	if o.Name != "" {
+		lw.line("X-WR-CALNAME:" + escapeText(o.Name))
+	}
+	for _, a := range activities {
+		lw.line("BEGIN:VEVENT")
+		lw.line("UID:" + a.ID + "@" + o.UIDDomain)
+		lw.line("DTSTAMP:" + o.Timestamp.UTC().Format(utcFormat))
+		lw.line("DTSTART:" + a.StartTime.UTC().Format(utcFormat))
+		lw.line("DTEND:" + a.EndTime.UTC().Format(utcFormat))
+
+		summary := a.Description
+		if t, ok := o.ActivityTypes[a.TypeID]; ok {
+			summary = t.Name
+			lw.line("CATEGORIES:" + escapeText(t.Name))
+			if t.Timeoff {
+				// Time off shows the agent as away, everything else as busy.
+				lw.line("X-MICROSOFT-CDO-BUSYSTATUS:OOF")
+			}
+		}
+		if summary != "" {
+			lw.line("SUMMARY:" + escapeText(summary))
+		}
+		if a.Description != "" {
+			lw.line("DESCRIPTION:" + escapeText(a.Description))
+		}
+		if resp != nil {
+			if agent, ok := resp.Agents[a.AgentID]; ok && agent.Email != "" {
+				lw.line("ATTENDEE;CN=" + quoteParam(agent.Name) + ";ROLE=REQ-PARTICIPANT:mailto:" + agent.Email)
+			}
+		}
+		lw.line("X-ASSEMBLED-AGENT-ID:" + a.AgentID)
+		lw.line("X-ASSEMBLED-TYPE-ID:" + a.TypeID)
+		lw.line("END:VEVENT")
+	}
+	lw.line("END:VCALENDAR")
+	return lw.err
+}
+
+// quoteParam quotes a parameter value when it contains characters that are
+// not allowed unquoted. Double quotes cannot be escaped, so they are dropped.
+func quoteParam(s string) string {
+	s = strings.Replace(s, `"`, "", -1)
+	if strings.ContainsAny(s, ":;,") {
+		return `"` + s + `"`
+	}
+	return s
+}
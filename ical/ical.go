@@ -0,0 +1,200 @@
+// Package ical converts Assembled activities to and from iCalendar (RFC 5545)
+// data.
+//
+// Encode writes the activities of a ListActivitiesResponse as a VCALENDAR
+// with one VEVENT per activity. Decode parses .ics data into
+// CreateActivityRequests, expanding recurring events over a bounded window.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// property is a single content line, such as
+// "DTSTART;TZID=Europe/Paris:20240102T090000".
+type property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+	Line   int
+}
+
+// readProperties reads all content lines of r, unfolding continuation lines.
+func readProperties(r io.Reader) ([]property, error) {
+	var (
+		props   []property
+		cur     strings.Builder
+		curLine int
+		lineNo  int
+	)
+	flush := func() error {
+		if cur.Len() == 0 {
+			return nil
+		}
+		p, err := parseProperty(cur.String())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", curLine, err)
+		}
+		p.Line = curLine
+		props = append(props, p)
+		cur.Reset()
+		return nil
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			cur.WriteString(line[1:])
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		if line != "" {
+			cur.WriteString(line)
+			curLine = lineNo
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+func parseProperty(line string) (property, error) {
+	p := property{Params: make(map[string]string)}
+
+	// The name and parameters end at the first colon outside quotes.
+	inQuotes := false
+	colon := -1
+	for i := 0; i < len(line) && colon < 0; i++ {
+		switch line[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case ':':
+			if !inQuotes {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return p, fmt.Errorf("malformed content line %q", line)
+	}
+	p.Value = line[colon+1:]
+
+	parts := splitUnquoted(line[:colon], ';')
+	p.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		eq := strings.IndexByte(param, '=')
+		if eq < 0 {
+			return p, fmt.Errorf("malformed parameter %q", param)
+		}
+		p.Params[strings.ToUpper(param[:eq])] = strings.Trim(param[eq+1:], `"`)
+	}
+	return p, nil
+}
+
+// splitUnquoted splits s at every sep that is not within double quotes.
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeText decodes a TEXT value.
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// escapeText encodes a TEXT value.
+func escapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// splitText splits a multi-valued TEXT property, such as CATEGORIES, at
+// unescaped commas.
+func splitText(s string) []string {
+	var (
+		values []string
+		cur    strings.Builder
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i < len(s)-1:
+			cur.WriteByte(s[i])
+			cur.WriteByte(s[i+1])
+			i++
+		case s[i] == ',':
+			values = append(values, unescapeText(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(values, unescapeText(cur.String()))
+}
+
+// lineWriter writes content lines folded at 75 octets, as required by
+// RFC 5545, and remembers the first error.
+type lineWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (lw *lineWriter) line(s string) {
+	if lw.err != nil {
+		return
+	}
+	var b strings.Builder
+	limit := 75
+	for len(s) > limit {
+		// Avoid splitting a multi-byte UTF-8 sequence.
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // Continuation lines start with a space.
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	_, lw.err = io.WriteString(lw.w, b.String())
+}
@@ -0,0 +1,165 @@
+package ical_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/ical"
+)
+
+var (
+	start  = time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	window = &ical.DecodeOptions{Start: start, End: start.AddDate(0, 0, 7)}
+)
+
+func at(day, hour int) time.Time {
+	return start.AddDate(0, 0, day).Add(time.Duration(hour) * time.Hour)
+}
+
+func TestRoundTrip(t *testing.T) {
+	resp := &assembled.ListActivitiesResponse{
+		Activities: map[string]assembled.Activity{
+			"a1": {ID: "a1", AgentID: "ada", TypeID: "phones", StartTime: at(0, 9), EndTime: at(0, 12)},
+			"a2": {ID: "a2", AgentID: "ada", TypeID: "phones", StartTime: at(0, 13), EndTime: at(0, 17),
+				Description: "Escalations; billing, refunds\nand " + strings.Repeat("très long ", 20)},
+			"a3": {ID: "a3", AgentID: "grace", TypeID: "unknown", StartTime: at(1, 9), EndTime: at(1, 10), Description: "1:1"},
+			"a4": {ID: "a4", AgentID: "grace", TypeID: "pto", StartTime: at(2, 0), EndTime: at(3, 0)},
+		},
+		Agents: map[string]assembled.Agent{
+			"ada": {ID: "ada", Name: `Ada "the Countess" Lovelace`, Email: "ada@example.com"},
+		},
+	}
+	var buf bytes.Buffer
+	err := ical.Encode(&buf, resp, &ical.EncodeOptions{
+		ActivityTypes: map[string]assembled.ActivityType{
+			"phones": {ID: "phones", Name: "Phones"},
+			"pto":    {ID: "pto", Name: "PTO", Timeoff: true},
+		},
+		Timestamp: start,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+
+	got, err := ical.Decode(&buf, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []assembled.CreateActivityRequest
+	for _, id := range []string{"a1", "a2", "a3", "a4"} {
+		a := resp.Activities[id]
+		want = append(want, assembled.CreateActivityRequest{
+			AgentID: a.AgentID, TypeID: a.TypeID, StartTime: a.StartTime, EndTime: a.EndTime, Description: a.Description,
+		})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	const data = "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Paris\r\nEND:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:standup\r\n" +
+		"DTSTART;TZID=/mozilla.org/20070129_1/Europe/Paris:20240108T093000\r\n" +
+		"DURATION:PT15M\r\n" +
+		"RRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR\r\n" +
+		"EXDATE;TZID=Europe/Paris:20240110T093000\r\n" +
+		"SUMMARY:Stand\r\n  up\r\n" +
+		"CATEGORIES:Meeting,Internal\r\n" +
+		"ORGANIZER:mailto:lead@example.com\r\n" +
+		"ATTENDEE;PARTSTAT=ACCEPTED:mailto:ADA@example.com\r\n" +
+		"ATTENDEE;PARTSTAT=DECLINED:mailto:grace@example.com\r\n" +
+		"BEGIN:VALARM\r\nTRIGGER:-PT5M\r\nEND:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:standup\r\n" +
+		"RECURRENCE-ID;TZID=Europe/Paris:20240111T093000\r\n" +
+		"DTSTART;TZID=Europe/Paris:20240111T100000\r\n" +
+		"DTEND;TZID=Europe/Paris:20240111T101500\r\n" +
+		"SUMMARY:Late stand up\r\n" +
+		"CATEGORIES:Meeting\r\n" +
+		"ATTENDEE:mailto:ada@example.com\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:holiday\r\n" +
+		"DTSTART;VALUE=DATE:20240112\r\n" +
+		"SUMMARY:Holiday\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:cancelled\r\n" +
+		"DTSTART:20240109T120000Z\r\n" +
+		"DTEND:20240109T130000Z\r\n" +
+		"STATUS:CANCELLED\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	opts := *window
+	opts.Categories = map[string]string{"meeting": "meetings"}
+	opts.DefaultTypeID = "other"
+	opts.Agents = map[string]string{"ada@example.com": "ada", "grace@example.com": "grace"}
+	opts.DefaultAgentID = "team"
+	got, err := ical.Decode(strings.NewReader(data), &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paris, _ := time.LoadLocation("Europe/Paris")
+	standup := func(day, hour, min int, desc string) assembled.CreateActivityRequest {
+		s := time.Date(2024, 1, 8+day, hour, min, 0, 0, paris)
+		return assembled.CreateActivityRequest{AgentID: "ada", TypeID: "meetings", StartTime: s, EndTime: s.Add(15 * time.Minute), Description: desc}
+	}
+	want := []assembled.CreateActivityRequest{
+		standup(0, 9, 30, "Stand up"),
+		standup(1, 9, 30, "Stand up"),
+		standup(3, 10, 0, "Late stand up"),
+		{AgentID: "team", TypeID: "other", StartTime: at(4, 0), EndTime: at(5, 0), Description: "Holiday"},
+		standup(4, 9, 30, "Stand up"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d activities, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.AgentID != w.AgentID || g.TypeID != w.TypeID || g.Description != w.Description ||
+			!g.StartTime.Equal(w.StartTime) || !g.EndTime.Equal(w.EndTime) {
+			t.Errorf("activity %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	event := func(lines ...string) string {
+		return "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:e\r\nCATEGORIES:x\r\n" +
+			strings.Join(lines, "\r\n") + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	}
+	tests := []struct {
+		name, data, err string
+	}{
+		{"unknown zone", event("DTSTART;TZID=Mars/Olympus:20240108T090000", "DURATION:PT1H"), "unknown time zone"},
+		{"empty zone after prefix", event("DTSTART;TZID=Foo/:20240108T090000", "DURATION:PT1H"), "unknown time zone"},
+		{"trailing slash", event("DTSTART;TZID=/:20240108T090000", "DURATION:PT1H"), "unknown time zone"},
+		{"no start", event("DURATION:PT1H"), "no DTSTART"},
+		{"bad rule", event("DTSTART:20240108T090000Z", "DURATION:PT1H", "RRULE:FREQ=SECONDLY"), "FREQ"},
+		{"unterminated", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n", "unterminated"},
+	}
+	opts := *window
+	opts.DefaultTypeID = "t"
+	opts.DefaultAgentID = "a"
+	for _, tt := range tests {
+		_, err := ical.Decode(strings.NewReader(tt.data), &opts)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
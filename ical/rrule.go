@@ -0,0 +1,310 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upper bound on the number of periods examined when expanding a rule, so
+// that a rule with no end and a sparse BY* filter cannot loop forever.
+const maxPeriods = 100000
+
+// rrule is a parsed recurrence rule. Only the parts that select days are
+// supported; every occurrence keeps the time of day of DTSTART.
+type rrule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []weekdayNum
+	ByMonthDay []int
+	ByMonth    []int
+	WeekStart  time.Weekday
+}
+
+// weekdayNum is a BYDAY entry such as "MO" or "-1FR". N is zero when the
+// entry has no ordinal.
+type weekdayNum struct {
+	N       int
+	Weekday time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRRule parses the value of an RRULE property. Floating UNTIL values are
+// interpreted in loc.
+func parseRRule(s string, loc *time.Location) (*rrule, error) {
+	r := &rrule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(s, ";") {
+		eq := strings.IndexByte(part, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+		key, value := strings.ToUpper(part[:eq]), strings.ToUpper(part[eq+1:])
+		var err error
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.Freq = value
+			default:
+				return nil, fmt.Errorf("unsupported FREQ %s", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && r.Interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "UNTIL":
+			r.Until, _, err = parseDateTime(value, nil, loc)
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				if len(v) < 2 {
+					return nil, fmt.Errorf("malformed BYDAY %q", v)
+				}
+				wd, ok := weekdays[v[len(v)-2:]]
+				if !ok {
+					return nil, fmt.Errorf("malformed BYDAY %q", v)
+				}
+				n := 0
+				if prefix := v[:len(v)-2]; prefix != "" {
+					if n, err = strconv.Atoi(prefix); err != nil || n == 0 {
+						return nil, fmt.Errorf("malformed BYDAY %q", v)
+					}
+				}
+				r.ByDay = append(r.ByDay, weekdayNum{N: n, Weekday: wd})
+			}
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseInts(value, -31, 31)
+		case "BYMONTH":
+			r.ByMonth, err = parseInts(value, 1, 12)
+		case "WKST":
+			wd, ok := weekdays[value]
+			if !ok {
+				err = fmt.Errorf("unknown weekday")
+			}
+			r.WeekStart = wd
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if r.Freq == "" {
+		return nil, fmt.Errorf("missing FREQ")
+	}
+	return r, nil
+}
+
+func parseInts(s string, min, max int) ([]int, error) {
+	var out []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max || n == 0 {
+			return nil, fmt.Errorf("invalid value %q", v)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// expand returns the start times of the occurrences of r beginning at start
+// and before limit, in order. The first occurrence is always start itself.
+func (r *rrule) expand(start, limit time.Time) []time.Time {
+	if !r.Until.IsZero() && r.Until.Before(limit) {
+		limit = r.Until.Add(time.Nanosecond)
+	}
+	if !start.Before(limit) {
+		return nil
+	}
+	out := []time.Time{start}
+
+	y, m, d := start.Date()
+	hh, mm, ss := start.Clock()
+	loc := start.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, 0, loc)
+	}
+
+	for k := 0; k < maxPeriods; k++ {
+		var periodStart time.Time
+		var candidates []time.Time
+		switch r.Freq {
+		case "DAILY":
+			t := at(y, m, d+k*r.Interval)
+			periodStart = t
+			if r.matchesMonth(t) && r.matchesMonthDay(t) && r.matchesWeekday(t) {
+				candidates = append(candidates, t)
+			}
+		case "WEEKLY":
+			offset := (int(start.Weekday()) - int(r.WeekStart) + 7) % 7
+			periodStart = at(y, m, d-offset+7*k*r.Interval)
+			days := r.ByDay
+			if len(days) == 0 {
+				days = []weekdayNum{{Weekday: start.Weekday()}}
+			}
+			for _, wd := range days {
+				t := periodStart.AddDate(0, 0, (int(wd.Weekday)-int(r.WeekStart)+7)%7)
+				if r.matchesMonth(t) {
+					candidates = append(candidates, t)
+				}
+			}
+		case "MONTHLY":
+			periodStart = at(y, m+time.Month(k*r.Interval), 1)
+			if r.matchesMonth(periodStart) {
+				candidates = r.daysInMonth(periodStart, d)
+			}
+		case "YEARLY":
+			periodStart = at(y+k*r.Interval, time.January, 1)
+			candidates = r.daysInYear(periodStart, m, d)
+		}
+		if !periodStart.Before(limit) {
+			return out
+		}
+
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+		for _, t := range candidates {
+			if !t.After(start) {
+				continue
+			}
+			if !t.Before(limit) || (r.Count > 0 && len(out) >= r.Count) {
+				return out
+			}
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// daysInYear returns the occurrences within the year starting at first,
+// following the expansion rules of RFC 5545 section 3.3.10: BYMONTH expands
+// to the given months, BYMONTHDAY alone to those days of every month, and
+// BYDAY without BYMONTH to those weekdays of the whole year, ordinals
+// counting from the start or end of the year. Without any of them, the rule
+// recurs on the month and day of DTSTART.
+func (r *rrule) daysInYear(first time.Time, dtstartMonth time.Month, dtstartDay int) []time.Time {
+	var months []time.Month
+	switch {
+	case len(r.ByMonth) > 0:
+		for _, m := range r.ByMonth {
+			months = append(months, time.Month(m))
+		}
+	case len(r.ByDay) == 0 && len(r.ByMonthDay) == 0:
+		months = []time.Month{dtstartMonth}
+	case len(r.ByDay) == 0:
+		for m := time.January; m <= time.December; m++ {
+			months = append(months, m)
+		}
+	}
+	var out []time.Time
+	if months != nil {
+		for _, m := range months {
+			out = append(out, r.daysInMonth(first.AddDate(0, int(m)-1, 0), dtstartDay)...)
+		}
+		return out
+	}
+
+	lastDay := first.AddDate(1, 0, -1).YearDay()
+	for day := 1; day <= lastDay; day++ {
+		t := first.AddDate(0, 0, day-1)
+		if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(t) {
+			continue
+		}
+		if matchesNthWeekday(r.ByDay, t, day, lastDay) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// daysInMonth returns the occurrences within the month starting at first,
+// selected by BYDAY and BYMONTHDAY, or on day dtstartDay when neither is set.
+func (r *rrule) daysInMonth(first time.Time, dtstartDay int) []time.Time {
+	lastDay := first.AddDate(0, 1, -1).Day()
+	var out []time.Time
+	for day := 1; day <= lastDay; day++ {
+		t := first.AddDate(0, 0, day-1)
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			if day == dtstartDay {
+				out = append(out, t)
+			}
+			continue
+		}
+		if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(t) {
+			continue
+		}
+		if len(r.ByDay) > 0 && !matchesNthWeekday(r.ByDay, t, day, lastDay) {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// matchesNthWeekday reports whether t, the day-th of a month or year of
+// lastDay days, is selected by one of days.
+func matchesNthWeekday(days []weekdayNum, t time.Time, day, lastDay int) bool {
+	for _, wd := range days {
+		if wd.Weekday != t.Weekday() {
+			continue
+		}
+		switch {
+		case wd.N == 0:
+			return true
+		case wd.N > 0 && (day-1)/7+1 == wd.N:
+			return true
+		case wd.N < 0 && (lastDay-day)/7+1 == -wd.N:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesMonth(t time.Time) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, m := range r.ByMonth {
+		if time.Month(m) == t.Month() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	lastDay := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, md := range r.ByMonthDay {
+		if md == t.Day() || (md < 0 && lastDay+md+1 == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesWeekday(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if wd.Weekday == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
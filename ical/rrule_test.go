@@ -0,0 +1,190 @@
+package ical
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRRuleExpand checks expansions against the examples of RFC 5545
+// section 3.8.5.3, all of which start at 09:00 in America/New_York.
+func TestRRuleExpand(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name    string
+		dtstart string
+		rule    string
+		limit   string // Defaults to 2010.
+		want    string // Space separated dates, all at 09:00.
+	}{
+		{
+			name:    "daily for 10 occurrences",
+			dtstart: "19970902",
+			rule:    "FREQ=DAILY;COUNT=10",
+			want:    "19970902 19970903 19970904 19970905 19970906 19970907 19970908 19970909 19970910 19970911",
+		},
+		{
+			name:    "daily until December 24",
+			dtstart: "19971220",
+			rule:    "FREQ=DAILY;UNTIL=19971224T000000Z",
+			want:    "19971220 19971221 19971222 19971223",
+		},
+		{
+			name:    "every 10 days, 5 occurrences",
+			dtstart: "19970902",
+			rule:    "FREQ=DAILY;INTERVAL=10;COUNT=5",
+			want:    "19970902 19970912 19970922 19971002 19971012",
+		},
+		{
+			name:    "every day in January, for 3 years",
+			dtstart: "19980101",
+			rule:    "FREQ=DAILY;UNTIL=20000131T140000Z;BYMONTH=1",
+			limit:   "19980106",
+			want:    "19980101 19980102 19980103 19980104 19980105",
+		},
+		{
+			name:    "weekly for 10 occurrences",
+			dtstart: "19970902",
+			rule:    "FREQ=WEEKLY;COUNT=10",
+			want:    "19970902 19970909 19970916 19970923 19970930 19971007 19971014 19971021 19971028 19971104",
+		},
+		{
+			name:    "weekly on Tuesday and Thursday for five weeks",
+			dtstart: "19970902",
+			rule:    "FREQ=WEEKLY;UNTIL=19971007T000000Z;WKST=SU;BYDAY=TU,TH",
+			want:    "19970902 19970904 19970909 19970911 19970916 19970918 19970923 19970925 19970930 19971002",
+		},
+		{
+			name:    "every other week on Tuesday and Thursday, for 8 occurrences",
+			dtstart: "19970902",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=8;WKST=SU;BYDAY=TU,TH",
+			want:    "19970902 19970904 19970916 19970918 19970930 19971002 19971014 19971016",
+		},
+		{
+			name:    "monthly on the first Friday for 10 occurrences",
+			dtstart: "19970905",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYDAY=1FR",
+			want:    "19970905 19971003 19971107 19971205 19980102 19980206 19980306 19980403 19980501 19980605",
+		},
+		{
+			name:    "monthly on the second-to-last Monday for 6 months",
+			dtstart: "19970922",
+			rule:    "FREQ=MONTHLY;COUNT=6;BYDAY=-2MO",
+			want:    "19970922 19971020 19971117 19971222 19980119 19980216",
+		},
+		{
+			name:    "monthly on the third-to-the-last day",
+			dtstart: "19970928",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-3",
+			limit:   "19980301",
+			want:    "19970928 19971029 19971128 19971229 19980129 19980226",
+		},
+		{
+			name:    "monthly on the 2nd and 15th for 10 occurrences",
+			dtstart: "19970902",
+			rule:    "FREQ=MONTHLY;COUNT=10;BYMONTHDAY=2,15",
+			want:    "19970902 19970915 19971002 19971015 19971102 19971115 19971202 19971215 19980102 19980115",
+		},
+		{
+			name:    "every Friday the 13th",
+			dtstart: "19970902",
+			rule:    "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13",
+			limit:   "20001101",
+			want:    "19970902 19980213 19980313 19981113 19990813 20001013",
+		},
+		{
+			name:    "yearly in June and July for 10 occurrences",
+			dtstart: "19970610",
+			rule:    "FREQ=YEARLY;COUNT=10;BYMONTH=6,7",
+			want:    "19970610 19970710 19980610 19980710 19990610 19990710 20000610 20000710 20010610 20010710",
+		},
+		{
+			name:    "every other year on January, February, and March for 10 occurrences",
+			dtstart: "19970310",
+			rule:    "FREQ=YEARLY;INTERVAL=2;COUNT=10;BYMONTH=1,2,3",
+			want:    "19970310 19990110 19990210 19990310 20010110 20010210 20010310 20030110 20030210 20030310",
+		},
+		{
+			name:    "every 20th Monday of the year",
+			dtstart: "19970519",
+			rule:    "FREQ=YEARLY;BYDAY=20MO",
+			limit:   "20000101",
+			want:    "19970519 19980518 19990517",
+		},
+		{
+			name:    "every Thursday in March",
+			dtstart: "19970313",
+			rule:    "FREQ=YEARLY;BYMONTH=3;BYDAY=TH",
+			limit:   "19990101",
+			want:    "19970313 19970320 19970327 19980305 19980312 19980319 19980326",
+		},
+		{
+			name:    "yearly on the first of every month",
+			dtstart: "19970101",
+			rule:    "FREQ=YEARLY;BYMONTHDAY=1",
+			limit:   "19980101",
+			want:    "19970101 19970201 19970301 19970401 19970501 19970601 19970701 19970801 19970901 19971001 19971101 19971201",
+		},
+		{
+			name:    "yearly on the last Sunday",
+			dtstart: "19971228",
+			rule:    "FREQ=YEARLY;BYDAY=-1SU;COUNT=3",
+			want:    "19971228 19981227 19991226",
+		},
+		{
+			name:    "yearly on DTSTART",
+			dtstart: "19970310",
+			rule:    "FREQ=YEARLY;COUNT=3",
+			want:    "19970310 19980310 19990310",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, _, err := parseDateTime(tt.dtstart+"T090000", ny, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			limit := time.Date(2010, 1, 1, 0, 0, 0, 0, ny)
+			if tt.limit != "" {
+				limit, _, _ = parseDateTime(tt.limit, ny, nil)
+			}
+			r, err := parseRRule(tt.rule, ny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, t := range r.expand(start, limit) {
+				got = append(got, t.Format("20060102"))
+				if h, m, _ := t.Clock(); h != 9 || m != 0 || t.Location() != ny {
+					got = append(got, "at "+t.String())
+				}
+			}
+			if want := strings.Fields(tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %v\nwant %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseRRuleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"COUNT=3",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=-1",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=MONTHLY;BYDAY=0MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=YEARLY;BYMONTH=13",
+		"FREQ=YEARLY;BYWEEKNO=20",
+	} {
+		if _, err := parseRRule(rule, time.UTC); err == nil {
+			t.Errorf("parseRRule(%q) succeeded", rule)
+		}
+	}
+}
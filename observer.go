@@ -0,0 +1,219 @@
+package assembled
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Observer receives a record of every request attempt made by a Client, for
+// example to export metrics or traces to your own monitoring. Observers are
+// called synchronously once the response has been decoded, so they should
+// return quickly.
+type Observer interface {
+	ObserveRequest(ctx context.Context, r *RequestRecord)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(ctx context.Context, r *RequestRecord)
+
+func (f ObserverFunc) ObserveRequest(ctx context.Context, r *RequestRecord) {
+	f(ctx, r)
+}
+
+// RequestRecord describes a single request attempt.
+type RequestRecord struct {
+	// Name of the Client method, such as "ListActivities". Empty for requests
+	// to unknown endpoints.
+	Endpoint string
+
+	Method       string
+	Path         string // Request path, including the query string.
+	PathTemplate string // Request path with identifiers elided, e.g. "/v0/agents/{id}".
+
+	// Attempt number, starting at 1. Retried requests produce one record
+	// per attempt.
+	Attempt int
+
+	StatusCode int    // Zero when no response was received.
+	RequestID  string // Value of the Request-Id response header.
+
+	Start   time.Time
+	Timings RequestTimings
+
+	// Error returned by the attempt, if any.
+	Err error
+}
+
+// RequestTimings breaks down the latency of a request attempt. Phases that did
+// not happen, such as DNS and connecting when a pooled connection was reused,
+// are zero.
+type RequestTimings struct {
+	DNSLookup    time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+
+	// Time from the start of the request until the first response byte.
+	TimeToFirstByte time.Duration
+
+	// Time spent reading and decoding the response body.
+	BodyDecode time.Duration
+
+	Total time.Duration
+}
+
+func (t *requestTrace) timings() RequestTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	between := func(from, to time.Time) time.Duration {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return to.Sub(from)
+	}
+	return RequestTimings{
+		DNSLookup:       between(t.dnsStart, t.dnsDone),
+		Connect:         between(t.connectStart, t.connectDone),
+		TLSHandshake:    between(t.tlsStart, t.tlsDone),
+		TimeToFirstByte: between(t.start, t.firstByte),
+		BodyDecode:      between(t.firstByte, t.done),
+		Total:           between(t.start, t.done),
+	}
+}
+
+func (c *Client) observe(ctx context.Context, t *requestTrace, method, path string, attempt int, resp *http.Response, err error) {
+	endpoint, pattern := matchRoute(method, path)
+	r := &RequestRecord{
+		Endpoint:     endpoint,
+		Method:       method,
+		Path:         path,
+		PathTemplate: pattern,
+		Attempt:      attempt,
+		Start:        t.start,
+		Timings:      t.timings(),
+		Err:          err,
+	}
+	if resp != nil {
+		r.StatusCode = resp.StatusCode
+		r.RequestID = resp.Header.Get("Request-Id")
+	}
+	for _, o := range c.Observers {
+		o.ObserveRequest(ctx, r)
+	}
+}
+
+// Tracer is the subset of a tracing library, such as OpenTelemetry, needed to
+// report requests as spans. Spans are started after the fact with an explicit
+// start time.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string, start time.Time) Span
+}
+
+// Span is a single traced operation created by a Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End(end time.Time)
+}
+
+// NewTracingObserver returns an Observer that reports every request attempt
+// as a span named after the endpoint, such as "assembled.ListActivities",
+// with attributes following the OpenTelemetry HTTP conventions.
+func NewTracingObserver(t Tracer) Observer {
+	return ObserverFunc(func(ctx context.Context, r *RequestRecord) {
+		name := "assembled." + r.Endpoint
+		if r.Endpoint == "" {
+			name = "assembled.request"
+		}
+		span := t.StartSpan(ctx, name, r.Start)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", r.PathTemplate)
+		span.SetAttribute("assembled.attempt", r.Attempt)
+		if r.StatusCode != 0 {
+			span.SetAttribute("http.status_code", r.StatusCode)
+		}
+		if r.RequestID != "" {
+			span.SetAttribute("assembled.request_id", r.RequestID)
+		}
+		span.SetAttribute("assembled.dns_ms", milliseconds(r.Timings.DNSLookup))
+		span.SetAttribute("assembled.connect_ms", milliseconds(r.Timings.Connect))
+		span.SetAttribute("assembled.tls_ms", milliseconds(r.Timings.TLSHandshake))
+		span.SetAttribute("assembled.first_byte_ms", milliseconds(r.Timings.TimeToFirstByte))
+		span.SetAttribute("assembled.decode_ms", milliseconds(r.Timings.BodyDecode))
+		if r.Err != nil {
+			span.RecordError(r.Err)
+		}
+		span.End(r.Start.Add(r.Timings.Total))
+	})
+}
+
+// Histogram is the subset of a metrics library, such as a Prometheus
+// histogram vector, needed to record latency distributions.
+type Histogram interface {
+	Observe(value float64, labels map[string]string)
+}
+
+// HistogramFunc adapts a function to the Histogram interface. With Prometheus:
+//
+//	vec := prometheus.NewHistogramVec(opts, []string{"endpoint", "method", "status"})
+//	h := assembled.HistogramFunc(func(v float64, l map[string]string) {
+//		vec.With(l).Observe(v)
+//	})
+type HistogramFunc func(value float64, labels map[string]string)
+
+func (f HistogramFunc) Observe(value float64, labels map[string]string) {
+	f(value, labels)
+}
+
+// HistogramObserver is an Observer that records request latencies in
+// seconds, labelled with "endpoint", "method" and "status". The status is the
+// HTTP status code, or "error" when no response was received.
+type HistogramObserver struct {
+	// Receives the total latency of each request attempt.
+	Latency Histogram
+
+	// Optionally receives the duration of each phase of a request attempt,
+	// with an additional "phase" label: one of "dns", "connect", "tls",
+	// "first_byte" or "decode". Phases that did not happen are skipped.
+	Phases Histogram
+}
+
+func (h *HistogramObserver) ObserveRequest(_ context.Context, r *RequestRecord) {
+	status := "error"
+	if r.StatusCode != 0 {
+		status = strconv.Itoa(r.StatusCode)
+	}
+	labels := func() map[string]string {
+		return map[string]string{"endpoint": r.Endpoint, "method": r.Method, "status": status}
+	}
+
+	if h.Latency != nil {
+		h.Latency.Observe(r.Timings.Total.Seconds(), labels())
+	}
+	if h.Phases == nil {
+		return
+	}
+	phases := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"dns", r.Timings.DNSLookup},
+		{"connect", r.Timings.Connect},
+		{"tls", r.Timings.TLSHandshake},
+		{"first_byte", r.Timings.TimeToFirstByte},
+		{"decode", r.Timings.BodyDecode},
+	}
+	for _, p := range phases {
+		if p.d == 0 {
+			continue
+		}
+		l := labels()
+		l["phase"] = p.name
+		h.Phases.Observe(p.d.Seconds(), l)
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
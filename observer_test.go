@@ -0,0 +1,264 @@
+package assembled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is an Observer keeping the records it receives.
+type recorder struct {
+	mu      sync.Mutex
+	records []*RequestRecord
+}
+
+func (r *recorder) ObserveRequest(_ context.Context, rec *RequestRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec)
+}
+
+func (r *recorder) take() []*RequestRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := r.records
+	r.records = nil
+	return records
+}
+
+// TestRoutesMatchClient calls every Client method with an empty request and
+// checks that the requests it sends match the routes table, so that the
+// table cannot drift from the paths built by the methods.
+func TestRoutesMatchClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	}))
+	t.Cleanup(srv.Close)
+	rec := &recorder{}
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false), WithObserver(rec))
+
+	endpoints := make(map[string]route)
+	for _, r := range routes {
+		endpoints[r.Endpoint] = r
+	}
+	called := make(map[string]bool)
+
+	typ := reflect.TypeOf(c)
+	for i := 0; i < typ.NumMethod(); i++ {
+		m := typ.Method(i)
+		args := []reflect.Value{reflect.ValueOf(c), reflect.ValueOf(context.Background())}
+		for j := 2; j < m.Type.NumIn(); j++ {
+			args = append(args, emptyArg(m.Type.In(j)))
+		}
+		func() {
+			defer func() { recover() }()
+			m.Func.Call(args)
+		}()
+
+		records := rec.take()
+		for _, r := range records {
+			if r.Endpoint == "" {
+				t.Errorf("%s sent %s %s, which matches no route", m.Name, r.Method, r.Path)
+			}
+		}
+		want, ok := endpoints[m.Name]
+		if !ok {
+			continue
+		}
+		called[m.Name] = true
+		if len(records) != 1 {
+			t.Errorf("%s sent %d requests, want 1", m.Name, len(records))
+			continue
+		}
+		r := records[0]
+		if r.Endpoint != m.Name || r.Method != want.Method || r.PathTemplate != want.Pattern {
+			t.Errorf("%s sent %s %s, recorded as %s %s", m.Name, r.Method, r.Path, r.Endpoint, r.PathTemplate)
+		}
+	}
+	for name := range endpoints {
+		if !called[name] {
+			t.Errorf("route %s names no Client method", name)
+		}
+	}
+}
+
+// emptyArg returns an empty value of type t, with any ID field set so that
+// paths embedding it are complete.
+func emptyArg(t reflect.Type) reflect.Value {
+	if t.Kind() != reflect.Ptr {
+		return reflect.Zero(t)
+	}
+	v := reflect.New(t.Elem())
+	if t.Elem().Kind() == reflect.Struct {
+		if f := v.Elem().FieldByName("ID"); f.IsValid() && f.Kind() == reflect.String {
+			f.SetString("id_1")
+		}
+	}
+	return v
+}
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		method, path      string
+		endpoint, pattern string
+	}{
+		{"GET", "/v0/agents?team=x", "ListAgents", "/v0/agents"},
+		{"PATCH", "/v0/agents/a1", "UpdateAgent", "/v0/agents/{id}"},
+		{"GET", "/v0/agents/a1/status", "GetAgentStatus", "/v0/agents/{id}/status"},
+		{"POST", "/v0/agents/status", "CreateAgentStatus", "/v0/agents/status"},
+		{"PATCH", "/v0/agents/", "", "/v0/agents/"},
+		{"GET", "/v1/unknown", "", "/v1/unknown"},
+	}
+	for _, tt := range tests {
+		endpoint, pattern := matchRoute(tt.method, tt.path)
+		if endpoint != tt.endpoint || pattern != tt.pattern {
+			t.Errorf("matchRoute(%s, %s) = %q, %q, want %q, %q", tt.method, tt.path, endpoint, pattern, tt.endpoint, tt.pattern)
+		}
+	}
+}
+
+type fakeSpan struct {
+	name       string
+	start, end time.Time
+	attrs      map[string]interface{}
+	err        error
+}
+
+func (s *fakeSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *fakeSpan) RecordError(err error)                      { s.err = err }
+func (s *fakeSpan) End(end time.Time)                          { s.end = end }
+
+type fakeTracer struct{ spans []*fakeSpan }
+
+func (t *fakeTracer) StartSpan(_ context.Context, name string, start time.Time) Span {
+	s := &fakeSpan{name: name, start: start, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+func TestTracingObserver(t *testing.T) {
+	start := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	failure := errors.New("boom")
+	tracer := &fakeTracer{}
+	o := NewTracingObserver(tracer)
+	o.ObserveRequest(context.Background(), &RequestRecord{
+		Endpoint:     "UpdateAgent",
+		Method:       "PATCH",
+		Path:         "/v0/agents/a1",
+		PathTemplate: "/v0/agents/{id}",
+		Attempt:      2,
+		StatusCode:   503,
+		RequestID:    "req_1",
+		Start:        start,
+		Timings:      RequestTimings{TimeToFirstByte: 80 * time.Millisecond, Total: 100 * time.Millisecond},
+		Err:          failure,
+	})
+	o.ObserveRequest(context.Background(), &RequestRecord{Method: "GET", Path: "/v9/x", PathTemplate: "/v9/x", Start: start})
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(tracer.spans))
+	}
+	s := tracer.spans[0]
+	if s.name != "assembled.UpdateAgent" || !s.start.Equal(start) || !s.end.Equal(start.Add(100*time.Millisecond)) {
+		t.Errorf("span %s from %v to %v", s.name, s.start, s.end)
+	}
+	want := map[string]interface{}{
+		"http.method":             "PATCH",
+		"http.route":              "/v0/agents/{id}",
+		"http.status_code":        503,
+		"assembled.attempt":       2,
+		"assembled.request_id":    "req_1",
+		"assembled.first_byte_ms": 80.0,
+	}
+	for k, v := range want {
+		if s.attrs[k] != v {
+			t.Errorf("attribute %s = %v, want %v", k, s.attrs[k], v)
+		}
+	}
+	if s.err != failure {
+		t.Errorf("recorded error %v, want %v", s.err, failure)
+	}
+
+	s = tracer.spans[1]
+	if s.name != "assembled.request" {
+		t.Errorf("span of unknown endpoint named %q", s.name)
+	}
+	if _, ok := s.attrs["http.status_code"]; ok {
+		t.Error("span without response has a status code")
+	}
+}
+
+type observation struct {
+	value  float64
+	labels map[string]string
+}
+
+func TestHistogramObserver(t *testing.T) {
+	var latency, phases []observation
+	h := &HistogramObserver{
+		Latency: HistogramFunc(func(v float64, l map[string]string) { latency = append(latency, observation{v, l}) }),
+		Phases:  HistogramFunc(func(v float64, l map[string]string) { phases = append(phases, observation{v, l}) }),
+	}
+	h.ObserveRequest(context.Background(), &RequestRecord{
+		Endpoint:   "ListAgents",
+		Method:     "GET",
+		StatusCode: 200,
+		Timings: RequestTimings{
+			Connect:         10 * time.Millisecond,
+			TimeToFirstByte: 250 * time.Millisecond,
+			BodyDecode:      50 * time.Millisecond,
+			Total:           300 * time.Millisecond,
+		},
+	})
+	h.ObserveRequest(context.Background(), &RequestRecord{Endpoint: "ListAgents", Method: "GET"})
+
+	if len(latency) != 2 {
+		t.Fatalf("got %d latency observations, want 2", len(latency))
+	}
+	if l := latency[0]; l.value != 0.3 || !reflect.DeepEqual(l.labels, map[string]string{"endpoint": "ListAgents", "method": "GET", "status": "200"}) {
+		t.Errorf("latency observation %+v", l)
+	}
+	if s := latency[1].labels["status"]; s != "error" {
+		t.Errorf("status of a failed request = %q, want error", s)
+	}
+
+	var got []string
+	for _, p := range phases {
+		got = append(got, fmt.Sprintf("%s=%g", p.labels["phase"], p.value))
+	}
+	want := []string{"connect=0.01", "first_byte=0.25", "decode=0.05"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("phases = %v, want %v", got, want)
+	}
+}
+
+func TestObserverSeesEveryAttempt(t *testing.T) {
+	srv, _ := newScriptedServer(t, nil, 503, 200)
+	rec := &recorder{}
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false), WithRetryPolicy(fastRetryPolicy()), WithObserver(rec))
+
+	if _, err := c.ListAgents(context.Background(), &ListAgentsRequest{Team: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	records := rec.take()
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	for i, r := range records {
+		if r.Attempt != i+1 || r.Endpoint != "ListAgents" || r.Path != "/v0/agents?team=a" {
+			t.Errorf("record %d: %+v", i, r)
+		}
+	}
+	if records[0].StatusCode != 503 || records[0].Err == nil || records[1].StatusCode != 200 || records[1].Err != nil {
+		t.Errorf("statuses %d (%v), %d (%v)", records[0].StatusCode, records[0].Err, records[1].StatusCode, records[1].Err)
+	}
+	if records[1].Timings.Total <= 0 || records[1].Start.IsZero() {
+		t.Errorf("timings not recorded: %+v", records[1])
+	}
+}
@@ -0,0 +1,80 @@
+package assembled
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Option configures a Client created with NewClient.
+type Option func(*Client)
+
+// WithBaseURL points the client at a different API host, such as a sandbox
+// or a fake server in tests.
+func WithBaseURL(base string) Option {
+	return func(c *Client) {
+		c.Base = strings.TrimRight(base, "/")
+	}
+}
+
+// WithHTTPClient makes the client send requests through hc, which may be
+// shared with other code, for example to reuse an instrumented transport.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.HTTP = hc
+	}
+}
+
+// WithAPIVersion pins the API version sent in the API-Version header.
+func WithAPIVersion(version string) Option {
+	return func(c *Client) {
+		c.APIVersion = version
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.UserAgent = ua
+	}
+}
+
+// WithTimeout limits the duration of each request attempt, including reading
+// the response body. The HTTP client passed to WithHTTPClient is copied
+// rather than modified.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithRetryPolicy replaces the default retry policy. Pass nil to disable
+// retries.
+func WithRetryPolicy(p *RetryPolicy) Option {
+	return func(c *Client) {
+		c.Retry = p
+	}
+}
+
+// WithRateLimiter paces requests through l, which may be shared by several
+// clients.
+func WithRateLimiter(l Limiter) Option {
+	return func(c *Client) {
+		c.RateLimiter = l
+	}
+}
+
+// WithTelemetry enables or disables sending request latency telemetry to
+// Assembled.
+func WithTelemetry(enabled bool) Option {
+	return func(c *Client) {
+		c.EnableTelemetry = enabled
+	}
+}
+
+// WithObserver adds an Observer notified of every request attempt.
+func WithObserver(o Observer) Option {
+	return func(c *Client) {
+		c.Observers = append(c.Observers, o)
+	}
+}
@@ -0,0 +1,136 @@
+package assembled
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newHeaderServer returns a server answering every request with no agents,
+// and a function returning the headers of the last request.
+func newHeaderServer(t *testing.T) (*httptest.Server, func() http.Header) {
+	var (
+		mu     sync.Mutex
+		header http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		header = r.Header.Clone()
+		mu.Unlock()
+		fmt.Fprint(w, `{"agents":{}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return header
+	}
+}
+
+// countingTransport counts the requests sent through it.
+type countingTransport struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.n++
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestClientHeaders(t *testing.T) {
+	srv, last := newHeaderServer(t)
+	tests := []struct {
+		name       string
+		opts       []Option
+		apiVersion string
+		userAgent  string
+	}{
+		{"defaults", nil, DefaultAPIVersion, defaultUserAgent},
+		{"overridden", []Option{WithAPIVersion("2024-01-01"), WithUserAgent("roster-sync/1.2")}, "2024-01-01", "roster-sync/1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithBaseURL(srv.URL), WithTelemetry(false)}, tt.opts...)
+			if _, err := NewClient("key", opts...).ListAgents(context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+			h := last()
+			if got := h.Get("API-Version"); got != tt.apiVersion {
+				t.Errorf("API-Version %q, want %q", got, tt.apiVersion)
+			}
+			if got := h.Get("User-Agent"); got != tt.userAgent {
+				t.Errorf("User-Agent %q, want %q", got, tt.userAgent)
+			}
+		})
+	}
+	if want := "assembled-go/" + Version + " ("; !strings.HasPrefix(defaultUserAgent, want) {
+		t.Errorf("default User-Agent %q, want prefix %q", defaultUserAgent, want)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	srv, _ := newHeaderServer(t)
+	transport := &countingTransport{}
+	hc := &http.Client{Transport: transport}
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false), WithHTTPClient(hc))
+	if c.HTTP != hc {
+		t.Error("the HTTP client passed was not used as is")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.ListAgents(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if transport.n != 2 {
+		t.Errorf("%d requests through the shared transport, want 2", transport.n)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("team") == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		fmt.Fprint(w, `{"agents":{}}`)
+	}))
+	t.Cleanup(srv.Close)
+	transport := &countingTransport{}
+	hc := &http.Client{Transport: transport}
+
+	// The option applies whichever order it is passed in.
+	for _, opts := range [][]Option{
+		{WithHTTPClient(hc), WithTimeout(50 * time.Millisecond)},
+		{WithTimeout(50 * time.Millisecond), WithHTTPClient(hc)},
+	} {
+		c := NewClient("key", append(opts, WithBaseURL(srv.URL), WithTelemetry(false), WithRetryPolicy(nil))...)
+		if c.HTTP == hc || c.HTTP.Timeout != 50*time.Millisecond || c.HTTP.Transport != transport {
+			t.Errorf("HTTP client %+v, want a copy of the shared one with a timeout", c.HTTP)
+		}
+		if hc.Timeout != 0 {
+			t.Fatalf("shared HTTP client modified: timeout %v", hc.Timeout)
+		}
+		if _, err := c.ListAgents(context.Background(), nil); err != nil {
+			t.Error(err)
+		}
+		if _, err := c.ListAgents(context.Background(), &ListAgentsRequest{Team: "slow"}); err == nil {
+			t.Error("no error past the timeout")
+		}
+	}
+	if transport.n != 4 {
+		t.Errorf("%d requests through the shared transport, want 4", transport.n)
+	}
+
+	// Without WithHTTPClient, the default client is not modified either.
+	c := NewClient("key", WithTimeout(time.Second))
+	if c.HTTP == http.DefaultClient || http.DefaultClient.Timeout != 0 || c.HTTP.Timeout != time.Second {
+		t.Errorf("HTTP client %+v", c.HTTP)
+	}
+}
@@ -0,0 +1,91 @@
+package assembled
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// AgentField is the JSON name of a field of UpdateAgentRequest, as passed to
+// UpdateAgentFields and SyncAgents.
+type AgentField string
+
+const (
+	AgentFieldImportID AgentField = "import_id"
+	AgentFieldChannels AgentField = "channels"
+	AgentFieldEmail    AgentField = "email"
+	AgentFieldName     AgentField = "name"
+	AgentFieldQueues   AgentField = "queues"
+	AgentFieldSite     AgentField = "site"
+	AgentFieldSkills   AgentField = "skills"
+	AgentFieldTeams    AgentField = "teams"
+)
+
+// UpdateAgentFields is like UpdateAgent, but sends exactly the given fields
+// of r. Those left empty in r are cleared, whereas UpdateAgent leaves empty
+// fields unchanged: empty strings are sent as null and empty lists as [].
+// An unknown name is an error and nothing is sent.
+func (c *Client) UpdateAgentFields(ctx context.Context, r *UpdateAgentRequest, fields ...AgentField) (*Agent, error) {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = string(f)
+	}
+	var resp Agent
+	if err := c.request(ctx, "PATCH", fmt.Sprintf("/v0/agents/%s", r.ID), nil, partial{r, names}, &resp); err != nil {
+		return nil, fmt.Errorf("UpdateAgentFields: %w", err)
+	}
+	return &resp, nil
+}
+
+// partial is the body of an update request that sends only some fields of
+// the request, including empty ones so that they are cleared. Empty strings
+// are sent as null and empty lists as [].
+type partial struct {
+	req    interface{} // Pointer to a request struct.
+	fields []string    // JSON names of the fields to send.
+}
+
+// validate checks that every field exists before the request is sent.
+func (p partial) validate() error {
+	t := reflect.TypeOf(p.req).Elem()
+	for _, name := range p.fields {
+		if name == "id" || jsonFieldIndex(t, name) < 0 {
+			return fmt.Errorf("%s has no field %q", t.Name(), name)
+		}
+	}
+	return nil
+}
+
+func (p partial) MarshalJSON() ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(p.req).Elem()
+	body := make(map[string]interface{}, len(p.fields))
+	for _, name := range p.fields {
+		f := v.Field(jsonFieldIndex(v.Type(), name))
+		switch {
+		case f.Kind() == reflect.String && f.Len() == 0:
+			body[name] = nil
+		case f.Kind() == reflect.Slice && f.IsNil():
+			body[name] = reflect.MakeSlice(f.Type(), 0, 0).Interface()
+		default:
+			body[name] = f.Interface()
+		}
+	}
+	return json.Marshal(body)
+}
+
+// jsonFieldIndex returns the index of the field of struct type t encoded
+// with the given JSON name, or -1.
+func jsonFieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if tag == name && tag != "-" {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,49 @@
+package assembled_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+func TestUpdateFieldsClear(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+	parent := addTeam(srv, "EMEA", "")
+	team := addTeam(srv, "Tier 1", parent)
+	site := srv.AddFilter("sites", assembled.Filter{Name: "London"}).ID
+	id := srv.AddAgent(assembled.Agent{Name: "Ada", Email: "ada@example.com", Site: site, Teams: []string{team}}).ID
+
+	// The empty email is sent as null and the nil teams as [], while the
+	// site, not listed, is left out.
+	n := len(srv.Requests())
+	_, err := srv.Client().UpdateAgentFields(ctx, &assembled.UpdateAgentRequest{ID: id, Name: "Ada Lovelace"},
+		assembled.AgentFieldName, assembled.AgentFieldEmail, assembled.AgentFieldTeams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := writes(srv, n)
+	if len(w) != 1 || string(w[0].Body) != `{"email":null,"name":"Ada Lovelace","teams":[]}` {
+		t.Fatalf("requests %v", w)
+	}
+	if a, _ := srv.Agent(id); a.Name != "Ada Lovelace" || a.Email != "" || a.Site != site || len(a.Teams) != 0 {
+		t.Errorf("agent = %+v", a)
+	}
+
+	n = len(srv.Requests())
+	_, err = srv.Client().UpdateFilterFields(ctx, assembled.FilterTeam, &assembled.UpdateFilterRequest{ID: team},
+		assembled.FilterFieldParentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = writes(srv, n)
+	if len(w) != 1 || string(w[0].Body) != `{"parent_id":null}` {
+		t.Fatalf("requests %v", w)
+	}
+	if got := teamPaths(srv); got != "EMEA, Tier 1" {
+		t.Errorf("teams %s, want EMEA, Tier 1", got)
+	}
+}
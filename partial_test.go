@@ -0,0 +1,72 @@
+package assembled
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPartialMarshalJSON(t *testing.T) {
+	req := &UpdateAgentRequest{
+		ID:     "a1",
+		Name:   "Ada",
+		Skills: []string{"s1"},
+		Teams:  []string{},
+	}
+	tests := []struct {
+		fields []string
+		want   string
+	}{
+		// Fields left out are omitted, even if set.
+		{[]string{"name"}, `{"name":"Ada"}`},
+		// Empty strings are sent as null, and empty lists as [].
+		{[]string{"site", "queues", "teams"}, `{"queues":[],"site":null,"teams":[]}`},
+		{[]string{"skills", "email"}, `{"email":null,"skills":["s1"]}`},
+		{nil, `{}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(partial{req, tt.fields})
+		if err != nil {
+			t.Errorf("fields %q: %v", tt.fields, err)
+			continue
+		}
+		if string(b) != tt.want {
+			t.Errorf("fields %q: got %s, want %s", tt.fields, b, tt.want)
+		}
+	}
+}
+
+func TestPartialUnknownField(t *testing.T) {
+	tests := []struct {
+		req    interface{}
+		fields []string
+	}{
+		{&UpdateAgentRequest{ID: "a1"}, []string{"id"}},
+		{&UpdateAgentRequest{ID: "a1"}, []string{"name", "nickname"}},
+		{&UpdateAgentRequest{ID: "a1"}, []string{"Name"}},
+		{&UpdateFilterRequest{ID: "t1"}, []string{"teams"}},
+	}
+	for _, tt := range tests {
+		p := partial{tt.req, tt.fields}
+		if err := p.validate(); err == nil || !strings.Contains(err.Error(), "has no field") {
+			t.Errorf("fields %q: validate() = %v", tt.fields, err)
+		}
+		if _, err := json.Marshal(p); err == nil {
+			t.Errorf("fields %q: marshaled", tt.fields)
+		}
+	}
+}
+
+func TestUpdateAgentFieldsUnknownNotSent(t *testing.T) {
+	srv, n := newScriptedServer(t, nil)
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false))
+	_, err := c.UpdateAgentFields(context.Background(), &UpdateAgentRequest{ID: "a1"}, "name", "id")
+	if err == nil || !strings.HasPrefix(err.Error(), "UpdateAgentFields: ") {
+		t.Errorf("err = %v, want an UpdateAgentFields error", err)
+	}
+	if got := atomic.LoadInt32(n); got != 0 {
+		t.Errorf("%d requests sent, want 0", got)
+	}
+}
@@ -0,0 +1,129 @@
+package assembled
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limiter paces outgoing requests. Wait blocks until a request may be sent or
+// ctx is done. The *Limiter type from golang.org/x/time/rate satisfies this
+// interface, as does RateLimiter.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// pauser is implemented by limiters that can hold back all of their callers,
+// which the client does when the server responds with 429.
+type pauser interface {
+	Pause(d time.Duration)
+}
+
+// RateLimiter is a token bucket limiter that is safe for concurrent use. It
+// allows bursts of up to burst requests and refills at rate requests per
+// second.
+type RateLimiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate requests per second with
+// bursts of up to burst requests. A burst less than one is treated as one.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done. Callers are served
+// in the order in which they call Wait.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	// Reserve a token up front, letting the bucket go negative, so that
+	// concurrent callers queue up behind each other instead of racing.
+	var wait time.Duration
+	if l.rate > 0 {
+		l.tokens--
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+	}
+	if paused := l.pausedUntil.Sub(now); paused > wait {
+		wait = paused
+	}
+	l.mu.Unlock()
+
+	if err := sleep(ctx, wait); err != nil {
+		l.mu.Lock()
+		if l.rate > 0 {
+			l.tokens++
+		}
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Pause holds back all callers of Wait for at least d.
+func (l *RateLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// parseRetryAfter returns how long the server asked the client to wait before
+// retrying. It understands Retry-After in both its delay-seconds and HTTP-date
+// forms, and falls back to X-RateLimit-Reset given either as a number of
+// seconds or as a Unix timestamp.
+func parseRetryAfter(h http.Header, now time.Time) time.Duration {
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			if secs < 0 {
+				return 0
+			}
+			return time.Duration(secs * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			if t.After(now) {
+				return t.Sub(now)
+			}
+			return 0
+		}
+	}
+	if v := h.Get("X-RateLimit-Reset"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			// Values this large can only be Unix timestamps.
+			if n > 1e9 {
+				if t := time.Unix(n, 0); t.After(now) {
+					return t.Sub(now)
+				}
+				return 0
+			}
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 0
+}
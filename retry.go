@@ -0,0 +1,171 @@
+package assembled
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how a Client retries requests that fail with a
+// transient error.
+//
+// Requests using methods that are not idempotent, such as the POST issued by
+// CreateActivity, are only retried when RetryNonIdempotent is set, since a
+// request that failed mid-flight may already have been applied. The exception
+// is a 429 response: a rate limited request was never processed, so it is
+// retried regardless of method as long as 429 is a retryable status code.
+//
+// When the server sends a Retry-After header, the client waits at least that
+// long before the next attempt.
+type RetryPolicy struct {
+	// Total number of attempts, including the first one. Values less than
+	// two disable retries.
+	MaxAttempts int
+
+	// Delay before the first retry. Each following retry doubles the delay
+	// up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Fraction of each delay that is randomized, between 0 (no jitter) and 1
+	// (full jitter).
+	Jitter float64
+
+	// HTTP status codes that are considered transient.
+	RetryableStatusCodes []int
+
+	// Whether connection resets, timeouts and similar network failures are
+	// retried.
+	RetryNetworkErrors bool
+
+	// Whether POST and PATCH requests are retried.
+	RetryNonIdempotent bool
+
+	// Longest Retry-After the client is willing to wait. Responses asking
+	// for a longer wait are returned to the caller instead. Zero means no
+	// limit.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used by NewClient: up to four
+// attempts with exponential backoff between 250ms and 10s, retrying network
+// errors, request timeouts and 5xx gateway responses for idempotent requests,
+// and rate limited requests for up to a minute of Retry-After.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          4,
+		BaseDelay:            250 * time.Millisecond,
+		MaxDelay:             10 * time.Second,
+		Jitter:               0.5,
+		RetryableStatusCodes: []int{408, 429, 500, 502, 503, 504},
+		RetryNetworkErrors:   true,
+		MaxRetryAfter:        time.Minute,
+	}
+}
+
+// next reports whether a request that failed with err on the given attempt
+// should be retried, and how long to wait before doing so.
+func (p *RetryPolicy) next(ctx context.Context, method string, attempt int, err error) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+	if !p.RetryNonIdempotent && !idempotent(method) && !isRateLimited(err) {
+		return 0, false
+	}
+	if !p.retryable(err) {
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+	var e *Error
+	if errors.As(err, &e) && e.RetryAfter > 0 {
+		if p.MaxRetryAfter > 0 && e.RetryAfter > p.MaxRetryAfter {
+			return 0, false
+		}
+		if e.RetryAfter > delay {
+			delay = e.RetryAfter
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		// The context would expire before the next attempt is made.
+		return 0, false
+	}
+	return delay, true
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		for _, code := range p.RetryableStatusCodes {
+			if e.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+	return p.RetryNetworkErrors && isNetworkError(err)
+}
+
+// backoff returns the delay before the retry following the given attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		spread := float64(delay) * jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*spread)
+	}
+	return delay
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	var oe *net.OpError
+	return errors.As(err, &oe)
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
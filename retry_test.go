@@ -0,0 +1,167 @@
+package assembled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newScriptedServer returns a server answering each request with the next
+// status code of codes, then 200 once they run out. Responses other than 200
+// carry the given headers.
+func newScriptedServer(t *testing.T, header http.Header, codes ...int) (*httptest.Server, *int32) {
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(&n, 1)) - 1
+		w.Header().Set("Request-Id", fmt.Sprintf("req_%d", i+1))
+		if i < len(codes) && codes[i] != 200 {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(codes[i])
+			fmt.Fprint(w, `{"error":{"message":"scripted failure","code":"scripted"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"agents":{}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func fastRetryPolicy() *RetryPolicy {
+	p := DefaultRetryPolicy()
+	p.BaseDelay = time.Millisecond
+	p.MaxDelay = 5 * time.Millisecond
+	return p
+}
+
+func TestRetryGatewayError(t *testing.T) {
+	srv, n := newScriptedServer(t, nil, 502, 200)
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false), WithRetryPolicy(fastRetryPolicy()))
+
+	if _, err := c.ListAgents(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(n); got != 2 {
+		t.Errorf("server got %d requests, want 2", got)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	srv, n := newScriptedServer(t, nil, 503, 503, 503, 503, 503)
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false), WithRetryPolicy(fastRetryPolicy()))
+
+	_, err := c.ListAgents(context.Background(), nil)
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != 503 {
+		t.Fatalf("err = %v, want a 503 *Error", err)
+	}
+	if got := atomic.LoadInt32(n); got != 4 {
+		t.Errorf("server got %d requests, want 4", got)
+	}
+}
+
+func TestRetryRateLimitedHonorsRetryAfter(t *testing.T) {
+	srv, n := newScriptedServer(t, http.Header{"Retry-After": {"0.05"}}, 429, 200)
+	l := NewRateLimiter(1000, 10)
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false),
+		WithRetryPolicy(fastRetryPolicy()), WithRateLimiter(l))
+
+	start := time.Now()
+	// A POST, which is only retried because it was rate limited.
+	if _, err := c.CreateAgent(context.Background(), &CreateAgentRequest{Name: "Ada"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(n); got != 2 {
+		t.Errorf("server got %d requests, want 2", got)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("retried after %v, want at least the 50ms of Retry-After", d)
+	}
+	l.mu.Lock()
+	paused := l.pausedUntil
+	l.mu.Unlock()
+	if !paused.After(start) {
+		t.Error("rate limiter was not paused")
+	}
+}
+
+func TestRetryNonIdempotentNotRetried(t *testing.T) {
+	srv, n := newScriptedServer(t, nil, 502, 200)
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false), WithRetryPolicy(fastRetryPolicy()))
+
+	_, err := c.CreateAgent(context.Background(), &CreateAgentRequest{Name: "Ada"})
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != 502 {
+		t.Fatalf("err = %v, want a 502 *Error", err)
+	}
+	if got := atomic.LoadInt32(n); got != 1 {
+		t.Errorf("server got %d requests, want 1", got)
+	}
+}
+
+func TestRetryRetryAfterTooLong(t *testing.T) {
+	srv, n := newScriptedServer(t, http.Header{"Retry-After": {"120"}}, 429, 200)
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false), WithRetryPolicy(fastRetryPolicy()))
+
+	_, err := c.ListAgents(context.Background(), nil)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("err = %v, want ErrRateLimited", err)
+	}
+	var e *Error
+	if errors.As(err, &e) && e.RetryAfter != 2*time.Minute {
+		t.Errorf("RetryAfter = %v, want 2m", e.RetryAfter)
+	}
+	if got := atomic.LoadInt32(n); got != 1 {
+		t.Errorf("server got %d requests, want 1", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{}, 0},
+		{http.Header{"Retry-After": {"3"}}, 3 * time.Second},
+		{http.Header{"Retry-After": {"0.5"}}, 500 * time.Millisecond},
+		{http.Header{"Retry-After": {"-1"}}, 0},
+		{http.Header{"Retry-After": {now.Add(10 * time.Second).Format(http.TimeFormat)}}, 10 * time.Second},
+		{http.Header{"Retry-After": {now.Add(-time.Second).Format(http.TimeFormat)}}, 0},
+		{http.Header{"X-Ratelimit-Reset": {"7"}}, 7 * time.Second},
+		{http.Header{"X-Ratelimit-Reset": {fmt.Sprint(now.Add(time.Minute).Unix())}}, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%v) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	l := NewRateLimiter(20, 2)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Two requests are free, the next two wait 50ms each.
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("4 requests took %v, want about 100ms", d)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	l.Pause(time.Hour)
+	if err := l.Wait(ctx); err != context.Canceled {
+		t.Errorf("Wait on a paused limiter = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,78 @@
+package assembled
+
+import "strings"
+
+// route describes an API endpoint called by one of the Client methods.
+// Path segments written as {name} match any single segment.
+type route struct {
+	Method   string
+	Pattern  string
+	Endpoint string
+}
+
+var routes = []route{
+	{"POST", "/v0/activities", "CreateActivity"},
+	{"POST", "/v0/activities/bulk", "CreateBulkActivity"},
+	{"DELETE", "/v0/activities", "DeleteActivities"},
+	{"GET", "/v0/activities", "ListActivities"},
+	{"POST", "/v0/activity_types", "CreateActivityType"},
+	{"DELETE", "/v0/activity_types/{id}", "DeleteActivityType"},
+	{"GET", "/v0/activity_types", "ListActivityTypes"},
+	{"POST", "/v0/agents", "CreateAgent"},
+	{"GET", "/v0/agents", "ListAgents"},
+	{"PATCH", "/v0/agents/{id}", "UpdateAgent"},
+	{"POST", "/v0/agents/status", "CreateAgentStatus"},
+	{"GET", "/v0/agents/{id}/status", "GetAgentStatus"},
+	{"POST", "/v0/queues", "CreateQueue"},
+	{"DELETE", "/v0/queues", "DeleteQueues"},
+	{"GET", "/v0/queues", "ListQueues"},
+	{"PUT", "/v0/queues/{id}", "UpdateQueues"},
+	{"POST", "/v0/sites", "CreateSite"},
+	{"DELETE", "/v0/sites", "DeleteSites"},
+	{"GET", "/v0/sites", "ListSites"},
+	{"PUT", "/v0/sites/{id}", "UpdateSites"},
+	{"POST", "/v0/teams", "CreateTeam"},
+	{"DELETE", "/v0/teams", "DeleteTeams"},
+	{"GET", "/v0/teams", "ListTeams"},
+	{"PUT", "/v0/teams/{id}", "UpdateTeams"},
+	{"POST", "/v0/skills", "CreateSkill"},
+	{"DELETE", "/v0/skills", "DeleteSkills"},
+	{"GET", "/v0/skills", "ListSkills"},
+	{"PUT", "/v0/skills/{id}", "UpdateSkills"},
+	{"POST", "/v0/requirements", "CreateRequirement"},
+	{"GET", "/v0/requirements", "ListRequirements"},
+	{"GET", "/v0/requirement_types", "ListRequirementTypes"},
+}
+
+// matchRoute returns the endpoint name and path pattern of a request, or an
+// empty endpoint and the path itself when it matches no known route.
+func matchRoute(method, path string) (endpoint, pattern string) {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	segments := strings.Split(path, "/")
+	for _, r := range routes {
+		if r.Method == method && matchSegments(strings.Split(r.Pattern, "/"), segments) {
+			return r.Endpoint, r.Pattern
+		}
+	}
+	return "", path
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
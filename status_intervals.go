@@ -0,0 +1,285 @@
+package assembled
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrLateStatusEvent is returned by StatusIntervalBuilder.Add for an event
+// older than the events already applied for its agent and channel.
+var ErrLateStatusEvent = errors.New("assembled: status event arrived too late")
+
+// StatusEvent records that an agent's status changed at a point in time, as
+// reported by upstream systems.
+type StatusEvent struct {
+	EventID   string // Used to drop duplicate events. May be empty.
+	AgentID   string
+	AgentName string // Identifies the agent when AgentID is empty.
+	Channel   string
+	Status    string
+	Time      time.Time
+}
+
+// StatusIntervalOptions configures a StatusIntervalBuilder. The zero value
+// uses the defaults given for each field.
+type StatusIntervalOptions struct {
+	// How long events are held back so that events arriving out of order
+	// can be put back in order. An event is only applied once an event of
+	// the same agent and channel at least Lateness newer has been seen, or
+	// Advance has moved past it. Zero applies events as they arrive, so that
+	// any event older than the newest one seen is rejected.
+	//
+	// Whatever the lateness, events of an agent and channel at the same time
+	// are applied in arrival order: the status of the later one replaces
+	// that of the earlier, without a span in between.
+	Lateness time.Duration
+
+	// If set, spans are split at midnight in this location.
+	SplitDays *time.Location
+
+	// Number of recent EventIDs remembered to drop duplicate events.
+	// Defaults to 10000.
+	DedupeWindow int
+}
+
+// StatusIntervalBuilder turns status change events into the spans expected
+// by CreateAgentStatus. Each agent and channel has a current status, opened
+// by the latest applied event and closed by the next one with a different
+// status, at which point the span is emitted.
+//
+// A span emitted for a split day keeps the EventID of the event opening it
+// on its first day; the EventIDs of following days have the date appended,
+// as in "evt_1@2021-03-04", so that each piece has a distinct ID.
+//
+// It is safe for concurrent use.
+type StatusIntervalBuilder struct {
+	opts StatusIntervalOptions
+
+	mu        sync.Mutex
+	timelines map[timelineKey]*statusTimeline
+	recent    *recentIDs
+}
+
+type timelineKey struct {
+	agentID, agentName, channel string
+}
+
+// statusTimeline holds the state of one agent and channel.
+type statusTimeline struct {
+	open      *StatusEvent  // Start of the current span, if any.
+	pending   []StatusEvent // Events not yet applied, by time.
+	watermark time.Time     // Time of the newest event seen.
+	applied   time.Time     // Events up to this time have been applied.
+}
+
+// NewStatusIntervalBuilder returns a builder with the given options.
+func NewStatusIntervalBuilder(opts *StatusIntervalOptions) *StatusIntervalBuilder {
+	var o StatusIntervalOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.DedupeWindow <= 0 {
+		o.DedupeWindow = 10000
+	}
+	return &StatusIntervalBuilder{
+		opts:      o,
+		timelines: make(map[timelineKey]*statusTimeline),
+		recent:    newRecentIDs(o.DedupeWindow),
+	}
+}
+
+// Add applies an event and returns the spans it finished, oldest first.
+// Duplicate events are dropped silently. Events of an agent and channel are
+// applied up to the newest one seen, or the time passed to Advance, minus
+// Lateness. An event before that time, or at it but after the start of the
+// current span, can no longer be placed, and is rejected with
+// ErrLateStatusEvent.
+func (b *StatusIntervalBuilder) Add(e StatusEvent) ([]CreateAgentStatusRequest, error) {
+	if e.AgentID == "" && e.AgentName == "" {
+		return nil, errors.New("assembled: status event has neither AgentID nor AgentName")
+	}
+	if e.Status == "" || e.Time.IsZero() {
+		return nil, errors.New("assembled: status event has no Status or Time")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := timelineKey{e.AgentID, e.AgentName, e.Channel}
+	t := b.timelines[key]
+	if t == nil {
+		t = &statusTimeline{}
+		b.timelines[key] = t
+	}
+	if e.EventID != "" && !b.recent.add(e.EventID) {
+		return nil, nil
+	}
+	if t.open != nil && e.Time.Equal(t.open.Time) && e.Status == t.open.Status {
+		return nil, nil
+	}
+	sameTime := t.open != nil && e.Time.Equal(t.open.Time)
+	if !t.applied.IsZero() && !e.Time.After(t.applied) && !sameTime {
+		// The event may be added again, should it be resent with a later
+		// time.
+		b.recent.remove(e.EventID)
+		return nil, ErrLateStatusEvent
+	}
+
+	i := sort.Search(len(t.pending), func(i int) bool { return t.pending[i].Time.After(e.Time) })
+	if i > 0 && t.pending[i-1].Time.Equal(e.Time) && t.pending[i-1].Status == e.Status {
+		return nil, nil
+	}
+	t.pending = append(t.pending, StatusEvent{})
+	copy(t.pending[i+1:], t.pending[i:])
+	t.pending[i] = e
+	if e.Time.After(t.watermark) {
+		t.watermark = e.Time
+	}
+	return b.apply(t, t.watermark.Add(-b.opts.Lateness)), nil
+}
+
+// Advance applies the events held back for Lateness that are older than
+// now minus Lateness, even if no newer event has arrived, and returns the
+// spans they finished. It is meant to be called periodically with the
+// current time.
+func (b *StatusIntervalBuilder) Advance(now time.Time) []CreateAgentStatusRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []CreateAgentStatusRequest
+	for _, key := range b.keys() {
+		t := b.timelines[key]
+		if now.After(t.watermark) {
+			t.watermark = now
+		}
+		out = append(out, b.apply(t, t.watermark.Add(-b.opts.Lateness))...)
+	}
+	return out
+}
+
+// Flush applies all events held back and closes every current span at end,
+// returning the spans finished. Spans are clipped to end: those starting at
+// or after it are dropped, and those ending after it are cut short. The
+// builder is left empty, apart from the EventIDs remembered.
+func (b *StatusIntervalBuilder) Flush(end time.Time) []CreateAgentStatusRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var spans []CreateAgentStatusRequest
+	for _, key := range b.keys() {
+		t := b.timelines[key]
+		if len(t.pending) > 0 {
+			spans = append(spans, b.apply(t, t.pending[len(t.pending)-1].Time)...)
+		}
+		if t.open != nil && end.After(t.open.Time) {
+			spans = append(spans, b.span(t.open, end)...)
+		}
+		delete(b.timelines, key)
+	}
+	var out []CreateAgentStatusRequest
+	for _, s := range spans {
+		if !s.StartTime.Before(end) {
+			continue
+		}
+		if s.EndTime.After(end) {
+			s.EndTime = end
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// Current returns the spans in progress, without an EndTime, ordered by
+// agent and channel.
+func (b *StatusIntervalBuilder) Current() []CreateAgentStatusRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []CreateAgentStatusRequest
+	for _, key := range b.keys() {
+		if open := b.timelines[key].open; open != nil {
+			out = append(out, statusSpan(open, open.Time, time.Time{}, open.EventID))
+		}
+	}
+	return out
+}
+
+// apply applies the pending events of t up to and including cutoff.
+func (b *StatusIntervalBuilder) apply(t *statusTimeline, cutoff time.Time) []CreateAgentStatusRequest {
+	if cutoff.After(t.applied) {
+		t.applied = cutoff
+	}
+	var out []CreateAgentStatusRequest
+	n := 0
+	for ; n < len(t.pending) && !t.pending[n].Time.After(cutoff); n++ {
+		e := t.pending[n]
+		if t.open != nil && t.open.Status == e.Status {
+			// Not a change, so the current span goes on.
+			continue
+		}
+		if t.open != nil && e.Time.Equal(t.open.Time) {
+			// Arrived after the event opening the span, at the same time.
+			t.open = &e
+			continue
+		}
+		if t.open != nil {
+			out = append(out, b.span(t.open, e.Time)...)
+		}
+		t.open = &e
+	}
+	t.pending = append(t.pending[:0], t.pending[n:]...)
+	return out
+}
+
+// span returns the span opened by e and ending at end, split at midnight if
+// configured.
+func (b *StatusIntervalBuilder) span(e *StatusEvent, end time.Time) []CreateAgentStatusRequest {
+	loc := b.opts.SplitDays
+	if loc == nil {
+		return []CreateAgentStatusRequest{statusSpan(e, e.Time, end, e.EventID)}
+	}
+	var out []CreateAgentStatusRequest
+	start, id := e.Time, e.EventID
+	for {
+		y, m, d := start.In(loc).Date()
+		midnight := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		if !midnight.Before(end) {
+			break
+		}
+		out = append(out, statusSpan(e, start, midnight, id))
+		start = midnight
+		if e.EventID != "" {
+			id = e.EventID + "@" + midnight.Format("2006-01-02")
+		}
+	}
+	return append(out, statusSpan(e, start, end, id))
+}
+
+func statusSpan(e *StatusEvent, start, end time.Time, id string) CreateAgentStatusRequest {
+	return CreateAgentStatusRequest{
+		EventID:   id,
+		Status:    e.Status,
+		AgentID:   e.AgentID,
+		AgentName: e.AgentName,
+		Channel:   e.Channel,
+		StartTime: start,
+		EndTime:   end,
+	}
+}
+
+// keys returns the keys of the timelines in a stable order.
+func (b *StatusIntervalBuilder) keys() []timelineKey {
+	keys := make([]timelineKey, 0, len(b.timelines))
+	for k := range b.timelines {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, c := keys[i], keys[j]
+		if a.agentID != c.agentID {
+			return a.agentID < c.agentID
+		}
+		if a.agentName != c.agentName {
+			return a.agentName < c.agentName
+		}
+		return a.channel < c.channel
+	})
+	return keys
+}
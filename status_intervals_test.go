@@ -0,0 +1,195 @@
+package assembled_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+)
+
+// ev returns an event of agent a1 on the phone at 10:mm on 2021-03-04 UTC.
+func ev(id, status string, mm int) assembled.StatusEvent {
+	return assembled.StatusEvent{
+		EventID: id, AgentID: "a1", Channel: "phone", Status: status,
+		Time: time.Date(2021, 3, 4, 10, mm, 0, 0, time.UTC),
+	}
+}
+
+// spanString formats spans as "status start-end id", with times as
+// "01-02 15:04" in loc, one per line.
+func spanString(spans []assembled.CreateAgentStatusRequest, loc *time.Location) string {
+	var lines []string
+	for _, s := range spans {
+		lines = append(lines, fmt.Sprintf("%s %s-%s %s", s.Status,
+			s.StartTime.In(loc).Format("01-02 15:04"), s.EndTime.In(loc).Format("01-02 15:04"), s.EventID))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestStatusIntervalBuilder(t *testing.T) {
+	flushAt := time.Date(2021, 3, 4, 11, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		lateness time.Duration
+		events   []assembled.StatusEvent
+		late     []string // EventIDs rejected with ErrLateStatusEvent.
+		want     string   // Spans emitted by Add and Flush.
+	}{{
+		name:   "in order",
+		events: []assembled.StatusEvent{ev("1", "ready", 0), ev("2", "busy", 5), ev("3", "ready", 10)},
+		want: "ready 03-04 10:00-03-04 10:05 1\n" +
+			"busy 03-04 10:05-03-04 10:10 2\n" +
+			"ready 03-04 10:10-03-04 11:00 3",
+	}, {
+		name:   "repeated status",
+		events: []assembled.StatusEvent{ev("1", "ready", 0), ev("2", "ready", 5), ev("3", "busy", 10)},
+		want: "ready 03-04 10:00-03-04 10:10 1\n" +
+			"busy 03-04 10:10-03-04 11:00 3",
+	}, {
+		name:     "reordered within lateness",
+		lateness: 10 * time.Minute,
+		events:   []assembled.StatusEvent{ev("1", "ready", 0), ev("3", "ready", 10), ev("2", "busy", 5), ev("4", "away", 20)},
+		want: "ready 03-04 10:00-03-04 10:05 1\n" +
+			"busy 03-04 10:05-03-04 10:10 2\n" +
+			"ready 03-04 10:10-03-04 10:20 3\n" +
+			"away 03-04 10:20-03-04 11:00 4",
+	}, {
+		name:   "late after a repeated status",
+		events: []assembled.StatusEvent{ev("1", "available", 0), ev("2", "available", 5), ev("3", "break", 3)},
+		late:   []string{"3"},
+		want:   "available 03-04 10:00-03-04 11:00 1",
+	}, {
+		name:     "late beyond lateness",
+		lateness: 5 * time.Minute,
+		events:   []assembled.StatusEvent{ev("1", "ready", 0), ev("2", "busy", 20), ev("3", "away", 10)},
+		late:     []string{"3"},
+		want: "ready 03-04 10:00-03-04 10:20 1\n" +
+			"busy 03-04 10:20-03-04 11:00 2",
+	}, {
+		name:     "duplicates",
+		lateness: 5 * time.Minute,
+		events: []assembled.StatusEvent{
+			ev("1", "ready", 0), ev("1", "ready", 0), ev("", "busy", 5), ev("", "busy", 5), ev("2", "away", 30), ev("", "away", 30),
+		},
+		want: "ready 03-04 10:00-03-04 10:05 1\n" +
+			"busy 03-04 10:05-03-04 10:30 \n" +
+			"away 03-04 10:30-03-04 11:00 2",
+	}, {
+		name:   "same time, different status",
+		events: []assembled.StatusEvent{ev("1", "ready", 0), ev("2", "busy", 5), ev("3", "away", 5), ev("4", "ready", 10)},
+		want: "ready 03-04 10:00-03-04 10:05 1\n" +
+			"away 03-04 10:05-03-04 10:10 3\n" +
+			"ready 03-04 10:10-03-04 11:00 4",
+	}, {
+		name:     "same time, different status, held back",
+		lateness: 10 * time.Minute,
+		events:   []assembled.StatusEvent{ev("1", "ready", 0), ev("2", "busy", 5), ev("3", "away", 5), ev("4", "ready", 20)},
+		want: "ready 03-04 10:00-03-04 10:05 1\n" +
+			"away 03-04 10:05-03-04 10:20 3\n" +
+			"ready 03-04 10:20-03-04 11:00 4",
+	}, {
+		name:   "out of order without lateness",
+		events: []assembled.StatusEvent{ev("1", "ready", 0), ev("2", "busy", 5), ev("3", "away", 4), ev("4", "away", 5)},
+		late:   []string{"3"},
+		want: "ready 03-04 10:00-03-04 10:05 1\n" +
+			"away 03-04 10:05-03-04 11:00 4",
+	}, {
+		name:     "flush clips",
+		lateness: time.Hour,
+		events:   []assembled.StatusEvent{ev("1", "ready", 0), ev("2", "busy", 50), ev("3", "away", 59), ev("4", "ready", 61), ev("5", "busy", 70)},
+		want: "ready 03-04 10:00-03-04 10:50 1\n" +
+			"busy 03-04 10:50-03-04 10:59 2\n" +
+			"away 03-04 10:59-03-04 11:00 3",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := assembled.NewStatusIntervalBuilder(&assembled.StatusIntervalOptions{Lateness: tt.lateness})
+			var (
+				spans []assembled.CreateAgentStatusRequest
+				late  []string
+			)
+			for _, e := range tt.events {
+				out, err := b.Add(e)
+				if errors.Is(err, assembled.ErrLateStatusEvent) {
+					late = append(late, e.EventID)
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				spans = append(spans, out...)
+			}
+			spans = append(spans, b.Flush(flushAt)...)
+			if got := spanString(spans, time.UTC); got != tt.want {
+				t.Errorf("spans:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if fmt.Sprint(late) != fmt.Sprint(tt.late) {
+				t.Errorf("late events %v, want %v", late, tt.late)
+			}
+		})
+	}
+}
+
+func TestStatusIntervalBuilderAdvance(t *testing.T) {
+	b := assembled.NewStatusIntervalBuilder(&assembled.StatusIntervalOptions{Lateness: 5 * time.Minute})
+	b.Add(ev("1", "ready", 0))
+	b.Add(ev("2", "busy", 10))
+	if spans := b.Advance(ev("", "", 12).Time); len(spans) != 0 {
+		t.Errorf("Advance emitted %v before the lateness passed", spans)
+	}
+	spans := b.Advance(ev("", "", 15).Time)
+	if got, want := spanString(spans, time.UTC), "ready 03-04 10:00-03-04 10:10 1"; got != want {
+		t.Errorf("Advance emitted\n%s\nwant\n%s", got, want)
+	}
+	if _, err := b.Add(ev("3", "away", 9)); !errors.Is(err, assembled.ErrLateStatusEvent) {
+		t.Errorf("event before Advance: err = %v, want ErrLateStatusEvent", err)
+	}
+	if cur := b.Current(); len(cur) != 1 || cur[0].Status != "busy" {
+		t.Errorf("Current = %+v", cur)
+	}
+}
+
+func TestStatusIntervalBuilderSplitDays(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(month, day, hour int) time.Time {
+		return time.Date(2021, time.Month(month), day, hour, 0, 0, 0, ny)
+	}
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       string
+	}{
+		{"same day", at(3, 4, 9), at(3, 4, 17), "ready 03-04 09:00-03-04 17:00 e"},
+		{"overnight", at(3, 4, 22), at(3, 5, 2),
+			"ready 03-04 22:00-03-05 00:00 e\nready 03-05 00:00-03-05 02:00 e@2021-03-05"},
+		// The day clocks go forward is 23 hours long, and the one they go
+		// back 25 hours.
+		{"spring forward", at(3, 13, 12), at(3, 15, 1),
+			"ready 03-13 12:00-03-14 00:00 e\nready 03-14 00:00-03-15 00:00 e@2021-03-14\nready 03-15 00:00-03-15 01:00 e@2021-03-15"},
+		{"fall back", at(11, 7, 0), at(11, 8, 0), "ready 11-07 00:00-11-08 00:00 e"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := assembled.NewStatusIntervalBuilder(&assembled.StatusIntervalOptions{SplitDays: ny})
+			b.Add(assembled.StatusEvent{EventID: "e", AgentID: "a1", Status: "ready", Time: tt.start})
+			spans, err := b.Add(assembled.StatusEvent{EventID: "f", AgentID: "a1", Status: "away", Time: tt.end})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spanString(spans, ny); got != tt.want {
+				t.Errorf("spans:\n%s\nwant:\n%s", got, tt.want)
+			}
+			var total time.Duration
+			for _, s := range spans {
+				total += s.EndTime.Sub(s.StartTime)
+			}
+			if d := tt.end.Sub(tt.start); total != d {
+				t.Errorf("spans last %v, want %v", total, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package assembled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrPublisherClosed is returned when publishing to a closed
+	// StatusPublisher.
+	ErrPublisherClosed = errors.New("assembled: status publisher closed")
+
+	// ErrQueueFull is returned by TryPublish when the queue is full.
+	ErrQueueFull = errors.New("assembled: status queue full")
+)
+
+// StatusPublisherOptions configures a StatusPublisher. The zero value uses
+// the defaults given for each field.
+type StatusPublisherOptions struct {
+	// Number of published statuses that may wait to be sent or be in
+	// flight, across all agents. Statuses replayed from the spool are not
+	// counted. Defaults to 1024.
+	QueueSize int
+
+	// Number of statuses sent concurrently. Statuses of the same agent are
+	// always sent one at a time, in order. Defaults to 8.
+	Workers int
+
+	// Retry policy for statuses that fail to send, used instead of the
+	// client's own. Since statuses are de-duplicated by EventID, failed
+	// creations are retried even though they are not idempotent. Defaults
+	// to DefaultRetryPolicy with RetryNonIdempotent set.
+	Retry *RetryPolicy
+
+	// Number of recent EventIDs remembered to drop duplicate statuses.
+	// Defaults to 10000. Statuses without an EventID are never dropped.
+	DedupeWindow int
+
+	// Called after a status is created.
+	OnSuccess func(r *CreateAgentStatusRequest, s *AgentStatus)
+
+	// Called when an accepted status is given up on: it failed with an
+	// error that is not retried, it ran out of attempts, or it was still
+	// queued when Close gave up.
+	OnFailure func(r *CreateAgentStatusRequest, err error)
+
+	// If set, statuses are written to the spool before they are queued, and
+	// acknowledged once created. Statuses left in the spool by a previous
+	// process are sent first, in order. Statuses that fail with a
+	// retryable error, or that Close gives up on, stay in the spool to be
+	// sent again by the next publisher using it, unless a later status of
+	// the same agent is created first: they are then acknowledged too, so
+	// that replaying them cannot overwrite the newer status. The spool is
+	// not closed by Close.
+	Spool *StatusSpool
+}
+
+// StatusPublisherStats counts the statuses handled by a StatusPublisher.
+type StatusPublisherStats struct {
+	Queued     int64 // Accepted and not yet sent or given up on.
+	Published  int64
+	Failed     int64
+	Duplicates int64
+	Spooled    int64 // Statuses in the spool, if any, not yet acknowledged.
+
+	// Acknowledgements that the spool failed to write. Their statuses are
+	// sent again by the next publisher using the spool.
+	AckErrors int64
+}
+
+// StatusPublisher sends agent statuses asynchronously. Statuses are queued
+// and sent in the background by a pool of workers, sharded by agent so that
+// the statuses of each agent are created in the order they were published.
+// Agents are told apart by AgentID, or by AgentName if AgentID is empty, so
+// that statuses naming the same agent in both ways may be sent out of order
+// with each other.
+//
+// Callbacks are called from the worker goroutines, and should not block for
+// long since they hold up the statuses of other agents in the same shard.
+type StatusPublisher struct {
+	client *Client
+	opts   StatusPublisherOptions
+	shards []*statusShard
+	slots  chan struct{} // Held by each published status until handled.
+
+	// Held for reading while publishing and for writing while closing, so
+	// that shards are not closed during a send.
+	mu        sync.RWMutex
+	closed    bool
+	closing   chan struct{} // Closed first, to wake up blocked publishers.
+	closeOnce sync.Once
+
+	// Context of the sends, canceled when Close gives up.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	dedupeMu sync.Mutex
+	recent   *recentIDs
+
+	queued, published, failed, duplicates, ackErrors int64
+}
+
+// statusShard holds the statuses of a subset of agents, sent in order by a
+// single worker.
+type statusShard struct {
+	backlog []*statusEntry // Replayed from the spool, sent first.
+	ch      chan *statusEntry
+
+	// Statuses that failed and were kept in the spool, by agent key, to be
+	// acknowledged once a later status of the agent is created. Only used
+	// by the shard's worker.
+	kept map[string][]*statusEntry
+}
+
+type statusEntry struct {
+	req CreateAgentStatusRequest
+	seq uint64 // Sequence number in the spool, if any.
+}
+
+// NewStatusPublisher returns a publisher creating statuses with c and starts
+// its workers. Call Close to stop it.
+func NewStatusPublisher(c *Client, opts *StatusPublisherOptions) *StatusPublisher {
+	var o StatusPublisherOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 1024
+	}
+	if o.Workers <= 0 {
+		o.Workers = 8
+	}
+	if o.Retry == nil {
+		o.Retry = DefaultRetryPolicy()
+		o.Retry.RetryNonIdempotent = true
+	}
+	if o.DedupeWindow <= 0 {
+		o.DedupeWindow = 10000
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &StatusPublisher{
+		client:  c,
+		opts:    o,
+		shards:  make([]*statusShard, o.Workers),
+		slots:   make(chan struct{}, o.QueueSize),
+		closing: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		recent:  newRecentIDs(o.DedupeWindow),
+	}
+	for i := range p.shards {
+		// Room for every slot, so that queuing into a shard never blocks.
+		p.shards[i] = &statusShard{ch: make(chan *statusEntry, o.QueueSize), kept: make(map[string][]*statusEntry)}
+	}
+	if o.Spool != nil {
+		for _, st := range o.Spool.Pending() {
+			e := &statusEntry{req: st.Status, seq: st.Seq}
+			p.remember(e.req.EventID)
+			shard := p.shards[p.shard(&e.req)]
+			shard.backlog = append(shard.backlog, e)
+			p.queued++
+		}
+	}
+	for _, shard := range p.shards {
+		p.wg.Add(1)
+		go p.work(shard)
+	}
+	return p
+}
+
+// Publish queues a status, waiting for room in the queue until ctx is done.
+// A status whose EventID was recently published is dropped silently.
+func (p *StatusPublisher) Publish(ctx context.Context, r *CreateAgentStatusRequest) error {
+	return p.publish(ctx, r, true)
+}
+
+// TryPublish queues a status, or returns ErrQueueFull if there is no room.
+func (p *StatusPublisher) TryPublish(r *CreateAgentStatusRequest) error {
+	return p.publish(context.Background(), r, false)
+}
+
+func (p *StatusPublisher) publish(ctx context.Context, r *CreateAgentStatusRequest, wait bool) error {
+	if r.AgentID == "" && r.AgentName == "" {
+		return errors.New("assembled: status has neither AgentID nor AgentName")
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPublisherClosed
+	}
+	if !p.remember(r.EventID) {
+		atomic.AddInt64(&p.duplicates, 1)
+		return nil
+	}
+
+	e := &statusEntry{req: *r}
+	if p.opts.Spool != nil {
+		seq, err := p.opts.Spool.Append(&e.req)
+		if err != nil {
+			p.forget(r.EventID)
+			return err
+		}
+		e.seq = seq
+	}
+	atomic.AddInt64(&p.queued, 1)
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		if !wait {
+			p.reject(e)
+			return ErrQueueFull
+		}
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			p.reject(e)
+			return ctx.Err()
+		case <-p.closing:
+			p.reject(e)
+			return ErrPublisherClosed
+		}
+	}
+	p.shards[p.shard(&e.req)].ch <- e
+	return nil
+}
+
+// reject undoes the accounting of a status that could not be queued, so
+// that it may be published again.
+func (p *StatusPublisher) reject(e *statusEntry) {
+	atomic.AddInt64(&p.queued, -1)
+	p.forget(e.req.EventID)
+	p.ack(e)
+}
+
+// ack removes a status from the spool. Failing to do so only means that it
+// is sent again by a later publisher, so errors are only counted.
+func (p *StatusPublisher) ack(e *statusEntry) {
+	if p.opts.Spool != nil && e.seq != 0 {
+		if err := p.opts.Spool.Ack(e.seq); err != nil {
+			atomic.AddInt64(&p.ackErrors, 1)
+		}
+	}
+}
+
+// agentKey identifies the agent of a status. Names are not resolved, so an
+// agent named by ID and by name has two keys.
+func agentKey(r *CreateAgentStatusRequest) string {
+	if r.AgentID != "" {
+		return r.AgentID
+	}
+	return "name:" + r.AgentName
+}
+
+// shard returns the index of the shard of the status's agent.
+func (p *StatusPublisher) shard(r *CreateAgentStatusRequest) int {
+	h := fnv.New32a()
+	h.Write([]byte(agentKey(r)))
+	return int(h.Sum32() % uint32(len(p.shards)))
+}
+
+func (p *StatusPublisher) work(shard *statusShard) {
+	defer p.wg.Done()
+	for _, e := range shard.backlog {
+		p.handle(shard, e)
+	}
+	shard.backlog = nil
+	for e := range shard.ch {
+		p.handle(shard, e)
+		<-p.slots
+	}
+}
+
+func (p *StatusPublisher) handle(shard *statusShard, e *statusEntry) {
+	r := &e.req
+	if p.ctx.Err() != nil {
+		p.fail(shard, e, fmt.Errorf("%w before the status was sent", ErrPublisherClosed), false)
+		return
+	}
+	s, err := p.send(r)
+	if err != nil {
+		// Statuses that may succeed later are kept in the spool.
+		p.fail(shard, e, err, !p.opts.Retry.retryable(err) && p.ctx.Err() == nil)
+		return
+	}
+	p.ack(e)
+	key := agentKey(r)
+	for _, k := range shard.kept[key] {
+		p.ack(k)
+	}
+	delete(shard.kept, key)
+	atomic.AddInt64(&p.queued, -1)
+	atomic.AddInt64(&p.published, 1)
+	if p.opts.OnSuccess != nil {
+		p.opts.OnSuccess(r, s)
+	}
+}
+
+// send creates a status, retrying failures according to the publisher's
+// retry policy rather than the client's.
+func (p *StatusPublisher) send(r *CreateAgentStatusRequest) (*AgentStatus, error) {
+	return p.client.CreateAgentStatus(withRetryPolicy(p.ctx, p.opts.Retry), r)
+}
+
+// fail gives up on a status, removing it from the spool if ack is set.
+func (p *StatusPublisher) fail(shard *statusShard, e *statusEntry, err error, ack bool) {
+	atomic.AddInt64(&p.queued, -1)
+	atomic.AddInt64(&p.failed, 1)
+	// A failed status may be published again.
+	p.forget(e.req.EventID)
+	if ack {
+		p.ack(e)
+	} else if p.opts.Spool != nil && e.seq != 0 {
+		key := agentKey(&e.req)
+		shard.kept[key] = append(shard.kept[key], e)
+	}
+	if p.opts.OnFailure != nil {
+		p.opts.OnFailure(&e.req, err)
+	}
+}
+
+// Close stops accepting statuses and waits until the queued ones are sent.
+// If ctx is done first, statuses still queued or being retried are given up
+// on and reported to OnFailure, and ctx.Err() is returned once the workers
+// have stopped.
+func (p *StatusPublisher) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		close(p.closing)
+		p.mu.Lock()
+		p.closed = true
+		for _, shard := range p.shards {
+			close(shard.ch)
+		}
+		p.mu.Unlock()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Stats returns the current counts of the publisher.
+func (p *StatusPublisher) Stats() StatusPublisherStats {
+	stats := StatusPublisherStats{
+		Queued:     atomic.LoadInt64(&p.queued),
+		Published:  atomic.LoadInt64(&p.published),
+		Failed:     atomic.LoadInt64(&p.failed),
+		Duplicates: atomic.LoadInt64(&p.duplicates),
+		AckErrors:  atomic.LoadInt64(&p.ackErrors),
+	}
+	if p.opts.Spool != nil {
+		stats.Spooled = int64(p.opts.Spool.Depth())
+	}
+	return stats
+}
+
+// remember records an EventID, reporting false if it was already recent.
+func (p *StatusPublisher) remember(id string) bool {
+	if id == "" {
+		return true
+	}
+	p.dedupeMu.Lock()
+	defer p.dedupeMu.Unlock()
+	return p.recent.add(id)
+}
+
+func (p *StatusPublisher) forget(id string) {
+	if id == "" {
+		return
+	}
+	p.dedupeMu.Lock()
+	defer p.dedupeMu.Unlock()
+	p.recent.remove(id)
+}
+
+// recentIDs is a set of the most recently added IDs, up to a fixed number.
+type recentIDs struct {
+	ring []string
+	next int
+	set  map[string]int // Index in ring, by ID.
+}
+
+func newRecentIDs(size int) *recentIDs {
+	return &recentIDs{ring: make([]string, size), set: make(map[string]int, size)}
+}
+
+// add adds id, evicting the oldest ID if the set is full. It reports false
+// if id was already present.
+func (r *recentIDs) add(id string) bool {
+	if _, ok := r.set[id]; ok {
+		return false
+	}
+	if old := r.ring[r.next]; old != "" {
+		if i, ok := r.set[old]; ok && i == r.next {
+			delete(r.set, old)
+		}
+	}
+	r.ring[r.next] = id
+	r.set[id] = r.next
+	r.next = (r.next + 1) % len(r.ring)
+	return true
+}
+
+func (r *recentIDs) remove(id string) {
+	delete(r.set, id)
+}
@@ -0,0 +1,210 @@
+package assembled_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+var statusStart = time.Date(2021, 3, 4, 9, 0, 0, 0, time.UTC)
+
+// status returns the i-th status of an agent, a minute after the previous.
+func status(agentID string, i int) *assembled.CreateAgentStatusRequest {
+	return &assembled.CreateAgentStatusRequest{
+		EventID:   fmt.Sprintf("%s-%d", agentID, i),
+		AgentID:   agentID,
+		Status:    fmt.Sprintf("s%d", i),
+		StartTime: statusStart.Add(time.Duration(i) * time.Minute),
+	}
+}
+
+func fastRetry(codes ...int) *assembled.RetryPolicy {
+	return &assembled.RetryPolicy{
+		MaxAttempts:          3,
+		BaseDelay:            time.Millisecond,
+		MaxDelay:             time.Millisecond,
+		RetryableStatusCodes: codes,
+		RetryNonIdempotent:   true,
+	}
+}
+
+func TestStatusPublisherOrder(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	var agents []string
+	for i := 0; i < 3; i++ {
+		agents = append(agents, srv.AddAgent(assembled.Agent{Name: fmt.Sprint("agent ", i)}).ID)
+	}
+	// The first attempts fail and are retried, keeping each agent in order.
+	srv.InjectFault(assembledtest.Fault{Method: "POST", Times: 2, StatusCode: 503})
+	pub := assembled.NewStatusPublisher(srv.Client(), &assembled.StatusPublisherOptions{Workers: 2, Retry: fastRetry(503)})
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		for _, id := range agents {
+			if err := pub.Publish(context.Background(), status(id, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := pub.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range agents {
+		got := srv.AgentStatuses(id)
+		if len(got) != n {
+			t.Fatalf("agent %s: %d statuses, want %d", id, len(got), n)
+		}
+		for i, s := range got {
+			if want := fmt.Sprint("s", i); s.Status != want {
+				t.Errorf("agent %s: status %d = %s, want %s", id, i, s.Status, want)
+			}
+		}
+	}
+	if got := pub.Stats(); got.Published != 3*n || got.Queued != 0 || got.Failed != 0 {
+		t.Errorf("stats = %+v", got)
+	}
+}
+
+func TestStatusPublisherDedupe(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ada := srv.AddAgent(assembled.Agent{Name: "Ada"}).ID
+	srv.InjectFault(assembledtest.Fault{Method: "POST", Times: 1, StatusCode: 400})
+	var (
+		mu     sync.Mutex
+		failed []string
+	)
+	pub := assembled.NewStatusPublisher(srv.Client(), &assembled.StatusPublisherOptions{
+		Workers: 1,
+		OnFailure: func(r *assembled.CreateAgentStatusRequest, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, r.EventID)
+		},
+	})
+	ctx := context.Background()
+
+	// The first status is rejected, and may then be published again.
+	for _, i := range []int{0, 0, 1, 1} {
+		if err := pub.Publish(ctx, status(ada, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool { return pub.Stats().Queued == 0 })
+	if err := pub.Publish(ctx, status(ada, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 1 || failed[0] != ada+"-0" {
+		t.Errorf("failed %v, want the first status", failed)
+	}
+	var got []string
+	for _, s := range srv.AgentStatuses(ada) {
+		got = append(got, s.Status)
+	}
+	if fmt.Sprint(got) != "[s1 s0]" {
+		t.Errorf("created %v, want [s1 s0]", got)
+	}
+	if stats := pub.Stats(); stats.Duplicates != 2 || stats.Published != 2 || stats.Failed != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestStatusPublisherRetriesOnce(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ada := srv.AddAgent(assembled.Agent{Name: "Ada"}).ID
+	srv.InjectFault(assembledtest.Fault{Method: "POST", StatusCode: 503})
+	// The client would retry too, were its policy not replaced.
+	c := srv.Client(assembled.WithRetryPolicy(&assembled.RetryPolicy{
+		MaxAttempts: 4, RetryableStatusCodes: []int{503}, RetryNonIdempotent: true,
+	}))
+	pub := assembled.NewStatusPublisher(c, &assembled.StatusPublisherOptions{Retry: fastRetry(503)})
+	if err := pub.Publish(context.Background(), status(ada, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(srv.Requests()); got != 3 {
+		t.Errorf("%d attempts, want 3", got)
+	}
+	if got := pub.Stats(); got.Failed != 1 {
+		t.Errorf("stats = %+v", got)
+	}
+}
+
+func TestStatusPublisherBackpressure(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	var agents []string
+	for i := 0; i < 4; i++ {
+		agents = append(agents, srv.AddAgent(assembled.Agent{Name: fmt.Sprint("agent ", i)}).ID)
+	}
+	// Nothing is created until Close gives up.
+	srv.SetLatency(time.Hour)
+	var (
+		mu     sync.Mutex
+		failed []error
+	)
+	pub := assembled.NewStatusPublisher(srv.Client(), &assembled.StatusPublisherOptions{
+		QueueSize: 2,
+		Workers:   4,
+		OnFailure: func(r *assembled.CreateAgentStatusRequest, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, err)
+		},
+	})
+
+	// The queue is shared by every agent, whatever their shard.
+	for i, id := range agents[:2] {
+		if err := pub.TryPublish(status(id, i)); err != nil {
+			t.Fatalf("status %d: %v", i, err)
+		}
+	}
+	if err := pub.TryPublish(status(agents[2], 2)); !errors.Is(err, assembled.ErrQueueFull) {
+		t.Errorf("TryPublish on a full queue: err = %v, want ErrQueueFull", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pub.Publish(ctx, status(agents[3], 3)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Publish on a full queue: err = %v, want DeadlineExceeded", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pub.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v, want DeadlineExceeded", err)
+	}
+	if len(failed) != 2 {
+		t.Errorf("%d statuses given up on, want 2: %v", len(failed), failed)
+	}
+	if got := pub.Stats(); got.Queued != 0 || got.Failed != 2 || got.Published != 0 {
+		t.Errorf("stats = %+v", got)
+	}
+	if err := pub.TryPublish(status(agents[0], 4)); !errors.Is(err, assembled.ErrPublisherClosed) {
+		t.Errorf("TryPublish after Close: err = %v, want ErrPublisherClosed", err)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+	}
+}
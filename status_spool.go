@@ -0,0 +1,440 @@
+package assembled
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SpoolOptions configures a StatusSpool. The zero value uses the defaults
+// given for each field.
+type SpoolOptions struct {
+	// Size at which a segment file is closed and a new one started.
+	// Defaults to 4 MiB.
+	MaxSegmentBytes int64
+
+	// If true, writes are not synced to disk, which is faster but may lose
+	// the latest statuses if the machine crashes.
+	NoSync bool
+}
+
+// StatusSpool is a write-ahead log of agent statuses on local disk, so that
+// statuses not yet delivered survive restarts of the process. Statuses are
+// appended to segment files, acknowledged once delivered, and replayed in
+// order when the spool is opened again. Segments whose statuses are all
+// acknowledged are deleted.
+//
+// A spool is normally used through StatusPublisherOptions.Spool. It is safe
+// for concurrent use, but a directory must only be opened by one spool at a
+// time.
+type StatusSpool struct {
+	dir  string
+	opts SpoolOptions
+
+	mu       sync.Mutex
+	segments []*spoolSegment // Oldest first; the last one is appended to.
+	cur      *os.File
+	curSize  int64
+	acks     *os.File
+	acked    map[uint64]bool // Acknowledged statuses of live segments.
+	pending  []SpooledStatus // Unacknowledged statuses found when opening.
+	nextSeq  uint64
+	depth    int
+	ackLines int
+}
+
+// SpooledStatus is a status stored in a StatusSpool.
+type SpooledStatus struct {
+	Seq    uint64
+	Status CreateAgentStatusRequest
+}
+
+type spoolSegment struct {
+	path  string
+	first uint64 // Sequence number of the first status.
+	count int
+	acked int
+}
+
+type spoolRecord struct {
+	Seq    uint64                   `json:"seq"`
+	Status CreateAgentStatusRequest `json:"status"`
+}
+
+const (
+	spoolSegmentPrefix = "segment-"
+	spoolSegmentSuffix = ".log"
+	spoolAckFile       = "acks.log"
+)
+
+// OpenStatusSpool opens the spool in dir, creating the directory if needed,
+// and loads the statuses not yet acknowledged.
+func OpenStatusSpool(dir string, opts *SpoolOptions) (*StatusSpool, error) {
+	s := &StatusSpool{dir: dir, acked: make(map[uint64]bool), nextSeq: 1}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.MaxSegmentBytes <= 0 {
+		s.opts.MaxSegmentBytes = 4 << 20
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("assembled: opening spool: %w", err)
+	}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("assembled: opening spool: %w", err)
+	}
+	return s, nil
+}
+
+// load reads the segments and acknowledgements in the directory.
+func (s *StatusSpool) load() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, spoolSegmentPrefix+"*"+spoolSegmentSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names) // Names embed zero-padded sequence numbers.
+
+	acked, err := s.readAcks()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		seg, recs, err := readSegment(name)
+		if err != nil {
+			return err
+		}
+		if seg.count == 0 {
+			os.Remove(name)
+			continue
+		}
+		for _, r := range recs {
+			if acked[r.Seq] {
+				seg.acked++
+				s.acked[r.Seq] = true
+			} else {
+				s.pending = append(s.pending, SpooledStatus{Seq: r.Seq, Status: r.Status})
+			}
+			if r.Seq >= s.nextSeq {
+				s.nextSeq = r.Seq + 1
+			}
+		}
+		s.segments = append(s.segments, seg)
+	}
+	s.depth = len(s.pending)
+
+	for i := len(s.segments) - 1; i >= 0; i-- {
+		if s.segments[i].acked == s.segments[i].count {
+			if err := s.removeSegment(i); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.rewriteAcks(); err != nil {
+		return err
+	}
+	// Segments written before the restart are only read again, so statuses
+	// are appended to a new one.
+	return s.rotate()
+}
+
+// readSegment reads the records of a segment file. A record cut short by a
+// crash ends the segment and is truncated away.
+func readSegment(path string) (*spoolSegment, []spoolRecord, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	first, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), spoolSegmentPrefix), spoolSegmentSuffix), 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid segment name %s", path)
+	}
+	seg := &spoolSegment{path: path, first: first}
+	var (
+		records []spoolRecord
+		good    int
+	)
+	for good < len(b) {
+		i := bytes.IndexByte(b[good:], '\n')
+		if i < 0 {
+			break
+		}
+		var r spoolRecord
+		if err := json.Unmarshal(b[good:good+i], &r); err != nil {
+			break
+		}
+		records = append(records, r)
+		good += i + 1
+	}
+	if good < len(b) {
+		if err := os.Truncate(path, int64(good)); err != nil {
+			return nil, nil, err
+		}
+	}
+	seg.count = len(records)
+	return seg, records, nil
+}
+
+func (s *StatusSpool) readAcks() (map[uint64]bool, error) {
+	acked := make(map[uint64]bool)
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, spoolAckFile))
+	if os.IsNotExist(err) {
+		return acked, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// A last line cut short by a crash could hold the prefix of another
+	// number, so only whole lines count. Losing an acknowledgement only
+	// means that the status is delivered again.
+	lines := strings.Split(string(b), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		if seq, err := strconv.ParseUint(line, 10, 64); err == nil {
+			acked[seq] = true
+		}
+	}
+	return acked, nil
+}
+
+// Pending returns the statuses that were not acknowledged when the spool
+// was opened, in the order they were appended.
+func (s *StatusSpool) Pending() []SpooledStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SpooledStatus(nil), s.pending...)
+}
+
+// Depth returns the number of statuses appended and not yet acknowledged.
+func (s *StatusSpool) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth
+}
+
+// Append writes a status to the spool and returns its sequence number.
+func (s *StatusSpool) Append(r *CreateAgentStatusRequest) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur == nil {
+		return 0, fmt.Errorf("assembled: spool closed")
+	}
+	if s.curSize >= s.opts.MaxSegmentBytes {
+		if err := s.rotate(); err != nil {
+			return 0, fmt.Errorf("assembled: spool: %w", err)
+		}
+	}
+	rec := spoolRecord{Seq: s.nextSeq, Status: *r}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+	b = append(b, '\n')
+	if _, err := s.cur.Write(b); err != nil {
+		return 0, fmt.Errorf("assembled: spool: %w", err)
+	}
+	if !s.opts.NoSync {
+		if err := s.cur.Sync(); err != nil {
+			return 0, fmt.Errorf("assembled: spool: %w", err)
+		}
+	}
+	s.curSize += int64(len(b))
+	s.segments[len(s.segments)-1].count++
+	s.nextSeq++
+	s.depth++
+	return rec.Seq, nil
+}
+
+// Ack marks a status as delivered, or given up on, so that it is not
+// replayed. Segments whose statuses are all acknowledged are deleted.
+func (s *StatusSpool) Ack(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.acks == nil {
+		return fmt.Errorf("assembled: spool closed")
+	}
+	i := s.segmentOf(seq)
+	if i < 0 || s.acked[seq] {
+		return nil
+	}
+	if _, err := fmt.Fprintf(s.acks, "%d\n", seq); err != nil {
+		return fmt.Errorf("assembled: spool: %w", err)
+	}
+	if !s.opts.NoSync {
+		if err := s.acks.Sync(); err != nil {
+			return fmt.Errorf("assembled: spool: %w", err)
+		}
+	}
+	s.acked[seq] = true
+	s.ackLines++
+	s.depth--
+	for j, p := range s.pending {
+		if p.Seq == seq {
+			s.pending = append(s.pending[:j:j], s.pending[j+1:]...)
+			break
+		}
+	}
+
+	seg := s.segments[i]
+	seg.acked++
+	if seg.acked < seg.count || i == len(s.segments)-1 {
+		return nil
+	}
+	if err := s.removeSegment(i); err != nil {
+		return fmt.Errorf("assembled: spool: %w", err)
+	}
+	// Drop acknowledgements of deleted segments once they dominate the log.
+	if s.ackLines > 2*len(s.acked)+1024 {
+		if err := s.rewriteAcks(); err != nil {
+			return fmt.Errorf("assembled: spool: %w", err)
+		}
+	}
+	return nil
+}
+
+// segmentOf returns the index of the segment holding seq, or -1.
+func (s *StatusSpool) segmentOf(seq uint64) int {
+	for i := len(s.segments) - 1; i >= 0; i-- {
+		seg := s.segments[i]
+		if seq >= seg.first {
+			if seq < seg.first+uint64(seg.count) {
+				return i
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+// removeSegment deletes a fully acknowledged segment.
+func (s *StatusSpool) removeSegment(i int) error {
+	seg := s.segments[i]
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for seq := seg.first; seq < seg.first+uint64(seg.count); seq++ {
+		delete(s.acked, seq)
+	}
+	s.segments = append(s.segments[:i:i], s.segments[i+1:]...)
+	return nil
+}
+
+// rewriteAcks replaces the acknowledgement log with one holding only the
+// acknowledgements of live segments.
+func (s *StatusSpool) rewriteAcks() error {
+	seqs := make([]uint64, 0, len(s.acked))
+	for seq := range s.acked {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	var b bytes.Buffer
+	for _, seq := range seqs {
+		fmt.Fprintf(&b, "%d\n", seq)
+	}
+
+	path := filepath.Join(s.dir, spoolAckFile)
+	if err := writeFileSync(path+".tmp", b.Bytes()); err != nil {
+		return err
+	}
+	if s.acks != nil {
+		s.acks.Close()
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	if err := s.syncDir(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.acks = f
+	s.ackLines = len(seqs)
+	return nil
+}
+
+// rotate starts a new segment, deleting the current one if it is fully
+// acknowledged.
+func (s *StatusSpool) rotate() error {
+	if s.cur != nil {
+		s.cur.Close()
+		s.cur = nil
+		if last := len(s.segments) - 1; s.segments[last].acked == s.segments[last].count {
+			if err := s.removeSegment(last); err != nil {
+				return err
+			}
+		}
+	}
+	name := fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, s.nextSeq, spoolSegmentSuffix)
+	path := filepath.Join(s.dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	// The new entry of the directory must be durable too, or the synced
+	// statuses of the segment could be lost with it.
+	if err := s.syncDir(); err != nil {
+		f.Close()
+		return err
+	}
+	s.cur = f
+	s.curSize = 0
+	s.segments = append(s.segments, &spoolSegment{path: path, first: s.nextSeq})
+	return nil
+}
+
+// Close closes the files of the spool. Statuses not acknowledged are
+// replayed when it is opened again.
+func (s *StatusSpool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for _, f := range []*os.File{s.cur, s.acks} {
+		if f != nil {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	s.cur, s.acks = nil, nil
+	return err
+}
+
+// syncDir syncs the spool directory, so that files created or renamed in it
+// survive a crash.
+func (s *StatusSpool) syncDir() error {
+	if s.opts.NoSync {
+		return nil
+	}
+	d, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+func writeFileSync(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,227 @@
+package assembled_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/assembledhq/assembled-go"
+	"github.com/assembledhq/assembled-go/assembledtest"
+)
+
+func openSpool(t *testing.T, dir string, opts *assembled.SpoolOptions) *assembled.StatusSpool {
+	t.Helper()
+	s, err := assembled.OpenStatusSpool(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func appendStatuses(t *testing.T, s *assembled.StatusSpool, agentID string, from, to int) []uint64 {
+	t.Helper()
+	var seqs []uint64
+	for i := from; i < to; i++ {
+		seq, err := s.Append(status(agentID, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, seq)
+	}
+	return seqs
+}
+
+// pendingEvents returns the EventIDs of the pending statuses of s.
+func pendingEvents(s *assembled.StatusSpool) string {
+	var ids []string
+	for _, p := range s.Pending() {
+		ids = append(ids, p.Status.EventID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestStatusSpoolReplay(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir, &assembled.SpoolOptions{MaxSegmentBytes: 300})
+	seqs := appendStatuses(t, s, "a", 0, 5)
+	for _, i := range []int{1, 3} {
+		if err := s.Ack(seqs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.Depth(); got != 3 {
+		t.Errorf("depth = %d, want 3", got)
+	}
+	s.Close()
+
+	s = openSpool(t, dir, nil)
+	if got, want := pendingEvents(s), "a-0,a-2,a-4"; got != want {
+		t.Errorf("pending %s, want %s", got, want)
+	}
+	// Sequence numbers carry on after those already used.
+	seq, err := s.Append(status("a", 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq != seqs[4]+1 {
+		t.Errorf("seq = %d, want %d", seq, seqs[4]+1)
+	}
+}
+
+func TestStatusSpoolTornTail(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir, nil)
+	seqs := appendStatuses(t, s, "a", 0, 3)
+	if err := s.Ack(seqs[0]); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// A crash cuts short the last status, and the last acknowledgement
+	// after the prefix of a number such as 23, which is not acknowledged.
+	segments, _ := filepath.Glob(filepath.Join(dir, "segment-*.log"))
+	last := segments[len(segments)-1]
+	before, _ := ioutil.ReadFile(last)
+	appendFile(t, last, `{"seq":4,"status":{"agent_`)
+	appendFile(t, filepath.Join(dir, "acks.log"), fmt.Sprint(seqs[1]))
+
+	s = openSpool(t, dir, nil)
+	if got, want := pendingEvents(s), "a-1,a-2"; got != want {
+		t.Errorf("pending %s, want %s", got, want)
+	}
+	if after, _ := ioutil.ReadFile(last); string(after) != string(before) {
+		t.Errorf("torn segment not truncated:\n%s", after)
+	}
+	if seq, err := s.Append(status("a", 3)); err != nil || seq != 4 {
+		t.Errorf("Append = %d, %v, want 4", seq, err)
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatusSpoolCompaction(t *testing.T) {
+	dir := t.TempDir()
+	// About one status per segment.
+	s := openSpool(t, dir, &assembled.SpoolOptions{MaxSegmentBytes: 100, NoSync: true})
+	const n = 1100
+	for _, seq := range appendStatuses(t, s, "a", 0, n) {
+		if err := s.Ack(seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.Depth(); got != 0 {
+		t.Errorf("depth = %d, want 0", got)
+	}
+	// Acknowledged segments are deleted, but the current one.
+	if segments, _ := filepath.Glob(filepath.Join(dir, "segment-*.log")); len(segments) != 1 {
+		t.Errorf("%d segments left, want 1", len(segments))
+	}
+	// Acknowledgements of deleted segments are dropped from the log.
+	b, err := ioutil.ReadFile(filepath.Join(dir, "acks.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(b), "\n"); lines >= n/2 {
+		t.Errorf("acks.log has %d lines after compaction", lines)
+	}
+	s.Close()
+
+	s = openSpool(t, dir, nil)
+	if got := pendingEvents(s); got != "" {
+		t.Errorf("pending %s after reopening, want none", got)
+	}
+}
+
+func TestStatusPublisherSpool(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ada := srv.AddAgent(assembled.Agent{Name: "Ada"}).ID
+	grace := srv.AddAgent(assembled.Agent{Name: "Grace"}).ID
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Statuses left over by a previous process are sent first, in order.
+	s := openSpool(t, dir, nil)
+	appendStatuses(t, s, ada, 0, 2)
+	s.Close()
+	s = openSpool(t, dir, nil)
+	pub := assembled.NewStatusPublisher(srv.Client(), &assembled.StatusPublisherOptions{Spool: s, Workers: 1})
+	if err := pub.Publish(ctx, status(ada, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, st := range srv.AgentStatuses(ada) {
+		got = append(got, st.Status)
+	}
+	if fmt.Sprint(got) != "[s0 s1 s2]" {
+		t.Errorf("created %v, want [s0 s1 s2]", got)
+	}
+	if d := s.Depth(); d != 0 {
+		t.Errorf("depth = %d after delivery, want 0", d)
+	}
+
+	// A status failing with a retryable error stays in the spool, unless a
+	// later status of the same agent is created.
+	srv.InjectFault(assembledtest.Fault{Method: "POST", Times: 2, StatusCode: 503})
+	pub = assembled.NewStatusPublisher(srv.Client(), &assembled.StatusPublisherOptions{
+		Spool:   s,
+		Workers: 1,
+		Retry:   &assembled.RetryPolicy{MaxAttempts: 1, RetryableStatusCodes: []int{503}},
+	})
+	for _, r := range []*assembled.CreateAgentStatusRequest{status(ada, 3), status(grace, 0), status(ada, 4)} {
+		if err := pub.Publish(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pub.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats := pub.Stats(); stats.Failed != 2 || stats.Published != 1 || stats.Spooled != 1 || stats.AckErrors != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	s.Close()
+
+	s = openSpool(t, dir, nil)
+	if got, want := pendingEvents(s), grace+"-0"; got != want {
+		t.Errorf("pending %s, want %s", got, want)
+	}
+}
+
+func TestStatusPublisherAckErrors(t *testing.T) {
+	srv := assembledtest.NewServer()
+	t.Cleanup(srv.Close)
+	ada := srv.AddAgent(assembled.Agent{Name: "Ada"}).ID
+	srv.SetLatency(20 * time.Millisecond)
+	s := openSpool(t, t.TempDir(), nil)
+	pub := assembled.NewStatusPublisher(srv.Client(), &assembled.StatusPublisherOptions{Spool: s})
+	if err := pub.Publish(context.Background(), status(ada, 0)); err != nil {
+		t.Fatal(err)
+	}
+	// The status is created, but cannot be acknowledged.
+	s.Close()
+	if err := pub.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stats := pub.Stats(); stats.Published != 1 || stats.AckErrors != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
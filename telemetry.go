@@ -1,14 +1,18 @@
 package assembled
 
 import (
-	"context"
 	"crypto/tls"
 	"encoding/json"
 	"net/http"
 	"net/http/httptrace"
+	"sync"
 	"time"
 )
 
+// Number of request timings buffered until they can be sent along with a
+// later request. Timings are dropped when the buffer is full.
+const telemetryBufferSize = 64
+
 type events struct {
 	DNSStart             int64 `json:"dns_start,string,omitempty"`
 	DNSDone              int64 `json:"dns_done,string,omitempty"`
@@ -28,57 +32,117 @@ type timing struct {
 	ID         string    `json:"id"`
 }
 
-func (t *timing) D() int64 {
-	return int64(time.Now().UTC().Sub(t.Start) / time.Millisecond)
+// requestTrace records when each phase of a request attempt happened.
+type requestTrace struct {
+	// Trace hooks may run concurrently, for example when dialing several
+	// addresses at once.
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	firstByte    time.Time
+	done         time.Time
 }
 
-func withTelemetry(ctx context.Context, c *Client, r *http.Request) (*http.Request, func(*http.Response)) {
-	select {
-	case metric := <-c.metrics:
-		if metric != nil {
-			payload, err := json.Marshal(&metric)
-			if err == nil {
-				r.Header.Set("Client-Telemetry", string(payload))
-			}
-		}
-	default:
-		// pass
+// mark records the current time in at, unless it has already been recorded.
+func (t *requestTrace) mark(at *time.Time) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.IsZero() {
+		*at = now
 	}
+}
 
-	t := &timing{Start: time.Now().UTC()}
+func (t *requestTrace) finish() {
+	t.mark(&t.done)
+}
+
+func traceRequest(r *http.Request) (*http.Request, *requestTrace) {
+	t := &requestTrace{start: time.Now()}
 	trace := &httptrace.ClientTrace{
-		DNSStart: func(_ httptrace.DNSStartInfo) { t.Events.DNSStart = t.D() },
-		DNSDone:  func(_ httptrace.DNSDoneInfo) { t.Events.DNSDone = t.D() },
+		DNSStart: func(_ httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(_ httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
 		ConnectStart: func(_, _ string) {
-			if t.Events.DNSDone == 0 {
-				// connecting to IP
-				t.Events.DNSDone = t.D()
-			}
-		},
-		ConnectDone: func(net, addr string, err error) {
-			t.Events.ConnectDone = t.D()
+			// Connecting straight to an IP address skips DNS.
+			t.mark(&t.dnsDone)
+			t.mark(&t.connectStart)
 		},
-		GotConn:              func(_ httptrace.GotConnInfo) { t.Events.GotConn = t.D() },
-		GotFirstResponseByte: func() { t.Events.GotFirstResponseByte = t.D() },
-		TLSHandshakeStart:    func() { t.Events.TLSHandshakeStart = t.D() },
-		TLSHandshakeDone:     func(_ tls.ConnectionState, _ error) { t.Events.TLSHandshakeDone = t.D() },
+		ConnectDone:          func(_, _ string, _ error) { t.mark(&t.connectDone) },
+		GotConn:              func(_ httptrace.GotConnInfo) { t.mark(&t.gotConn) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(_ tls.ConnectionState, _ error) { t.mark(&t.tlsDone) },
 	}
+	return r.WithContext(httptrace.WithClientTrace(r.Context(), trace)), t
+}
 
-	return r.WithContext(httptrace.WithClientTrace(ctx, trace)), func(resp *http.Response) {
-		if resp == nil {
-			return
+// telemetry returns the channel of pending timings, allocating it on first
+// use for clients that were not created with NewClient.
+func (c *Client) telemetry() chan *timing {
+	c.metricsOnce.Do(func() {
+		if c.metrics == nil {
+			c.metrics = make(chan *timing, telemetryBufferSize)
 		}
-		id := resp.Header.Get("Request-Id")
-		if len(id) == 0 {
-			return
+	})
+	return c.metrics
+}
+
+// attachTelemetry sends the timing of an earlier request to Assembled in the
+// Client-Telemetry header of r.
+func (c *Client) attachTelemetry(r *http.Request) {
+	select {
+	case metric := <-c.telemetry():
+		payload, err := json.Marshal(metric)
+		if err == nil {
+			r.Header.Set("Client-Telemetry", string(payload))
 		}
+	default:
+		// pass
+	}
+}
 
-		t.ID = id
-		t.Events.DecodeBodyDone = t.D()
+// recordTelemetry queues the timing of a finished request to be sent with a
+// later one.
+func (c *Client) recordTelemetry(t *requestTrace, resp *http.Response) {
+	id := resp.Header.Get("Request-Id")
+	if len(id) == 0 {
+		return
+	}
 
-		select {
-		case c.metrics <- t:
-		default:
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ms := func(at time.Time) int64 {
+		if at.IsZero() {
+			return 0
 		}
+		return int64(at.Sub(t.start) / time.Millisecond)
+	}
+	metric := &timing{
+		Start: t.start.UTC(),
+		Events: events{
+			DNSStart:             ms(t.dnsStart),
+			DNSDone:              ms(t.dnsDone),
+			ConnectStart:         ms(t.connectStart),
+			ConnectDone:          ms(t.connectDone),
+			TLSHandshakeStart:    ms(t.tlsStart),
+			TLSHandshakeDone:     ms(t.tlsDone),
+			GotConn:              ms(t.gotConn),
+			GotFirstResponseByte: ms(t.firstByte),
+			DecodeBodyDone:       ms(t.done),
+		},
+		StatusCode: resp.StatusCode,
+		ID:         id,
+	}
+
+	select {
+	case c.telemetry() <- metric:
+	default:
 	}
 }
@@ -0,0 +1,91 @@
+package assembled
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTelemetryServer(t *testing.T) (*httptest.Server, chan string) {
+	headers := make(chan string, 10)
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		headers <- r.Header.Get("Client-Telemetry")
+		w.Header().Set("Request-Id", fmt.Sprintf("req_%d", n))
+		fmt.Fprint(w, `{"agents":{}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, headers
+}
+
+func TestTelemetrySentWithNextRequest(t *testing.T) {
+	srv, headers := newTelemetryServer(t)
+	c := NewClient("key", WithBaseURL(srv.URL))
+	ctx := context.Background()
+
+	if _, err := c.ListAgents(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if h := <-headers; h != "" {
+		t.Fatalf("first request carried telemetry %q", h)
+	}
+
+	if _, err := c.ListAgents(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	var got timing
+	if err := json.Unmarshal([]byte(<-headers), &got); err != nil {
+		t.Fatalf("decoding Client-Telemetry header: %v", err)
+	}
+	if got.ID != "req_1" {
+		t.Errorf("ID = %q, want req_1", got.ID)
+	}
+	if got.StatusCode != 200 {
+		t.Errorf("StatusCode = %d, want 200", got.StatusCode)
+	}
+	if got.Start.IsZero() {
+		t.Error("Start is zero")
+	}
+	e := got.Events
+	if e.ConnectStart > e.ConnectDone || e.ConnectDone > e.GotConn {
+		t.Errorf("connection events out of order: %+v", e)
+	}
+	if e.GotFirstResponseByte > e.DecodeBodyDone {
+		t.Errorf("body decoded before first byte: %+v", e)
+	}
+}
+
+func TestTelemetryDisabled(t *testing.T) {
+	srv, headers := newTelemetryServer(t)
+	c := NewClient("key", WithBaseURL(srv.URL), WithTelemetry(false))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.ListAgents(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+		if h := <-headers; h != "" {
+			t.Fatalf("request %d carried telemetry %q", i, h)
+		}
+	}
+}
+
+func TestTelemetryStructLiteralClient(t *testing.T) {
+	srv, headers := newTelemetryServer(t)
+	c := &Client{Base: srv.URL, EnableTelemetry: true}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.ListAgents(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-headers
+	if h := <-headers; h == "" {
+		t.Fatal("second request carried no telemetry")
+	}
+}